@@ -0,0 +1,27 @@
+package backs
+
+import (
+	"slices"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// isAdmin reports whether the interaction's member may use admin commands: either they
+// can manage the guild, or they have one of the configured admin roles.
+func isAdmin(i *discordgo.InteractionCreate, adminRoles []string) bool {
+	if i.Member == nil {
+		return false
+	}
+
+	if i.Member.Permissions&(discordgo.PermissionManageServer|discordgo.PermissionAdministrator) != 0 {
+		return true
+	}
+
+	for _, role := range i.Member.Roles {
+		if slices.Contains(adminRoles, role) {
+			return true
+		}
+	}
+
+	return false
+}
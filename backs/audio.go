@@ -2,54 +2,80 @@ package backs
 
 import (
 	"back-bot/backs/loot"
-	"back-bot/backs/model"
+	"back-bot/logging"
+	"back-bot/metrics"
 	"encoding/binary"
-	"fmt"
 	"io"
 	"io/fs"
+	"log/slog"
+	"slices"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 )
 
 func (b *backHandler) Who(s *discordgo.Session, info BackInfo) error {
+	logger := slog.With(info.logAttrs()...)
 
-	back, err := chooseBack(b.backs)
+	userID := loot.UserID(info.Back.ID)
+	weights := b.pity.weights(b.rarityWeights, b.lootActions.GetState(userID).RollsSince)
+
+	rarity, err := rollRarity(weights)
+	if err != nil {
+		logger.Error("could not roll a rarity!!! - CRITICAL", logging.Err, err)
+		return err
+	}
+
+	back, err := b.selector.pick(info.VoiceState.GuildID, rarity, b.backs.ActiveBacks(time.Now())[rarity])
 	if err != nil {
-		fmt.Println("Could not choose a back!!! - CRITICAL: ", err)
+		logger.Error("could not choose a back!!! - CRITICAL", logging.Err, err)
 		return err
 	}
 
-	fmt.Println("BACK CHOSEN: ", back)
+	logger = logger.With(slog.String(logging.BackPath, back.Path()))
+	logger.Info("back chosen", "rarity", back.Rarity().String())
 
 	backData, err := loadBack(b.backfs, back.Path())
 	if err != nil {
-		fmt.Println("Could not acknowledge back!!! - CRITICAL: ", err)
+		logger.Error("could not acknowledge back!!! - CRITICAL", logging.Err, err)
 		return err
 	}
 	err = playBack(s, info, backData)
 	// on successful playback, register the appropriate loot action
 	if err == nil {
-		userID := loot.UserID(info.Back.ID)
+		metrics.BacksPlayed.With(back.Rarity().String()).Inc()
 
-		if back.Rarity() == model.Rollback {
+		b.lootActions.RecordRoll(userID, back.Rarity())
+		if back.Rarity().IsRollback() {
+			if b.beforeRollback != nil {
+				b.beforeRollback(userID)
+			}
 			b.lootActions.Rollback(userID)
 		} else {
 			b.lootActions.AddLoot(userID, back)
 		}
+
+		if wotd := WordOfTheDay(time.Now()); b.wordOfTheDayBonus > 0 && slices.Contains(info.Languages, wotd.Language) {
+			logger.Info("back in the word of the day's language, awarding bonus", "language", wotd.Language, "bonus", b.wordOfTheDayBonus)
+			b.lootActions.AddGreenbacks(userID, b.wordOfTheDayBonus)
+		}
 	}
 
 	return err
 }
 
 func playBack(s *discordgo.Session, info BackInfo, backBytes [][]byte) error {
+	logger := slog.With(info.logAttrs()...)
+
 	// Join the provided voice channel.
+	joinStart := time.Now()
 	vc, err := s.ChannelVoiceJoin(info.VoiceState.GuildID, info.VoiceState.ChannelID, false, false)
+	metrics.VoiceJoinSeconds.Observe(time.Since(joinStart).Seconds())
 
 	defer vc.Disconnect()
 
 	if err != nil {
-		fmt.Println("error joining channel: ", err)
+		logger.Error("error joining channel", logging.Err, err)
 		return err
 	}
 
@@ -58,7 +84,7 @@ func playBack(s *discordgo.Session, info BackInfo, backBytes [][]byte) error {
 
 	err = vc.Speaking(true)
 	if err != nil {
-		fmt.Println("I have no mouth but I must back: ", err)
+		logger.Error("I have no mouth but I must back", logging.Err, err)
 		return err
 	}
 
@@ -77,10 +103,13 @@ func playBack(s *discordgo.Session, info BackInfo, backBytes [][]byte) error {
 }
 
 func loadBack(backfs fs.FS, backPath string) ([][]byte, error) {
+	start := time.Now()
+	defer func() { metrics.LoadBackSeconds.Observe(time.Since(start).Seconds()) }()
+
 	buffer := make([][]byte, 0)
 	file, err := backfs.Open(backPath)
 	if err != nil {
-		fmt.Println("Error opening dca file :", err)
+		slog.Error("error opening dca file", logging.BackPath, backPath, logging.Err, err)
 		return [][]byte{}, err
 	}
 
@@ -100,7 +129,7 @@ func loadBack(backfs fs.FS, backPath string) ([][]byte, error) {
 		}
 
 		if err != nil {
-			fmt.Println("Error reading from dca file :", err)
+			slog.Error("error reading from dca file", logging.BackPath, backPath, logging.Err, err)
 			return [][]byte{}, err
 		}
 
@@ -110,7 +139,7 @@ func loadBack(backfs fs.FS, backPath string) ([][]byte, error) {
 
 		// Should not be any end of file errors
 		if err != nil {
-			fmt.Println("Error reading from dca file :", err)
+			slog.Error("error reading from dca file", logging.BackPath, backPath, logging.Err, err)
 			return [][]byte{}, err
 		}
 
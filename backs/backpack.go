@@ -0,0 +1,211 @@
+package backs
+
+import (
+	"back-bot/backs/loot"
+	"back-bot/backs/model"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// maxEmbedsPerMessage is Discord's limit on embeds in one message.
+	maxEmbedsPerMessage = 10
+	// backpackPageLines is how many backs each page of /backpack lists. Along with
+	// maxBackpackNameLength, it keeps every page well within Discord's embed limits.
+	backpackPageLines     = 30
+	maxBackpackNameLength = 60
+)
+
+// backpackSection is a titled list of loot, like one rarity or an event's exclusives.
+type backpackSection struct {
+	title string
+	color int
+	items []backpackItem
+}
+
+type backpackItem struct {
+	name  string
+	count int
+}
+
+// backpackPages lays out a user's backpack as pages of embeds. Each page starts with
+// a summary of the user's loot, and their progress towards each rarity with pity,
+// followed by a section for each rarity and event they have backs from.
+func backpackPages(username string, state loot.UserLootState, names func(model.Back) string, pity PityRules, now time.Time) [][]*discordgo.MessageEmbed {
+	sections := backpackSections(state, names)
+
+	var summary strings.Builder
+	if len(sections) == 0 {
+		fmt.Fprintln(&summary, "Nothing in here yet! Say back while you're in a voice channel to start collecting.")
+	}
+	fmt.Fprintf(&summary, "Total nominal value is %d greenbacks\n", state.RarityPoints())
+	if state.Greenbacks > 0 {
+		fmt.Fprintf(&summary, "Wallet: %d greenbacks\n", state.Greenbacks)
+	}
+	if streak := state.Streak(now); streak > 0 {
+		fmt.Fprintf(&summary, "Daily streak: %d days\n", streak)
+	}
+	for _, rarity := range model.Rarities {
+		if _, ok := pity[rarity]; !ok {
+			continue
+		}
+		if rolls := state.RollsSince[rarity]; rolls > 0 {
+			fmt.Fprintf(&summary, "%d backs since your last %s\n", rolls, rarity)
+		}
+	}
+	header := func() *discordgo.MessageEmbed {
+		return &discordgo.MessageEmbed{
+			Title:       fmt.Sprintf("%s's backpack", username),
+			Description: summary.String(),
+		}
+	}
+
+	pages := [][]*discordgo.MessageEmbed{{header()}}
+	var lines int
+	for _, section := range sections {
+		items := section.items
+		for continued := false; len(items) > 0; continued = true {
+			page := pages[len(pages)-1]
+			if lines == backpackPageLines || len(page) == maxEmbedsPerMessage {
+				page = []*discordgo.MessageEmbed{header()}
+				pages = append(pages, page)
+				lines = 0
+			}
+
+			n := min(len(items), backpackPageLines-lines)
+			title := section.title
+			if continued {
+				title += " (continued)"
+			}
+			pages[len(pages)-1] = append(page, &discordgo.MessageEmbed{
+				Title:       title,
+				Color:       section.color,
+				Description: alignedItems(items[:n]),
+			})
+
+			items = items[n:]
+			lines += n
+		}
+	}
+
+	if len(pages) > 1 {
+		for n, page := range pages {
+			page[len(page)-1].Footer = &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("Page %d of %d", n+1, len(pages))}
+		}
+	}
+	return pages
+}
+
+// backpackSections groups the user's loot into a section per rarity, rarest first,
+// then a section per event. Empty sections are left out.
+func backpackSections(state loot.UserLootState, names func(model.Back) string) []backpackSection {
+	var sections []backpackSection
+
+	lootByRarity := state.LootByRarity()
+	for _, rarity := range model.Rarities {
+		tier := rarity.Tier()
+		section := backpackSection{title: fmt.Sprintf("%s %s", tier.Emoji, rarity), color: tier.Color}
+		if value := model.RarityLootValues[rarity]; value > 0 {
+			section.title += fmt.Sprintf(" · %d each", value)
+		}
+		section.items = backpackItems(lootByRarity[rarity], names, func(b model.Back) bool { return b.Event() == "" })
+		if len(section.items) > 0 {
+			sections = append(sections, section)
+		}
+	}
+
+	lootByEvent := state.LootByEvent()
+	events := make([]string, 0, len(lootByEvent))
+	for event := range lootByEvent {
+		events = append(events, event)
+	}
+	slices.Sort(events)
+	for _, event := range events {
+		section := backpackSection{title: fmt.Sprintf("%s exclusives", event)}
+		section.items = backpackItems(lootByEvent[event], names, func(model.Back) bool { return true })
+		// an event's section takes the color of its rarest back
+		for _, rarity := range model.Rarities {
+			if slices.ContainsFunc(lootByEvent[event], func(item loot.LootItem) bool { return item.Back.Rarity() == rarity && item.Count > 0 }) {
+				section.color = rarity.Tier().Color
+				break
+			}
+		}
+		if len(section.items) > 0 {
+			sections = append(sections, section)
+		}
+	}
+
+	return sections
+}
+
+// backpackItems names the loot that include allows, most collected first.
+func backpackItems(lootItems []loot.LootItem, names func(model.Back) string, include func(model.Back) bool) []backpackItem {
+	var items []backpackItem
+	for _, lootItem := range lootItems {
+		if lootItem.Count > 0 && include(lootItem.Back) {
+			items = append(items, backpackItem{name: truncate(names(lootItem.Back), maxBackpackNameLength), count: lootItem.Count})
+		}
+	}
+
+	// pages must list backs in the same order every time
+	slices.SortFunc(items, func(a, b backpackItem) int {
+		if a.count != b.count {
+			return b.count - a.count
+		}
+		return strings.Compare(a.name, b.name)
+	})
+	return items
+}
+
+// alignedItems lists items in a code block, with their counts lined up.
+func alignedItems(items []backpackItem) string {
+	var width int
+	for _, item := range items {
+		width = max(width, utf8.RuneCountInString(item.name))
+	}
+
+	var b strings.Builder
+	b.WriteString("```\n")
+	for _, item := range items {
+		padding := strings.Repeat(" ", width-utf8.RuneCountInString(item.name))
+		fmt.Fprintf(&b, "%s%s  x%d\n", item.name, padding, item.count)
+	}
+	b.WriteString("```")
+	return b.String()
+}
+
+func truncate(s string, length int) string {
+	if utf8.RuneCountInString(s) <= length {
+		return s
+	}
+	return string([]rune(s)[:length-1]) + "…"
+}
+
+// backpackButtons page through owner's backpack from page, counting from zero, of pages.
+func backpackButtons(ownerID string, page, pages int) []discordgo.MessageComponent {
+	if pages <= 1 {
+		return nil
+	}
+
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{
+				Label:    "◀ Previous",
+				Style:    discordgo.SecondaryButton,
+				CustomID: fmt.Sprintf("%s:page:%s:%d", BackpackCmd.Name, ownerID, page-1),
+				Disabled: page == 0,
+			},
+			discordgo.Button{
+				Label:    "Next ▶",
+				Style:    discordgo.SecondaryButton,
+				CustomID: fmt.Sprintf("%s:page:%s:%d", BackpackCmd.Name, ownerID, page+1),
+				Disabled: page == pages-1,
+			},
+		}},
+	}
+}
@@ -0,0 +1,113 @@
+package backs
+
+import (
+	"back-bot/backs/loot"
+	"back-bot/backs/model"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestBackpackPages(t *testing.T) {
+	names := func(b model.Back) string { return b.Backname() }
+	back := func(path string) model.Back {
+		b, _ := model.GetBack(path)
+		return b
+	}
+
+	empty := backpackPages("drew", loot.UserLootState{}, names, nil, time.Now())
+	if len(empty) != 1 || len(empty[0]) != 1 || !strings.Contains(empty[0][0].Description, "Nothing in here yet") {
+		t.Fatalf("expected a single summary with an empty state, got %+v", empty)
+	}
+
+	state := loot.UserLootState{Loot: map[model.Back]int{
+		back("Rare/welcome_back.dca"):                 1,
+		back("Common/hi.dca"):                         3,
+		back("Common/hello_back.dca"):                 1,
+		back("Rollback/rollback.dca"):                 2,
+		back("Events/Halloween/Rare/spooky_back.dca"): 1,
+	}}
+	state.RollsSince = map[model.Rarity]int{model.Rare: 40, model.Uncommon: 12}
+	pages := backpackPages("drew", state, names, PityRules{model.Rare: {SoftAfter: 30, SoftStep: 1}}, time.Now())
+	if len(pages) != 1 || len(pages[0]) != 5 {
+		t.Fatalf("expected one page with a summary and four sections, got %+v", pages)
+	}
+
+	summary := pages[0][0].Description
+	if !strings.Contains(summary, "40 backs since your last Rare") || strings.Contains(summary, "Uncommon") {
+		t.Errorf("expected progress towards only the rarities with pity, got:\n%s", summary)
+	}
+
+	titles := []string{"⏪ Rollback", "🌟 Rare · 5000 each", "🔙 Common · 125 each", "Halloween exclusives"}
+	for n, title := range titles {
+		if embed := pages[0][n+1]; embed.Title != title {
+			t.Errorf("expected section %d to be %q, got %q", n, title, embed.Title)
+		}
+	}
+	if pages[0][2].Color != model.Rare.Tier().Color || pages[0][4].Color != model.Rare.Tier().Color {
+		t.Error("expected rare and event sections in the rare tier's color")
+	}
+	if expected := "```\nhi          x3\nhello_back  x1\n```"; pages[0][3].Description != expected {
+		t.Errorf("expected aligned common backs, got:\n%s", pages[0][3].Description)
+	}
+	if pages[0][len(pages[0])-1].Footer != nil {
+		t.Error("expected no page numbers on a single page")
+	}
+
+	state.Loot = make(map[model.Back]int)
+	for n := range backpackPageLines + 5 {
+		state.Loot[back(fmt.Sprintf("Common/back_%02d.dca", n))] = 1
+	}
+	pages = backpackPages("drew", state, names, nil, time.Now())
+	if len(pages) != 2 {
+		t.Fatalf("expected the backpack to spill onto a second page, got %d pages", len(pages))
+	}
+	if continued := pages[1][1]; !strings.HasSuffix(continued.Title, "(continued)") || strings.Count(continued.Description, "\n") != 6 {
+		t.Errorf("expected the last 5 backs to continue on page 2, got %+v", continued)
+	}
+	if footer := pages[1][1].Footer; footer == nil || footer.Text != "Page 2 of 2" {
+		t.Errorf("expected page numbers, got %+v", footer)
+	}
+	if buttons := backpackButtons("1234", 0, 2); len(buttons) != 1 {
+		t.Error("expected page buttons for a long backpack")
+	}
+}
+
+func TestBackpackChoices(t *testing.T) {
+	backfs := fstest.MapFS{
+		"Common/hello_back.dca": {},
+		"Common/hi.dca":         {},
+		"Rare/welcome_back.dca": {},
+		"Uncommon/wb.dca":       {},
+		MetadataFile:            {Data: []byte(`{"Uncommon/wb.dca": {"name": "welcome_back"}}`)},
+	}
+	provider := NewBackProvider(backfs)
+	state := loot.UserLootState{Loot: map[model.Back]int{}}
+	for path, count := range map[string]int{"Common/hello_back.dca": 1, "Common/hi.dca": 3, "Rare/welcome_back.dca": 1, "Uncommon/wb.dca": 1} {
+		back, _ := model.GetBack(path)
+		state.Loot[back] = count
+	}
+
+	values := func(input string) []string {
+		var out []string
+		for _, choice := range backpackChoices(provider, state, input) {
+			out = append(out, fmt.Sprint(choice.Value))
+		}
+		return out
+	}
+
+	// both welcome_backs tie on score, count and name, leaving only their paths
+	expected := []string{"Rare/welcome_back.dca", "Uncommon/wb.dca"}
+	// backpacks are maps, so an order that isn't fully decided would show up across runs
+	for range 20 {
+		if actual := values("welcome_back"); !slices.Equal(actual, expected) {
+			t.Fatalf("expected backs with the same name to be ordered by path, got %v", actual)
+		}
+	}
+	if actual := values("hi"); len(actual) == 0 || actual[0] != "Common/hi.dca" {
+		t.Errorf("expected the best match first, got %v", actual)
+	}
+}
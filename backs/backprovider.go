@@ -1,19 +1,34 @@
 package backs
 
-import "io/fs"
+import (
+	"back-bot/backs/model"
+	"io/fs"
+	"slices"
+	"time"
+)
 
 // TODO: expand to handle all backfs interactions?
 // currently this is just a shared cache for BackMapping
 type BackProvider interface {
+	// Backs are the regular backs, without any event pools.
 	Backs() BackMapping
+	// ActiveBacks are the backs that can roll at now, including the pools of running events.
+	ActiveBacks(now time.Time) BackMapping
+	// DisplayName is what to call the back, from MetadataFile if it names one.
+	DisplayName(back model.Back) string
+	// Tags are the back's tags from MetadataFile, plus the event it's exclusive to, if any.
+	Tags(back model.Back) []string
 }
 
 type backProvider struct {
 	backfs  fs.FS
 	mapping BackMapping
+	events  []eventPool
+	// metadata is keyed by back path
+	metadata map[string]BackMetadata
 }
 
-func NewBackProvider(backfs fs.FS) *backProvider {
+func NewBackProvider(backfs fs.FS, events ...Event) *backProvider {
 	provider := new(backProvider)
 	provider.backfs = backfs
 
@@ -24,9 +39,39 @@ func NewBackProvider(backfs fs.FS) *backProvider {
 
 	provider.mapping = mapping
 
+	metadata, err := GetBackMetadata(backfs)
+	if err != nil {
+		panic(err)
+	}
+	provider.metadata = metadata
+
+	for _, event := range events {
+		backs, err := GetEventBacks(backfs, event.Name)
+		if err != nil {
+			panic(err)
+		}
+		provider.events = append(provider.events, eventPool{Event: event, backs: backs})
+	}
+
 	return provider
 }
 
 func (b *backProvider) Backs() BackMapping {
 	return b.mapping
 }
+
+func (b *backProvider) ActiveBacks(now time.Time) BackMapping {
+	return withEvents(b.mapping, b.events, now)
+}
+
+func (b *backProvider) DisplayName(back model.Back) string {
+	return displayName(b.metadata, back)
+}
+
+func (b *backProvider) Tags(back model.Back) []string {
+	tags := slices.Clone(b.metadata[back.Path()].Tags)
+	if event := back.Event(); event != "" {
+		tags = append(tags, event)
+	}
+	return tags
+}
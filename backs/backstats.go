@@ -0,0 +1,94 @@
+package backs
+
+import (
+	"back-bot/backs/stats"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// backStatsTop is how many entries each /backstats list shows.
+const backStatsTop = 10
+
+var BackStatsCmd = &discordgo.ApplicationCommand{
+	Name:         "backstats",
+	Description:  "Statistics about backs",
+	Type:         discordgo.ChatApplicationCommand,
+	DMPermission: &falseVar,
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "words",
+			Description: "Which words and languages people back with",
+		},
+	},
+}
+
+type backStatsCmdHandler struct {
+	stats *stats.Store
+	// wordOfTheDayBonus is shown alongside the word of the day. Zero means it's off.
+	wordOfTheDayBonus int
+}
+
+func NewBackStatsCmdHandler(store *stats.Store, wordOfTheDayBonus int) *backStatsCmdHandler {
+	return &backStatsCmdHandler{
+		stats:             store,
+		wordOfTheDayBonus: wordOfTheDayBonus,
+	}
+}
+
+func (b *backStatsCmdHandler) BackStats(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	switch i.ApplicationCommandData().Options[0].Name {
+	case "words":
+		b.words(s, i)
+	}
+}
+
+func (b *backStatsCmdHandler) words(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	guild := b.stats.Guild(i.GuildID)
+
+	var content strings.Builder
+	w := func(s string, args ...any) { fmt.Fprintf(&content, s, args...) }
+	wln := func(s string, args ...any) { s = s + "\n"; w(s, args...) }
+	list := func(entries []stats.Entry) {
+		for n, entry := range entries {
+			wln("%d. %s: %d", n+1, entry.Name, entry.Count)
+		}
+	}
+
+	if b.wordOfTheDayBonus > 0 {
+		wotd := WordOfTheDay(time.Now())
+		wln("**Word of the day:** %s (%s). Backs in %s earn %d bonus greenbacks!", wotd.Word, wotd.Language, wotd.Language, b.wordOfTheDayBonus)
+		wln("")
+	}
+
+	if len(guild.Triggers) == 0 {
+		wln("Nobody has backed here yet.")
+	} else {
+		wln("**Top languages here:**")
+		list(stats.Top(guild.Languages, backStatsTop))
+		wln("")
+		wln("**Top words here:**")
+		list(stats.Top(guild.Triggers, backStatsTop))
+		wln("")
+
+		var spoken int
+		for _, bw := range BackWordLanguages {
+			if guild.Languages[bw.Language] > 0 {
+				spoken++
+			}
+		}
+		wln("This server has backed in %d of %d languages.", spoken, len(BackWordLanguages))
+	}
+
+	total := b.stats.Total()
+	if len(total.Triggers) > 0 {
+		wln("")
+		wln("**Top languages everywhere:**")
+		list(stats.Top(total.Languages, backStatsTop))
+	}
+
+	respond(s, i, content.String(), false)
+}
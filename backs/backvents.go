@@ -1,11 +1,20 @@
 package backs
 
 import (
+	"back-bot/backs/cooldown"
+	"back-bot/backs/detect"
 	"back-bot/backs/loot"
 	"back-bot/backs/model"
+	"back-bot/backs/settings"
+	"back-bot/backs/stats"
+	"back-bot/logging"
+	"back-bot/metrics"
 	"fmt"
 	"io/fs"
-	"strings"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 )
@@ -15,6 +24,23 @@ type BackInfo struct {
 	// TODO: is Message used for anything?
 	Message *discordgo.MessageCreate
 	Back    *discordgo.User
+	// Languages are those of the word that triggered the back, if any
+	Languages []string
+}
+
+// logAttrs returns the identifying attributes of the back, for use with slog.With.
+func (info BackInfo) logAttrs() []any {
+	var attrs []any
+	if info.VoiceState != nil {
+		attrs = append(attrs,
+			slog.String(logging.GuildID, info.VoiceState.GuildID),
+			slog.String(logging.ChannelID, info.VoiceState.ChannelID),
+		)
+	}
+	if info.Back != nil {
+		attrs = append(attrs, slog.String(logging.UserID, info.Back.ID))
+	}
+	return attrs
 }
 
 type BackHandler interface {
@@ -23,68 +49,361 @@ type BackHandler interface {
 
 type backHandlerLootActions interface {
 	AddLoot(userID loot.UserID, loot model.Back)
+	AddGreenbacks(userID loot.UserID, gb int)
+	GetState(userID loot.UserID) loot.UserLootState
+	RecordRoll(userID loot.UserID, rarity model.Rarity)
 	Rollback(userID loot.UserID)
 }
 
+type MessageUpdateHandler interface {
+	HandleUpdate(session *discordgo.Session, msg *discordgo.MessageUpdate) (handled bool, err error)
+}
+
+// MessagePolicy decides which messages can trigger backs.
+type MessagePolicy struct {
+	AllowBots     bool
+	AllowWebhooks bool
+	// Edits checks edited messages for backs. Each message backs at most once.
+	Edits bool
+	// IgnoreChannels are channel IDs where backs are never triggered.
+	IgnoreChannels []string
+	// IgnoreRoles are role IDs whose members never trigger backs.
+	IgnoreRoles []string
+}
+
+// editDedupWindow is how long a message that backed is remembered, so that editing it
+// doesn't back again. Edits after this are treated like new messages.
+const editDedupWindow = 24 * time.Hour
+
 type backHandler struct {
-	backfs      fs.FS
-	backs       BackMapping
-	lootActions backHandlerLootActions
+	backfs        fs.FS
+	backs         BackProvider
+	rarityWeights map[model.Rarity]int
+	pity          PityRules
+	selector      *backSelector
+	detector      *detect.Detector
+	lootActions   backHandlerLootActions
+	// beforeRollback runs before a rollback takes a user's loot, if set
+	beforeRollback func(userID loot.UserID)
+
+	policy MessagePolicy
+	// backed remembers the messages that have triggered a back, so editing one can't trigger another
+	backed *dedup[string]
+
+	stats *stats.Store
+	// wordOfTheDayBonus is the greenbacks awarded for backs in the language of the day
+	wordOfTheDayBonus int
+
+	cooldowns *cooldown.Limiter
+	// cooldownReaction is added to backs ignored due to a cooldown. If empty, they're ignored silently.
+	cooldownReaction string
+
+	guildSettings *settings.Store
+	// guildDetectors caches each guild's detector, rebuilt when its settings change
+	guildDetectorsMu sync.Mutex
+	guildDetectors   map[string]guildDetector
 }
 
-var _ MessageHandler = new(backHandler) // *backHandler implements MessageHandler
+type guildDetector struct {
+	detector *detect.Detector
+	revision int
+}
+
+var _ MessageHandler = new(backHandler)       // *backHandler implements MessageHandler
+var _ MessageUpdateHandler = new(backHandler) // *backHandler implements MessageUpdateHandler
 
 func NewBackHandler(backfs fs.FS, provider BackProvider) (*backHandler, error) {
 	return &backHandler{
-		backfs: backfs,
-		backs:  provider.Backs(),
+		backfs:        backfs,
+		backs:         provider,
+		rarityWeights: model.DefaultRarityWeights,
+		selector:      newBackSelector(Selection{Strategy: SelectUniform}),
+		detector:      detect.New(BackWords),
+		backed:        newDedup[string](editDedupWindow),
+		cooldowns:     cooldown.NewLimiter(cooldown.Limits{}),
 	}, nil
 }
 
+// SetRarityWeights overrides the default odds of rolling each rarity.
+func (b *backHandler) SetRarityWeights(weights map[model.Rarity]int) {
+	if weights != nil {
+		b.rarityWeights = weights
+	}
+}
+
+// SetMessagePolicy changes which messages can trigger backs. By default, every
+// message that isn't from the bot itself can.
+func (b *backHandler) SetMessagePolicy(policy MessagePolicy) {
+	b.policy = policy
+}
+
+// ignored reports whether the policy excludes a back from the member in the channel.
+func (b *backHandler) ignored(channelID string, member *discordgo.Member) bool {
+	if slices.Contains(b.policy.IgnoreChannels, channelID) {
+		return true
+	}
+	if member != nil {
+		for _, role := range member.Roles {
+			if slices.Contains(b.policy.IgnoreRoles, role) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ConnectStats counts the trigger words and languages of detected backs in store.
+func (b *backHandler) ConnectStats(store *stats.Store) {
+	b.stats = store
+}
+
+// SetWordOfTheDay awards bonus greenbacks for backs in the language of the day.
+// A bonus of zero turns the word of the day off.
+func (b *backHandler) SetWordOfTheDay(bonus int) {
+	b.wordOfTheDayBonus = bonus
+}
+
+// recordTrigger counts a back that played towards the guild's stats.
+func (b *backHandler) recordTrigger(logger *slog.Logger, guildID string, match detect.Match, languages []string) {
+	for _, language := range languages {
+		metrics.BacksByLanguage.With(language).Inc()
+	}
+
+	if b.stats != nil {
+		if err := b.stats.Record(guildID, match.Trigger, languages); err != nil {
+			logger.Error("failed to record back stats", logging.Err, err)
+		}
+	}
+}
+
+// SetCooldowns limits how often backs play. Backs during a cooldown are
+// acknowledged with reaction, or ignored if it's empty.
+func (b *backHandler) SetCooldowns(limiter *cooldown.Limiter, reaction string) {
+	b.cooldowns = limiter
+	b.cooldownReaction = reaction
+}
+
+// SetSelection changes how backs are picked once their rarity is rolled, for
+// guilds that haven't chosen for themselves.
+func (b *backHandler) SetSelection(defaults Selection) {
+	b.selector.defaults = defaults
+}
+
+// SetPity boosts the odds of rarities that users haven't rolled in a while.
+func (b *backHandler) SetPity(rules PityRules) {
+	b.pity = rules
+}
+
 func (b *backHandler) ConnectLootActions(la backHandlerLootActions) {
 	b.lootActions = la
 }
 
+// OnRollback runs hook before a rollback tier back takes the user's loot.
+func (b *backHandler) OnRollback(hook func(userID loot.UserID)) {
+	b.beforeRollback = hook
+}
+
+// ConnectGuildSettings makes each guild's custom trigger words, exclusions and
+// patterns apply on top of the built in BackWords, and lets guilds choose how
+// backs are selected.
+func (b *backHandler) ConnectGuildSettings(store *settings.Store) {
+	b.guildSettings = store
+	b.guildDetectors = make(map[string]guildDetector)
+	b.selector.settings = store
+}
+
+// detectorFor returns the detector for messages in the guild.
+func (b *backHandler) detectorFor(guildID string) *detect.Detector {
+	if b.guildSettings == nil || guildID == "" {
+		return b.detector
+	}
+
+	guild, revision := b.guildSettings.Get(guildID)
+	if revision == 0 {
+		return b.detector
+	}
+
+	b.guildDetectorsMu.Lock()
+	defer b.guildDetectorsMu.Unlock()
+
+	if cached, ok := b.guildDetectors[guildID]; ok && cached.revision == revision {
+		return cached.detector
+	}
+
+	rules := detect.Rules{
+		Triggers:   append(slices.Clone(BackWords), guild.Words...),
+		Exclusions: guild.Exclusions,
+	}
+	for _, expr := range guild.Patterns {
+		pattern, err := detect.CompilePattern(expr)
+		if err != nil {
+			// patterns are validated when they're added, so this only happens if the limits tighten
+			slog.Warn("skipping invalid guild pattern", slog.String(logging.GuildID, guildID), "pattern", expr, logging.Err, err)
+			continue
+		}
+		rules.Patterns = append(rules.Patterns, pattern)
+	}
+
+	detector := detect.Compile(rules)
+	b.guildDetectors[guildID] = guildDetector{detector: detector, revision: revision}
+	return detector
+}
+
 // Handle is added as a handler to the Discord bot's connection.
 // It'll be called whenever a message comes through on a channel that
 // the bot is monitoring.
 func (b *backHandler) Handle(s *discordgo.Session, m *discordgo.MessageCreate) (bool, error) {
-	fmt.Println("Message detected, checking for backs: ", m.Content)
+	return b.handleMessage(s, m)
+}
+
+// HandleUpdate is added as a handler to the Discord bot's connection, and is
+// called whenever a message is edited. Edits are only checked for backs if the
+// message policy allows it.
+func (b *backHandler) HandleUpdate(s *discordgo.Session, m *discordgo.MessageUpdate) (bool, error) {
+	if !b.policy.Edits {
+		return false, nil
+	}
+
+	// embeds being resolved also come through as updates, without an author or content
+	if m.Author == nil || m.Content == "" {
+		return false, nil
+	}
+	if m.BeforeUpdate != nil && m.BeforeUpdate.Content == m.Content {
+		return false, nil
+	}
+
+	return b.handleMessage(s, &discordgo.MessageCreate{Message: m.Message})
+}
+
+func (b *backHandler) handleMessage(s *discordgo.Session, m *discordgo.MessageCreate) (bool, error) {
+	logger := slog.With(logging.MessageAttrs(m.Message)...)
+	logger.Debug("message detected, checking for backs", "content", m.Content)
 
 	// Back Bot can't back itself
 	if m.Author.ID == s.State.User.ID {
 		return false, nil
 	}
 
+	// webhook messages have bot authors, so check for them first
+	switch {
+	case m.WebhookID != "":
+		if !b.policy.AllowWebhooks {
+			return false, nil
+		}
+	case m.Author.Bot:
+		if !b.policy.AllowBots {
+			return false, nil
+		}
+	}
+
+	if b.ignored(m.ChannelID, m.Member) {
+		return false, nil
+	}
+
 	// check if the message is a variation of "back"
-	for _, word := range BackWords {
-		if strings.Contains(strings.ToLower(m.Content), word) {
-			fmt.Println("BACK DETECTED, PLAYING BACK")
+	match, ok := b.detectorFor(m.GuildID).Detect(m.Content)
+	if !ok {
+		return false, nil
+	}
 
-			vs, err := retrieveVoiceStateForPlayback(s, m.Author.ID, m.ChannelID)
-			if err != nil {
-				return false, fmt.Errorf("BackHandler: error retrieving voice state for playback: %w", err)
-			}
+	if !b.backed.claim(m.ID, time.Now()) {
+		logger.Debug("message already backed")
+		return true, nil
+	}
 
-			if vs == nil {
-				fmt.Printf("detected back, but user was not found in voice channel. username: %v\n", m.Author.Username)
-				return true, nil
-			}
+	logger.Info("back detected, playing back", "trigger", match.Trigger)
+	metrics.BacksDetected.Inc()
 
-			err = b.Who(s, BackInfo{
-				VoiceState: vs,
-				Message:    m,
-				Back:       m.Author,
-			})
-			if err != nil {
-				err = fmt.Errorf("BackHandler: error playing sound: %w", err)
-			}
+	return b.back(s, logger, backRequest{
+		user:      m.Author,
+		guildID:   m.GuildID,
+		channelID: m.ChannelID,
+		messageID: m.ID,
+		message:   m,
+		match:     match,
+	})
+}
+
+// backRequest is a user backing in a text channel, by message or reaction.
+type backRequest struct {
+	user      *discordgo.User
+	guildID   string
+	channelID string
+	// messageID is the message the back came from, which is reacted to if it's ignored during a cooldown
+	messageID string
+	// message is set if the back was the message's content
+	message *discordgo.MessageCreate
+	// match is the word that triggered the back
+	match detect.Match
+	// reaction is set if the back came from reacting to the message
+	reaction bool
+}
+
+// languages are what the back counts towards in the stats and the word of the day.
+// Reactions are all ReactionLanguage, rather than the language of the 🔙 in a message.
+func (req backRequest) languages() []string {
+	if req.reaction {
+		return []string{ReactionLanguage}
+	}
+	return triggerLanguages(req.match)
+}
+
+// back plays a back for the user if they're in voice and not on cooldown.
+// It reports whether the back was handled, even if nothing played.
+func (b *backHandler) back(s *discordgo.Session, logger *slog.Logger, req backRequest) (bool, error) {
+	vs, err := retrieveVoiceStateForPlayback(s, req.user.ID, req.channelID)
+	if err != nil {
+		return false, fmt.Errorf("BackHandler: error retrieving voice state for playback: %w", err)
+	}
 
-			return true, err
+	if vs == nil {
+		logger.Info("detected back, but user was not found in voice channel", "username", req.user.Username)
+		return true, nil
+	}
+
+	languages := req.languages()
+	allowed, err := b.whoUnlessCoolingDown(s, logger, BackInfo{
+		VoiceState: vs,
+		Message:    req.message,
+		Back:       req.user,
+		Languages:  languages,
+	})
+	if err != nil {
+		return true, fmt.Errorf("BackHandler: error playing sound: %w", err)
+	}
+
+	// only backs that played count towards the stats
+	if allowed {
+		b.recordTrigger(logger, req.guildID, req.match, languages)
+	}
+
+	if !allowed && b.cooldownReaction != "" {
+		err = s.MessageReactionAdd(req.channelID, req.messageID, b.cooldownReaction)
+		if err != nil {
+			return true, fmt.Errorf("BackHandler: error reacting to back during cooldown: %w", err)
 		}
 	}
 
-	return false, nil
+	return true, nil
+}
+
+// whoUnlessCoolingDown plays a back with Who, unless the user or their guild is on
+// cooldown. It reports whether the back was allowed. Backs that fail to play don't
+// count towards the cooldowns.
+func (b *backHandler) whoUnlessCoolingDown(s *discordgo.Session, logger *slog.Logger, info BackInfo) (bool, error) {
+	ticket, status, ok := b.cooldowns.Allow(info.Back.ID, info.VoiceState.GuildID)
+	if !ok {
+		scope, wait, _ := status.Blocked()
+		logger.Info("back ignored during cooldown", "scope", scope, "wait", wait)
+		metrics.BacksOnCooldown.With(string(scope)).Inc()
+		return false, nil
+	}
+
+	if err := b.Who(s, info); err != nil {
+		b.cooldowns.Refund(ticket)
+		return true, err
+	}
+	return true, nil
 }
 
 func retrieveVoiceStateForPlayback(s *discordgo.Session, originatingUserID string, channelID string) (*discordgo.VoiceState, error) {
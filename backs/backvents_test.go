@@ -0,0 +1,164 @@
+package backs
+
+import (
+	"back-bot/backs/detect"
+	"back-bot/backs/stats"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// newTestMessageSession returns a session without any channels cached, so backs that
+// get as far as looking for the member's voice channel fail with an error.
+func newTestMessageSession() *discordgo.Session {
+	s := &discordgo.Session{State: discordgo.NewState()}
+	s.State.User = &discordgo.User{ID: "backbot"}
+	return s
+}
+
+// attempted reports whether handling a message went as far as trying to play a back.
+func attempted(handled bool, err error) bool {
+	return !handled && err != nil
+}
+
+func TestMessagePolicy(t *testing.T) {
+	message := func(content string, edit func(*discordgo.Message)) *discordgo.MessageCreate {
+		m := &discordgo.Message{
+			ID:        "message",
+			ChannelID: "channel",
+			GuildID:   "guild",
+			Content:   content,
+			Author:    &discordgo.User{ID: "alice"},
+		}
+		if edit != nil {
+			edit(m)
+		}
+		return &discordgo.MessageCreate{Message: m}
+	}
+	fromBot := func(m *discordgo.Message) { m.Author.Bot = true }
+	fromWebhook := func(m *discordgo.Message) { m.Author.Bot, m.WebhookID = true, "webhook" }
+
+	cases := []struct {
+		name     string
+		policy   MessagePolicy
+		message  *discordgo.MessageCreate
+		expected bool
+	}{
+		{name: "back", message: message("back", nil), expected: true},
+		{name: "not a back", message: message("hello", nil)},
+		{name: "the bot's own message", message: message("back", func(m *discordgo.Message) { m.Author.ID = "backbot" })},
+		{name: "bot", message: message("back", fromBot)},
+		{name: "allowed bot", policy: MessagePolicy{AllowBots: true}, message: message("back", fromBot), expected: true},
+		{name: "webhook", policy: MessagePolicy{AllowBots: true}, message: message("back", fromWebhook)},
+		{name: "allowed webhook", policy: MessagePolicy{AllowWebhooks: true}, message: message("back", fromWebhook), expected: true},
+		{name: "ignored channel", policy: MessagePolicy{IgnoreChannels: []string{"channel"}}, message: message("back", nil)},
+		{name: "other channel ignored", policy: MessagePolicy{IgnoreChannels: []string{"other"}}, message: message("back", nil), expected: true},
+		{name: "ignored role", policy: MessagePolicy{IgnoreRoles: []string{"muted"}}, message: message("back", func(m *discordgo.Message) {
+			m.Member = &discordgo.Member{Roles: []string{"regular", "muted"}}
+		})},
+		{name: "other role ignored", policy: MessagePolicy{IgnoreRoles: []string{"muted"}}, message: message("back", func(m *discordgo.Message) {
+			m.Member = &discordgo.Member{Roles: []string{"regular"}}
+		}), expected: true},
+	}
+
+	for _, tc := range cases {
+		b, _ := NewBackHandler(fstest.MapFS{}, nil)
+		b.SetMessagePolicy(tc.policy)
+
+		if actual := attempted(b.Handle(newTestMessageSession(), tc.message)); actual != tc.expected {
+			t.Errorf("%s: expected a back to be attempted to be %v", tc.name, tc.expected)
+		}
+	}
+}
+
+func TestEditsBackOnce(t *testing.T) {
+	s := newTestMessageSession()
+	author := &discordgo.User{ID: "alice"}
+	message := func(id, content string) *discordgo.Message {
+		return &discordgo.Message{ID: id, ChannelID: "channel", GuildID: "guild", Content: content, Author: author}
+	}
+	edit := func(id, before, after string) *discordgo.MessageUpdate {
+		return &discordgo.MessageUpdate{Message: message(id, after), BeforeUpdate: message(id, before)}
+	}
+
+	b, _ := NewBackHandler(fstest.MapFS{}, nil)
+	b.SetMessagePolicy(MessagePolicy{Edits: true})
+
+	if attempted(b.Handle(s, &discordgo.MessageCreate{Message: message("first", "hello")})) {
+		t.Fatal("expected a message without a back not to back")
+	}
+
+	events := []struct {
+		name     string
+		update   *discordgo.MessageUpdate
+		expected bool
+	}{
+		{name: "edit adding a back", update: edit("first", "hello", "hello, back"), expected: true},
+		{name: "second edit", update: edit("first", "hello, back", "hello, back!")},
+		{name: "edit to another message", update: edit("second", "hi", "back"), expected: true},
+		{name: "embeds resolving", update: &discordgo.MessageUpdate{Message: &discordgo.Message{ID: "third", ChannelID: "channel", GuildID: "guild"}}},
+		{name: "unchanged content", update: edit("fourth", "back", "back")},
+	}
+
+	for _, e := range events {
+		if actual := attempted(b.HandleUpdate(s, e.update)); actual != e.expected {
+			t.Errorf("%s: expected a back to be attempted to be %v", e.name, e.expected)
+		}
+	}
+
+	// a message that backed when it was sent can't back again by being edited
+	if !attempted(b.Handle(s, &discordgo.MessageCreate{Message: message("fifth", "back")})) {
+		t.Fatal("expected a new message to back")
+	}
+	if attempted(b.HandleUpdate(s, edit("fifth", "back", "back back"))) {
+		t.Error("expected an edit to a message that already backed not to back again")
+	}
+
+	b.SetMessagePolicy(MessagePolicy{})
+	if attempted(b.HandleUpdate(s, edit("sixth", "hi", "back"))) {
+		t.Error("expected edits to be ignored unless the policy allows them")
+	}
+}
+
+func TestUnplayedBacksArentCounted(t *testing.T) {
+	s := newTestMessageSession()
+	// the channel is cached, but alice isn't in voice
+	s.State.GuildAdd(&discordgo.Guild{ID: "guild", Channels: []*discordgo.Channel{{ID: "channel", GuildID: "guild"}}})
+
+	store, err := stats.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := NewBackHandler(fstest.MapFS{}, nil)
+	b.ConnectStats(store)
+
+	m := &discordgo.Message{ID: "message", ChannelID: "channel", GuildID: "guild", Content: "back", Author: &discordgo.User{ID: "alice"}}
+	if handled, err := b.Handle(s, &discordgo.MessageCreate{Message: m}); !handled || err != nil {
+		t.Fatalf("expected the back to be handled, got %v, %v", handled, err)
+	}
+
+	if counts := store.Guild("guild"); len(counts.Triggers) != 0 {
+		t.Fatalf("expected a back that didn't play not to be counted, got %+v", counts)
+	}
+}
+
+func TestBackRequestLanguages(t *testing.T) {
+	cases := []struct {
+		name     string
+		req      backRequest
+		expected []string
+	}{
+		{name: "built in word", req: backRequest{match: detect.Match{Trigger: "back"}}, expected: []string{"English"}},
+		{name: "emoji in a message", req: backRequest{match: detect.Match{Trigger: BackReaction}}, expected: []string{"Emoji"}},
+		{name: "reaction", req: backRequest{match: detect.Match{Trigger: BackReaction}, reaction: true}, expected: []string{ReactionLanguage}},
+		{name: "custom word", req: backRequest{match: detect.Match{Trigger: "wb"}}, expected: []string{CustomLanguage}},
+	}
+
+	for _, tc := range cases {
+		if actual := tc.req.languages(); !slices.Equal(actual, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package backs
+
+import (
+	"back-bot/backs/detect"
+	"back-bot/backs/settings"
+	"back-bot/logging"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	maxGuildWords      = 50
+	maxGuildWordLength = 100
+	maxGuildPatterns   = 10
+)
+
+func backWordsOption(name, description string, autocomplete bool) *discordgo.ApplicationCommandOption {
+	return &discordgo.ApplicationCommandOption{
+		Type:         discordgo.ApplicationCommandOptionString,
+		Name:         name,
+		Description:  description,
+		Required:     true,
+		Autocomplete: autocomplete,
+	}
+}
+
+var BackWordsCmd = &discordgo.ApplicationCommand{
+	Name:         "backwords",
+	Description:  "Manage the words that trigger backs in this server",
+	Type:         discordgo.ChatApplicationCommand,
+	DMPermission: &falseVar,
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "list",
+			Description: "List this server's custom trigger words, exclusions and patterns",
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "add",
+			Description: "Add a trigger word or phrase",
+			Options:     []*discordgo.ApplicationCommandOption{backWordsOption("word", "The word or phrase", false)},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "remove",
+			Description: "Remove a trigger word or phrase",
+			Options:     []*discordgo.ApplicationCommandOption{backWordsOption("word", "The word or phrase", true)},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "exclude",
+			Description: "Stop backs from triggering inside a word or phrase",
+			Options:     []*discordgo.ApplicationCommandOption{backWordsOption("word", "The word or phrase", false)},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "unexclude",
+			Description: "Remove an exclusion",
+			Options:     []*discordgo.ApplicationCommandOption{backWordsOption("word", "The word or phrase", true)},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "add-pattern",
+			Description: "Add a regular expression trigger, matched against the lower case message",
+			Options:     []*discordgo.ApplicationCommandOption{backWordsOption("pattern", "The regular expression, e.g. b+a+c+k+", false)},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "remove-pattern",
+			Description: "Remove a regular expression trigger",
+			Options:     []*discordgo.ApplicationCommandOption{backWordsOption("pattern", "The regular expression", true)},
+		},
+	},
+}
+
+// backWordsList is one of the lists in GuildSettings that /backwords edits.
+type backWordsList struct {
+	noun     string
+	max      int
+	get      func(*settings.GuildSettings) *[]string
+	validate func(string) error
+	// same reports whether two entries are equivalent
+	same func(a, b string) bool
+}
+
+func validateWord(word string) error {
+	if len(word) > maxGuildWordLength {
+		return fmt.Errorf("that's too long, keep it under %d characters", maxGuildWordLength)
+	}
+	if !detect.Matchable(word) {
+		return errors.New("that doesn't have anything in it to match")
+	}
+	return nil
+}
+
+func sameWord(a, b string) bool {
+	return detect.Normalize(a) == detect.Normalize(b)
+}
+
+var (
+	guildWords = backWordsList{
+		noun:     "trigger word",
+		max:      maxGuildWords,
+		get:      func(g *settings.GuildSettings) *[]string { return &g.Words },
+		validate: validateWord,
+		same:     sameWord,
+	}
+	guildExclusions = backWordsList{
+		noun:     "exclusion",
+		max:      maxGuildWords,
+		get:      func(g *settings.GuildSettings) *[]string { return &g.Exclusions },
+		validate: validateWord,
+		same:     sameWord,
+	}
+	guildPatterns = backWordsList{
+		noun: "pattern",
+		max:  maxGuildPatterns,
+		get:  func(g *settings.GuildSettings) *[]string { return &g.Patterns },
+		validate: func(expr string) error {
+			_, err := detect.CompilePattern(expr)
+			return err
+		},
+		same: func(a, b string) bool { return a == b },
+	}
+)
+
+// backWordsRefusal is returned from settings updates that were rejected, and is shown to the user.
+type backWordsRefusal string
+
+func (r backWordsRefusal) Error() string {
+	return string(r)
+}
+
+type backWordsCmdHandler struct {
+	settings   *settings.Store
+	adminRoles []string
+}
+
+func NewBackWordsCmdHandler(store *settings.Store, adminRoles []string) *backWordsCmdHandler {
+	return &backWordsCmdHandler{
+		settings:   store,
+		adminRoles: adminRoles,
+	}
+}
+
+func (b *backWordsCmdHandler) BackWords(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	subcommand := i.ApplicationCommandData().Options[0]
+
+	if subcommand.Name == "list" {
+		b.list(s, i)
+		return
+	}
+
+	if !isAdmin(i, b.adminRoles) {
+		respond(s, i, "Only server admins can change the back words. Back off!", true)
+		return
+	}
+
+	value := strings.TrimSpace(subcommand.Options[0].StringValue())
+
+	switch subcommand.Name {
+	case "add":
+		b.add(s, i, guildWords, value)
+	case "remove":
+		b.remove(s, i, guildWords, value)
+	case "exclude":
+		b.add(s, i, guildExclusions, value)
+	case "unexclude":
+		b.remove(s, i, guildExclusions, value)
+	case "add-pattern":
+		b.add(s, i, guildPatterns, value)
+	case "remove-pattern":
+		b.remove(s, i, guildPatterns, value)
+	}
+}
+
+func (b *backWordsCmdHandler) list(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	guild, _ := b.settings.Get(i.GuildID)
+
+	var content strings.Builder
+	w := func(label string, entries []string) {
+		if len(entries) == 0 {
+			fmt.Fprintf(&content, "**%s:** none\n", label)
+			return
+		}
+		fmt.Fprintf(&content, "**%s:** `%s`\n", label, strings.Join(entries, "`, `"))
+	}
+
+	fmt.Fprintf(&content, "This server uses the %d built in back words, plus:\n", len(BackWords))
+	w("Trigger words", guild.Words)
+	w("Exclusions", guild.Exclusions)
+	w("Patterns", guild.Patterns)
+
+	respond(s, i, content.String(), true)
+}
+
+func (b *backWordsCmdHandler) add(s *discordgo.Session, i *discordgo.InteractionCreate, list backWordsList, value string) {
+	if err := list.validate(value); err != nil {
+		respond(s, i, fmt.Sprintf("Can't add that %s: %v", list.noun, err), true)
+		return
+	}
+
+	err := b.settings.Update(i.GuildID, func(g *settings.GuildSettings) error {
+		entries := list.get(g)
+		if slices.ContainsFunc(*entries, func(e string) bool { return list.same(e, value) }) {
+			return backWordsRefusal(fmt.Sprintf("`%s` is already a %s here", value, list.noun))
+		}
+		if len(*entries) >= list.max {
+			return backWordsRefusal(fmt.Sprintf("this server already has the maximum of %d %ss", list.max, list.noun))
+		}
+		*entries = append(*entries, value)
+		return nil
+	})
+	if err != nil {
+		b.respondUpdateError(s, i, err)
+		return
+	}
+
+	slog.Info("added guild back word", append(logging.InteractionAttrs(i), "list", list.noun, "value", value)...)
+	respond(s, i, fmt.Sprintf("Added %s `%s`.", list.noun, value), true)
+}
+
+func (b *backWordsCmdHandler) remove(s *discordgo.Session, i *discordgo.InteractionCreate, list backWordsList, value string) {
+	err := b.settings.Update(i.GuildID, func(g *settings.GuildSettings) error {
+		entries := list.get(g)
+		index := slices.IndexFunc(*entries, func(e string) bool { return list.same(e, value) })
+		if index < 0 {
+			return backWordsRefusal(fmt.Sprintf("`%s` isn't a %s here", value, list.noun))
+		}
+		*entries = slices.Delete(*entries, index, index+1)
+		return nil
+	})
+	if err != nil {
+		b.respondUpdateError(s, i, err)
+		return
+	}
+
+	slog.Info("removed guild back word", append(logging.InteractionAttrs(i), "list", list.noun, "value", value)...)
+	respond(s, i, fmt.Sprintf("Removed %s `%s`.", list.noun, value), true)
+}
+
+// respondUpdateError tells the user why their change was refused, or that it failed to save.
+func (b *backWordsCmdHandler) respondUpdateError(s *discordgo.Session, i *discordgo.InteractionCreate, err error) {
+	var refused backWordsRefusal
+	if errors.As(err, &refused) {
+		respond(s, i, refused.Error(), true)
+		return
+	}
+
+	slog.Error("failed to update guild settings", append(logging.InteractionAttrs(i), logging.Err, err)...)
+	respond(s, i, "Something went wrong saving that. Try again later.", true)
+}
+
+// BackWordsAutocomplete suggests existing entries for the remove subcommands.
+func (b *backWordsCmdHandler) BackWordsAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	subcommand := i.ApplicationCommandData().Options[0]
+	input := strings.ToLower(subcommand.Options[0].StringValue())
+
+	guild, _ := b.settings.Get(i.GuildID)
+
+	var entries []string
+	switch subcommand.Name {
+	case "remove":
+		entries = guild.Words
+	case "unexclude":
+		entries = guild.Exclusions
+	case "remove-pattern":
+		entries = guild.Patterns
+	}
+
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for _, entry := range entries {
+		if strings.Contains(strings.ToLower(entry), input) && len(choices) < maxChoices {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: entry, Value: entry})
+		}
+	}
+
+	respondChoices(s, i, choices)
+}
@@ -0,0 +1,523 @@
+package backs
+
+import (
+	"back-bot/backs/cooldown"
+	"back-bot/backs/loot"
+	"back-bot/backs/model"
+	"back-bot/logging"
+	"back-bot/metrics"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var BacksCmd = &discordgo.ApplicationCommand{
+	Name:         "backs",
+	Description:  "Browse every back there is to collect",
+	Type:         discordgo.ChatApplicationCommand,
+	DMPermission: &falseVar,
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:         discordgo.ApplicationCommandOptionString,
+			Name:         "rarity",
+			Description:  "Only show backs of this rarity",
+			Autocomplete: true,
+		},
+		{
+			Type:         discordgo.ApplicationCommandOptionString,
+			Name:         "tag",
+			Description:  "Only show backs with this tag",
+			Autocomplete: true,
+		},
+	},
+}
+
+const (
+	catalogPageSize = 15
+	// frameDuration is how much audio each opus frame in a dca file holds.
+	frameDuration = 20 * time.Millisecond
+	// previewLength is how much of a back a preview plays.
+	previewLength = 5 * time.Second
+	// previewCooldown is how long each user waits between previews.
+	previewCooldown = 30 * time.Second
+	// membershipTTL is how long a looked up guild membership is trusted.
+	membershipTTL = time.Hour
+)
+
+type catalogCmdHandler struct {
+	lootBag  loot.LootBag
+	backfs   fs.FS
+	provider BackProvider
+	previews *cooldown.Limiter
+
+	// durations caches how long each back is, which means reading the whole file
+	durationsMu sync.Mutex
+	durations   map[model.Back]time.Duration
+
+	// members caches whether owners the bot hasn't seen are members of each guild
+	membersMu sync.Mutex
+	members   map[memberKey]membership
+}
+
+type memberKey struct {
+	guildID string
+	userID  string
+}
+
+type membership struct {
+	member  bool
+	checked time.Time
+}
+
+func NewCatalogCmdHandler(lb loot.LootBag, backfs fs.FS, provider BackProvider) *catalogCmdHandler {
+	return &catalogCmdHandler{
+		lootBag:   lb,
+		backfs:    backfs,
+		provider:  provider,
+		previews:  cooldown.NewLimiter(cooldown.Limits{PerUser: previewCooldown}),
+		durations: make(map[model.Back]time.Duration),
+		members:   make(map[memberKey]membership),
+	}
+}
+
+// catalogFilter narrows the catalog. Zero fields match every back.
+type catalogFilter struct {
+	rarity model.Rarity
+	tag    string
+}
+
+// catalogFilterFor resolves the rarity and tag named in /backs to a filter. If either
+// isn't in the catalog, it returns a message for the user saying so instead.
+func (c *catalogCmdHandler) catalogFilterFor(rarity, tag string, now time.Time) (catalogFilter, string) {
+	var filter catalogFilter
+	if rarity != "" {
+		i := slices.IndexFunc(model.Rarities, func(r model.Rarity) bool { return strings.EqualFold(r.String(), rarity) })
+		if i < 0 {
+			return catalogFilter{}, fmt.Sprintf("There's no %q rarity. Pick one from the suggestions.", rarity)
+		}
+		filter.rarity = model.Rarities[i]
+	}
+	if tag != "" {
+		tags := c.tags(now)
+		i := slices.IndexFunc(tags, func(t string) bool { return strings.EqualFold(t, tag) })
+		if i < 0 {
+			return catalogFilter{}, fmt.Sprintf("No backs are tagged %q. Pick a tag from the suggestions.", tag)
+		}
+		filter.tag = tags[i]
+	}
+	return filter, ""
+}
+
+// componentID is the filter as it's kept in the custom IDs of the catalog's buttons,
+// which Discord caps at 100 characters. Tags are free text, so they're kept by shortID.
+func (f catalogFilter) componentID() string {
+	var tag string
+	if f.tag != "" {
+		tag = shortID(f.tag)
+	}
+	return fmt.Sprintf("%d:%s", f.rarity, tag)
+}
+
+// catalogFilterFromComponent resolves the filter kept by componentID.
+func (c *catalogCmdHandler) catalogFilterFromComponent(rarityID, tagID string, now time.Time) (catalogFilter, bool) {
+	var filter catalogFilter
+	rarity, err := strconv.Atoi(rarityID)
+	if err != nil {
+		return catalogFilter{}, false
+	}
+	if rarity != 0 {
+		filter.rarity = model.Rarity(rarity)
+		if !slices.Contains(model.Rarities, filter.rarity) {
+			return catalogFilter{}, false
+		}
+	}
+	if tagID != "" {
+		tags := c.tags(now)
+		i := slices.IndexFunc(tags, func(t string) bool { return shortID(t) == tagID })
+		if i < 0 {
+			return catalogFilter{}, false
+		}
+		filter.tag = tags[i]
+	}
+	return filter, true
+}
+
+// shortID identifies free text, like a tag or a back's path, in component custom IDs
+// and values, which Discord caps at 100 characters.
+func shortID(s string) string {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return strconv.FormatUint(h.Sum64(), 36)
+}
+
+// catalog lists the backs that can currently be rolled and pass filter, rarest first.
+func (c *catalogCmdHandler) catalog(filter catalogFilter, now time.Time) []model.Back {
+	active := c.provider.ActiveBacks(now)
+
+	var backs []model.Back
+	for _, rarity := range model.Rarities {
+		if filter.rarity != 0 && rarity != filter.rarity {
+			continue
+		}
+
+		var ofRarity []model.Back
+		for _, back := range active[rarity] {
+			// boosted event backs appear more than once
+			if slices.Contains(ofRarity, back) {
+				continue
+			}
+			if filter.tag != "" && !slices.ContainsFunc(c.provider.Tags(back), func(t string) bool { return strings.EqualFold(t, filter.tag) }) {
+				continue
+			}
+			ofRarity = append(ofRarity, back)
+		}
+		slices.SortFunc(ofRarity, func(a, b model.Back) int {
+			return strings.Compare(c.provider.DisplayName(a), c.provider.DisplayName(b))
+		})
+		backs = append(backs, ofRarity...)
+	}
+	return backs
+}
+
+func (c *catalogCmdHandler) Backs(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	metrics.CommandInvocations.With(BacksCmd.Name).Inc()
+
+	var rarity, tag string
+	for _, option := range i.ApplicationCommandData().Options {
+		switch option.Name {
+		case "rarity":
+			rarity = option.StringValue()
+		case "tag":
+			tag = option.StringValue()
+		}
+	}
+
+	filter, problem := c.catalogFilterFor(rarity, tag, time.Now())
+	if problem != "" {
+		respond(s, i, problem, true)
+		return
+	}
+
+	c.respondCatalog(s, i, discordgo.InteractionResponseChannelMessageWithSource, filter, 0)
+}
+
+// BacksPage turns to another page of the catalog, from its buttons.
+func (c *catalogCmdHandler) BacksPage(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	// custom IDs look like "backs:page:<page>:<rarity>:<tag ID>"
+	segments := strings.Split(i.MessageComponentData().CustomID, ":")
+	if len(segments) != 5 {
+		slog.Error("malformed catalog page button", logging.InteractionAttrs(i)...)
+		return
+	}
+	page, err := strconv.Atoi(segments[2])
+	if err != nil {
+		slog.Error("malformed catalog page button", append(logging.InteractionAttrs(i), logging.Err, err)...)
+		return
+	}
+
+	filter, ok := c.catalogFilterFromComponent(segments[3], segments[4], time.Now())
+	if !ok {
+		respond(s, i, "That rarity or tag isn't in the catalog anymore. Try /backs again.", true)
+		return
+	}
+
+	c.respondCatalog(s, i, discordgo.InteractionResponseUpdateMessage, filter, page)
+}
+
+func (c *catalogCmdHandler) respondCatalog(s *discordgo.Session, i *discordgo.InteractionCreate, responseType discordgo.InteractionResponseType, filter catalogFilter, page int) {
+	backs := c.catalog(filter, time.Now())
+
+	resp := &discordgo.InteractionResponse{
+		Type: responseType,
+		Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+	}
+
+	if len(backs) == 0 {
+		resp.Data.Content = "No backs match that. Try another rarity or tag."
+		resp.Data.Embeds = []*discordgo.MessageEmbed{}
+		resp.Data.Components = []discordgo.MessageComponent{}
+	} else {
+		pages := (len(backs) + catalogPageSize - 1) / catalogPageSize
+		page = max(min(page, pages-1), 0)
+		onPage := backs[page*catalogPageSize : min((page+1)*catalogPageSize, len(backs))]
+
+		resp.Data.Content = ""
+		resp.Data.Embeds = []*discordgo.MessageEmbed{c.catalogEmbed(s, i.GuildID, filter, onPage, page, pages, len(backs))}
+		resp.Data.Components = c.catalogComponents(filter, onPage, page, pages)
+	}
+
+	err := s.InteractionRespond(i.Interaction, resp)
+	if err != nil {
+		slog.Error("error responding to /backs command", append(logging.InteractionAttrs(i), logging.Err, err)...)
+	}
+}
+
+func (c *catalogCmdHandler) catalogEmbed(s *discordgo.Session, guildID string, filter catalogFilter, backs []model.Back, page, pages, total int) *discordgo.MessageEmbed {
+	title := "Backs"
+	var color int
+	if filter.rarity != 0 {
+		title = fmt.Sprintf("%s %s backs", filter.rarity.Tier().Emoji, filter.rarity)
+		color = filter.rarity.Tier().Color
+	}
+	if filter.tag != "" {
+		title += fmt.Sprintf(" tagged %q", filter.tag)
+	}
+
+	rows := make([][4]string, 0, len(backs))
+	for _, back := range backs {
+		rows = append(rows, [4]string{
+			truncate(c.provider.DisplayName(back), maxBackpackNameLength),
+			back.Rarity().String(),
+			formatDuration(c.duration(back)),
+			fmt.Sprintf("%d own", c.guildOwners(s, guildID, back, time.Now())),
+		})
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:       title,
+		Color:       color,
+		Description: alignedColumns(rows),
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("Page %d of %d · %d backs", page+1, pages, total),
+		},
+	}
+}
+
+// catalogComponents are a menu to preview the backs on the page, and buttons to turn it.
+func (c *catalogCmdHandler) catalogComponents(filter catalogFilter, backs []model.Back, page, pages int) []discordgo.MessageComponent {
+	options := make([]discordgo.SelectMenuOption, 0, len(backs))
+	for _, back := range backs {
+		options = append(options, discordgo.SelectMenuOption{
+			Label:       truncate(c.provider.DisplayName(back), 100),
+			Value:       shortID(back.Path()),
+			Description: back.Rarity().String(),
+		})
+	}
+
+	components := []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.SelectMenu{
+				MenuType:    discordgo.StringSelectMenu,
+				CustomID:    BacksCmd.Name + ":preview",
+				Placeholder: fmt.Sprintf("Preview a back in your voice channel (%s)", previewLength),
+				Options:     options,
+			},
+		}},
+	}
+
+	if pages > 1 {
+		button := func(label string, to int, disabled bool) discordgo.Button {
+			return discordgo.Button{
+				Label:    label,
+				Style:    discordgo.SecondaryButton,
+				CustomID: fmt.Sprintf("%s:page:%d:%s", BacksCmd.Name, to, filter.componentID()),
+				Disabled: disabled,
+			}
+		}
+		components = append(components, discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			button("◀ Previous", page-1, page == 0),
+			button("Next ▶", page+1, page == pages-1),
+		}})
+	}
+	return components
+}
+
+// guildOwners counts the guild's members with back in their backpack.
+func (c *catalogCmdHandler) guildOwners(s *discordgo.Session, guildID string, back model.Back, now time.Time) int {
+	var owners int
+	for _, userID := range c.lootBag.Owners(back) {
+		if c.isMember(s, guildID, string(userID), now) {
+			owners++
+		}
+	}
+	return owners
+}
+
+// isMember reports whether the user is a member of the guild. Members the bot hasn't
+// cached are looked up, and the answer is remembered for membershipTTL.
+func (c *catalogCmdHandler) isMember(s *discordgo.Session, guildID, userID string, now time.Time) bool {
+	if _, err := s.State.Member(guildID, userID); err == nil {
+		return true
+	}
+
+	key := memberKey{guildID: guildID, userID: userID}
+	c.membersMu.Lock()
+	known, ok := c.members[key]
+	c.membersMu.Unlock()
+	if ok && now.Sub(known.checked) < membershipTTL {
+		return known.member
+	}
+
+	_, err := s.GuildMember(guildID, userID)
+	var restErr *discordgo.RESTError
+	notMember := errors.As(err, &restErr) && restErr.Response != nil && restErr.Response.StatusCode == http.StatusNotFound
+	if err != nil && !notMember {
+		slog.Warn("failed to look up a guild member for the catalog", logging.GuildID, guildID, logging.UserID, userID, logging.Err, err)
+		return false
+	}
+
+	c.membersMu.Lock()
+	defer c.membersMu.Unlock()
+	for k, m := range c.members {
+		if now.Sub(m.checked) >= membershipTTL {
+			delete(c.members, k)
+		}
+	}
+	c.members[key] = membership{member: err == nil, checked: now}
+	return err == nil
+}
+
+// duration is how long the back plays for, or zero if it can't be read.
+func (c *catalogCmdHandler) duration(back model.Back) time.Duration {
+	c.durationsMu.Lock()
+	defer c.durationsMu.Unlock()
+
+	if d, ok := c.durations[back]; ok {
+		return d
+	}
+
+	frames, err := loadBack(c.backfs, back.Path())
+	if err != nil {
+		return 0
+	}
+	c.durations[back] = time.Duration(len(frames)) * frameDuration
+	return c.durations[back]
+}
+
+// BacksPreview plays the start of the back chosen from the catalog's menu, without awarding any loot.
+func (c *catalogCmdHandler) BacksPreview(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	logger := slog.With(logging.InteractionAttrs(i)...)
+	user := interactionUser(i)
+
+	values := i.MessageComponentData().Values
+	if len(values) != 1 {
+		return
+	}
+	// menu options are keyed by the shortID of each back's path
+	catalog := c.catalog(catalogFilter{}, time.Now())
+	n := slices.IndexFunc(catalog, func(b model.Back) bool { return shortID(b.Path()) == values[0] })
+	if n < 0 {
+		respond(s, i, "That back isn't in the catalog anymore.", true)
+		return
+	}
+	back := catalog[n]
+	logger = logger.With(slog.String(logging.BackPath, back.Path()))
+
+	vs, err := retrieveVoiceStateForPlayback(s, user.ID, i.ChannelID)
+	if err != nil {
+		logger.Error("failed to retrieve voice state for back preview", logging.Err, err)
+		respond(s, i, "Something went wrong finding your voice channel. Try again later.", true)
+		return
+	}
+	if vs == nil {
+		respond(s, i, "Join a voice channel to hear a preview.", true)
+		return
+	}
+
+	if _, status, ok := c.previews.Allow(user.ID, i.GuildID); !ok {
+		respond(s, i, fmt.Sprintf("You can preview another back in %s.", formatWait(status.User)), true)
+		return
+	}
+
+	frames, err := loadBack(c.backfs, back.Path())
+	if err != nil {
+		logger.Error("failed to load back data for preview", logging.Err, err)
+		respond(s, i, "Something went wrong loading that back. Try again later.", true)
+		return
+	}
+	frames = frames[:min(len(frames), int(previewLength/frameDuration))]
+
+	respond(s, i, fmt.Sprintf("Previewing %s...", c.provider.DisplayName(back)), true)
+
+	err = playBack(s, BackInfo{VoiceState: vs, Back: user}, frames)
+	if err != nil {
+		logger.Error("failed to play back preview", logging.Err, err)
+	}
+}
+
+// BacksAutocomplete suggests rarities and tags for /backs.
+func (c *catalogCmdHandler) BacksAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	var focused *discordgo.ApplicationCommandInteractionDataOption
+	for _, option := range i.ApplicationCommandData().Options {
+		if option.Focused {
+			focused = option
+		}
+	}
+	if focused == nil {
+		return
+	}
+	input := strings.ToLower(focused.StringValue())
+
+	var candidates []string
+	switch focused.Name {
+	case "rarity":
+		for _, rarity := range model.Rarities {
+			candidates = append(candidates, rarity.String())
+		}
+	case "tag":
+		candidates = c.tags(time.Now())
+	}
+
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for _, candidate := range candidates {
+		if strings.Contains(strings.ToLower(candidate), input) && len(choices) < maxChoices {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: candidate, Value: candidate})
+		}
+	}
+	respondChoices(s, i, choices)
+}
+
+// tags lists the tags of the backs in the catalog, in order.
+func (c *catalogCmdHandler) tags(now time.Time) []string {
+	var tags []string
+	for _, back := range c.catalog(catalogFilter{}, now) {
+		for _, tag := range c.provider.Tags(back) {
+			if !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	slices.Sort(tags)
+	return tags
+}
+
+// alignedColumns lays rows out in a code block, padding each column to line up.
+func alignedColumns(rows [][4]string) string {
+	var widths [4]int
+	for _, row := range rows {
+		for n, cell := range row {
+			widths[n] = max(widths[n], utf8.RuneCountInString(cell))
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("```\n")
+	for _, row := range rows {
+		for n, cell := range row {
+			b.WriteString(cell)
+			if n < len(row)-1 {
+				b.WriteString(strings.Repeat(" ", widths[n]-utf8.RuneCountInString(cell)+2))
+			}
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("```")
+	return b.String()
+}
+
+// formatDuration writes d like a track length, e.g. "0:03".
+func formatDuration(d time.Duration) string {
+	seconds := int(d.Round(time.Second).Seconds())
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
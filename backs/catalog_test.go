@@ -0,0 +1,154 @@
+package backs
+
+import (
+	"back-bot/backs/loot"
+	"back-bot/backs/model"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestCatalog(t *testing.T) {
+	backfs := fstest.MapFS{
+		"Common/hello_back.dca":                 {},
+		"Common/alright.dca":                    {},
+		"Rare/welcome_back.dca":                 {},
+		"Events/Halloween/Rare/spooky_back.dca": {},
+		MetadataFile:                            {Data: []byte(`{"Common/alright.dca": {"name": "Alright!", "tags": ["Drew"]}}`)},
+	}
+	start := time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC)
+	provider := NewBackProvider(backfs, Event{Name: "Halloween", Start: start, End: start.AddDate(0, 1, 0), Boost: 3})
+	c := NewCatalogCmdHandler(nil, backfs, provider)
+
+	names := func(backs []model.Back) []string {
+		var out []string
+		for _, back := range backs {
+			out = append(out, provider.DisplayName(back))
+		}
+		return out
+	}
+
+	cases := []struct {
+		name     string
+		filter   catalogFilter
+		now      time.Time
+		expected []string
+	}{
+		{name: "everything, rarest first", now: start.AddDate(1, 0, 0), expected: []string{"welcome_back", "Alright!", "hello_back"}},
+		{name: "event backs once each", now: start, expected: []string{"spooky_back", "welcome_back", "Alright!", "hello_back"}},
+		{name: "by rarity", filter: catalogFilter{rarity: model.Common}, now: start, expected: []string{"Alright!", "hello_back"}},
+		{name: "by tag", filter: catalogFilter{tag: "drew"}, now: start, expected: []string{"Alright!"}},
+		{name: "by event tag", filter: catalogFilter{tag: "Halloween"}, now: start, expected: []string{"spooky_back"}},
+		{name: "no matches", filter: catalogFilter{rarity: model.Rollback}, now: start},
+	}
+
+	for _, tc := range cases {
+		if actual := names(c.catalog(tc.filter, tc.now)); !slices.Equal(actual, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, actual)
+		}
+	}
+
+	filter, problem := c.catalogFilterFor("common", "DREW", start)
+	if problem != "" || filter != (catalogFilter{rarity: model.Common, tag: "Drew"}) {
+		t.Errorf("expected filters to resolve to the catalog's rarities and tags, got %+v, %q", filter, problem)
+	}
+	if _, problem := c.catalogFilterFor("Legendary", "", start); problem == "" {
+		t.Error("expected an unknown rarity to be refused")
+	}
+	if _, problem := c.catalogFilterFor("", strings.Repeat("long tag ", 20), start); problem == "" {
+		t.Error("expected an unknown tag to be refused")
+	}
+
+	// filters survive being kept in a page button's custom ID, within Discord's limit
+	filter = catalogFilter{rarity: model.Rare, tag: "Halloween"}
+	customID := fmt.Sprintf("%s:page:%d:%s", BacksCmd.Name, 12, filter.componentID())
+	segments := strings.Split(customID, ":")
+	if len(customID) > 100 || len(segments) != 5 {
+		t.Fatalf("unexpected custom ID %q", customID)
+	}
+	if actual, ok := c.catalogFilterFromComponent(segments[3], segments[4], start); !ok || actual != filter {
+		t.Errorf("expected %+v back from the custom ID, got %+v", filter, actual)
+	}
+	if _, ok := c.catalogFilterFromComponent(segments[3], segments[4], start.AddDate(1, 0, 0)); ok {
+		t.Error("expected the event's tag to be gone once the event is over")
+	}
+	if actual, ok := c.catalogFilterFromComponent("0", "", start); !ok || actual != (catalogFilter{}) {
+		t.Errorf("expected an empty filter, got %+v", actual)
+	}
+
+	columns := alignedColumns([][4]string{{"a", "Rare", "0:03", "1 own"}, {"longer", "Common", "1:20", "12 own"}})
+	if expected := "```\na       Rare    0:03  1 own\nlonger  Common  1:20  12 own\n```"; columns != expected {
+		t.Errorf("expected aligned columns, got:\n%s", columns)
+	}
+	if d := formatDuration(83*time.Second + 600*time.Millisecond); d != "1:24" {
+		t.Errorf("expected 1:24, got %s", d)
+	}
+}
+
+// memberLookups answers guild member lookups for the members it's given, and 404s
+// for everyone else, counting the lookups.
+type memberLookups struct {
+	members []string
+	lookups int
+}
+
+func (m *memberLookups) RoundTrip(req *http.Request) (*http.Response, error) {
+	m.lookups++
+	userID := req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]
+
+	status, body := http.StatusNotFound, `{"message": "Unknown Member", "code": 10007}`
+	if slices.Contains(m.members, userID) {
+		status, body = http.StatusOK, fmt.Sprintf(`{"user": {"id": %q}}`, userID)
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func TestGuildOwners(t *testing.T) {
+	back, _ := model.GetBack("Rare/welcome_back.dca")
+	lootBag, err := loot.NewCsvLootBag(filepath.Join(t.TempDir(), "loot.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, userID := range []loot.UserID{"parkour", "bigback", "elsewhere"} {
+		lootBag.AddLoot(userID, back)
+	}
+	c := NewCatalogCmdHandler(lootBag, fstest.MapFS{}, NewBackProvider(fstest.MapFS{}))
+
+	// parkour is cached, bigback has to be looked up, and elsewhere isn't a member
+	lookups := &memberLookups{members: []string{"bigback"}}
+	s, _ := discordgo.New("Bot token")
+	s.Client = &http.Client{Transport: lookups}
+	s.State.GuildAdd(&discordgo.Guild{ID: "guild"})
+	s.State.MemberAdd(&discordgo.Member{GuildID: "guild", User: &discordgo.User{ID: "parkour"}})
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	if owners := c.guildOwners(s, "guild", back, now); owners != 2 {
+		t.Errorf("expected the guild's two owners to be counted, got %d", owners)
+	}
+	if lookups.lookups != 2 {
+		t.Errorf("expected owners that aren't cached to be looked up, got %d lookups", lookups.lookups)
+	}
+
+	if owners := c.guildOwners(s, "guild", back, now.Add(time.Minute)); owners != 2 || lookups.lookups != 2 {
+		t.Errorf("expected lookups to be remembered, got %d owners after %d lookups", owners, lookups.lookups)
+	}
+	if c.guildOwners(s, "guild", back, now.Add(membershipTTL)); lookups.lookups != 4 {
+		t.Errorf("expected lookups to be repeated after membershipTTL, got %d lookups", lookups.lookups)
+	}
+	if owners := c.guildOwners(s, "other", back, now); owners != 1 {
+		t.Errorf("expected only members of the other guild to be counted, got %d", owners)
+	}
+}
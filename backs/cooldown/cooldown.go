@@ -0,0 +1,174 @@
+// Package cooldown rate limits chat backs per user, per guild and globally.
+package cooldown
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// Limits configures a Limiter. Zero values disable the corresponding limit.
+type Limits struct {
+	PerUser  time.Duration
+	PerGuild time.Duration
+	// GlobalPerMinute is the most backs allowed across every guild in any one minute.
+	GlobalPerMinute int
+}
+
+// Scope identifies which limit a back ran into.
+type Scope string
+
+const (
+	User   Scope = "user"
+	Guild  Scope = "guild"
+	Global Scope = "global"
+)
+
+// Status describes how long until each limit allows another back. A zero
+// duration means that limit currently allows one.
+type Status struct {
+	User   time.Duration
+	Guild  time.Duration
+	Global time.Duration
+	// GlobalRemaining is how many more backs the global limit allows right now,
+	// or -1 if there is no global limit.
+	GlobalRemaining int
+}
+
+// Blocked returns the scope with the longest wait, or false if nothing is blocking.
+func (s Status) Blocked() (Scope, time.Duration, bool) {
+	var scope Scope
+	var wait time.Duration
+	for _, limit := range []struct {
+		scope Scope
+		wait  time.Duration
+	}{{User, s.User}, {Guild, s.Guild}, {Global, s.Global}} {
+		if limit.wait > wait {
+			scope, wait = limit.scope, limit.wait
+		}
+	}
+	return scope, wait, wait > 0
+}
+
+// Limiter tracks when backs happened, to decide whether another is allowed.
+type Limiter struct {
+	limits Limits
+	now    func() time.Time
+
+	mu     sync.Mutex
+	users  map[string]time.Time
+	guilds map[string]time.Time
+	// global holds the times of backs in the last minute, oldest first
+	global []time.Time
+}
+
+func NewLimiter(limits Limits) *Limiter {
+	return &Limiter{
+		limits: limits,
+		now:    time.Now,
+		users:  make(map[string]time.Time),
+		guilds: make(map[string]time.Time),
+	}
+}
+
+// SetClock replaces the limiter's source of the current time.
+func (l *Limiter) SetClock(now func() time.Time) {
+	l.now = now
+}
+
+// Status reports the limits currently applying to the user in the guild.
+func (l *Limiter) Status(userID, guildID string) Status {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.status(userID, guildID, l.now())
+}
+
+// Ticket is a back that Allow recorded. If it doesn't end up playing, Refund it.
+type Ticket struct {
+	userID  string
+	guildID string
+	at      time.Time
+}
+
+// Allow reports whether the user may back in the guild now, recording the back if so.
+// If not, the returned Status says which limits are in the way.
+func (l *Limiter) Allow(userID, guildID string) (Ticket, Status, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	status := l.status(userID, guildID, now)
+	if _, _, blocked := status.Blocked(); blocked {
+		return Ticket{}, status, false
+	}
+
+	if l.limits.PerUser > 0 {
+		l.users[userID] = now
+	}
+	if l.limits.PerGuild > 0 {
+		l.guilds[guildID] = now
+	}
+	if l.limits.GlobalPerMinute > 0 {
+		l.global = append(l.global, now)
+	}
+
+	return Ticket{userID: userID, guildID: guildID, at: now}, status, true
+}
+
+// Refund forgets the back recorded by Allow, so it doesn't count towards any limit.
+// Limits that have recorded a newer back since are left alone.
+func (l *Limiter) Refund(ticket Ticket) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if at, ok := l.users[ticket.userID]; ok && at.Equal(ticket.at) {
+		delete(l.users, ticket.userID)
+	}
+	if at, ok := l.guilds[ticket.guildID]; ok && at.Equal(ticket.at) {
+		delete(l.guilds, ticket.guildID)
+	}
+	if i := slices.IndexFunc(l.global, ticket.at.Equal); i >= 0 {
+		l.global = slices.Delete(l.global, i, i+1)
+	}
+}
+
+// status computes the limits at now, pruning state that has expired. Callers must hold l.mu.
+func (l *Limiter) status(userID, guildID string, now time.Time) Status {
+	status := Status{GlobalRemaining: -1}
+
+	remaining := func(entries map[string]time.Time, key string, cooldown time.Duration) time.Duration {
+		last, ok := entries[key]
+		if !ok {
+			return 0
+		}
+		wait := last.Add(cooldown).Sub(now)
+		if wait <= 0 {
+			delete(entries, key)
+			return 0
+		}
+		return wait
+	}
+
+	if l.limits.PerUser > 0 {
+		status.User = remaining(l.users, userID, l.limits.PerUser)
+	}
+	if l.limits.PerGuild > 0 {
+		status.Guild = remaining(l.guilds, guildID, l.limits.PerGuild)
+	}
+
+	if l.limits.GlobalPerMinute > 0 {
+		expired := 0
+		for expired < len(l.global) && !now.Before(l.global[expired].Add(time.Minute)) {
+			expired++
+		}
+		l.global = l.global[expired:]
+
+		status.GlobalRemaining = max(l.limits.GlobalPerMinute-len(l.global), 0)
+		if status.GlobalRemaining == 0 {
+			status.Global = l.global[0].Add(time.Minute).Sub(now)
+		}
+	}
+
+	return status
+}
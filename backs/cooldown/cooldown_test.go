@@ -0,0 +1,100 @@
+package cooldown
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewLimiter(Limits{
+		PerUser:         30 * time.Second,
+		PerGuild:        10 * time.Second,
+		GlobalPerMinute: 3,
+	})
+	limiter.SetClock(func() time.Time { return now })
+
+	expectAllowed := func(user, guild string) {
+		t.Helper()
+		if _, status, ok := limiter.Allow(user, guild); !ok {
+			t.Fatalf("expected %s in %s to be allowed at %v, got %+v", user, guild, now, status)
+		}
+	}
+	expectBlocked := func(user, guild string, scope Scope, wait time.Duration) {
+		t.Helper()
+		_, status, ok := limiter.Allow(user, guild)
+		if ok {
+			t.Fatalf("expected %s in %s to be blocked at %v", user, guild, now)
+		}
+		if blockedScope, blockedWait, _ := status.Blocked(); blockedScope != scope || blockedWait != wait {
+			t.Fatalf("expected to be blocked by %s for %v, got %s for %v", scope, wait, blockedScope, blockedWait)
+		}
+	}
+
+	expectAllowed("alice", "guild1")
+	expectBlocked("alice", "guild1", User, 30*time.Second)
+	expectBlocked("bob", "guild1", Guild, 10*time.Second)
+	expectAllowed("bob", "guild2")
+
+	now = now.Add(10 * time.Second)
+	expectBlocked("alice", "guild1", User, 20*time.Second)
+	// user cooldowns follow them between guilds
+	expectBlocked("bob", "guild1", User, 20*time.Second)
+	expectAllowed("dave", "guild1")
+
+	// three backs in the last minute exhausts the global limit
+	now = now.Add(10 * time.Second)
+	expectBlocked("carol", "guild3", Global, 40*time.Second)
+	if status := limiter.Status("carol", "guild3"); status.GlobalRemaining != 0 {
+		t.Fatalf("expected no global backs remaining, got %d", status.GlobalRemaining)
+	}
+
+	now = now.Add(40 * time.Second)
+	expectAllowed("carol", "guild3")
+	if status := limiter.Status("alice", "guild1"); status.User != 0 || status.GlobalRemaining != 1 {
+		t.Fatalf("expected alice's cooldown to have expired and one global back remaining, got %+v", status)
+	}
+}
+
+func TestLimiterDisabled(t *testing.T) {
+	limiter := NewLimiter(Limits{})
+	for range 100 {
+		if _, _, ok := limiter.Allow("alice", "guild"); !ok {
+			t.Fatal("expected a limiter with no limits to allow everything")
+		}
+	}
+	if status := limiter.Status("alice", "guild"); status.GlobalRemaining != -1 {
+		t.Fatalf("expected no global limit, got %+v", status)
+	}
+}
+
+func TestLimiterRefund(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewLimiter(Limits{
+		PerUser:         30 * time.Second,
+		PerGuild:        10 * time.Second,
+		GlobalPerMinute: 2,
+	})
+	limiter.SetClock(func() time.Time { return now })
+
+	// a back that failed to play doesn't count
+	ticket, _, ok := limiter.Allow("alice", "guild1")
+	if !ok {
+		t.Fatal("expected the first back to be allowed")
+	}
+	limiter.Refund(ticket)
+	if status := limiter.Status("alice", "guild1"); status.User != 0 || status.Guild != 0 || status.GlobalRemaining != 2 {
+		t.Fatalf("expected the refunded back to be forgotten, got %+v", status)
+	}
+
+	// refunding a stale ticket leaves newer backs alone
+	stale, _, _ := limiter.Allow("alice", "guild1")
+	now = now.Add(30 * time.Second)
+	if _, _, ok := limiter.Allow("alice", "guild1"); !ok {
+		t.Fatal("expected alice to be allowed once her cooldown passed")
+	}
+	limiter.Refund(stale)
+	if status := limiter.Status("alice", "guild1"); status.User != 30*time.Second || status.GlobalRemaining != 1 {
+		t.Fatalf("expected only the stale back to be refunded, got %+v", status)
+	}
+}
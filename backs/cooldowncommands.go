@@ -0,0 +1,64 @@
+package backs
+
+import (
+	"back-bot/backs/cooldown"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var CooldownCmd = &discordgo.ApplicationCommand{
+	Name:         "cooldown",
+	Description:  "See how long until you can back again",
+	Type:         discordgo.ChatApplicationCommand,
+	DMPermission: &falseVar,
+}
+
+type cooldownCmdHandler struct {
+	cooldowns *cooldown.Limiter
+}
+
+func NewCooldownCmdHandler(limiter *cooldown.Limiter) *cooldownCmdHandler {
+	return &cooldownCmdHandler{
+		cooldowns: limiter,
+	}
+}
+
+func (c *cooldownCmdHandler) Cooldown(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	user := i.Member.User
+	if user == nil {
+		user = i.User
+	}
+
+	status := c.cooldowns.Status(user.ID, i.GuildID)
+
+	var content strings.Builder
+	if _, wait, blocked := status.Blocked(); blocked {
+		fmt.Fprintf(&content, "You can back again in %s.\n", formatWait(wait))
+	} else {
+		content.WriteString("You're good to back!\n")
+	}
+
+	line := func(label string, wait time.Duration) {
+		if wait > 0 {
+			fmt.Fprintf(&content, "**%s:** %s left\n", label, formatWait(wait))
+		} else {
+			fmt.Fprintf(&content, "**%s:** ready\n", label)
+		}
+	}
+	line("You", status.User)
+	line("This server", status.Guild)
+	if status.GlobalRemaining >= 0 {
+		line("Everywhere", status.Global)
+		fmt.Fprintf(&content, "%d more backs allowed across every server this minute.\n", status.GlobalRemaining)
+	}
+
+	respond(s, i, content.String(), true)
+}
+
+// formatWait rounds wait up to the second, so nothing is ever shown as "0s" left.
+func formatWait(wait time.Duration) string {
+	return ((wait + time.Second - 1) / time.Second * time.Second).String()
+}
@@ -0,0 +1,99 @@
+package backs
+
+import (
+	"back-bot/backs/loot"
+	"back-bot/backs/model"
+	"back-bot/logging"
+	"back-bot/metrics"
+	"fmt"
+	"log/slog"
+	"maps"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var DailyCmd = &discordgo.ApplicationCommand{
+	Name:         "daily",
+	Description:  "Claim your daily greenbacks and a free back",
+	Type:         discordgo.ChatApplicationCommand,
+	DMPermission: &falseVar,
+}
+
+// DailyRewards configures /daily.
+type DailyRewards struct {
+	// Greenbacks are awarded for every claim.
+	Greenbacks int
+	// StreakBonus is added for each consecutive day after the first, up to MaxStreak days.
+	StreakBonus int
+	MaxStreak   int
+}
+
+// greenbacks returns the reward for claiming on the given day of a streak.
+func (d DailyRewards) greenbacks(streak int) int {
+	bonusDays := min(streak, max(d.MaxStreak, 1)) - 1
+	return d.Greenbacks + d.StreakBonus*bonusDays
+}
+
+type dailyCmdHandler struct {
+	lootBag       loot.LootBag
+	backs         BackProvider
+	rarityWeights map[model.Rarity]int
+	rewards       DailyRewards
+}
+
+func NewDailyCmdHandler(lb loot.LootBag, provider BackProvider, rarityWeights map[model.Rarity]int, rewards DailyRewards) *dailyCmdHandler {
+	if rarityWeights == nil {
+		rarityWeights = model.DefaultRarityWeights
+	}
+
+	// the free roll is a gift, so it can't roll back the user's loot
+	rarityWeights = maps.Clone(rarityWeights)
+	maps.DeleteFunc(rarityWeights, func(r model.Rarity, _ int) bool { return r.IsRollback() })
+
+	return &dailyCmdHandler{
+		lootBag:       lb,
+		backs:         provider,
+		rarityWeights: rarityWeights,
+		rewards:       rewards,
+	}
+}
+
+func (d *dailyCmdHandler) Daily(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	metrics.CommandInvocations.With(DailyCmd.Name).Inc()
+
+	user := i.Member.User
+	userID := loot.UserID(user.ID)
+	now := time.Now()
+
+	streak, ok := d.lootBag.ClaimDaily(userID, now)
+	if !ok {
+		tomorrow := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+		respond(s, i, fmt.Sprintf("You've already claimed today! Come back in %s to keep your %d day streak going.", formatWait(tomorrow.Sub(now)), streak), true)
+		return
+	}
+
+	greenbacks := d.rewards.greenbacks(streak)
+	d.lootBag.AddGreenbacks(userID, greenbacks)
+
+	var content strings.Builder
+	fmt.Fprintf(&content, "%s claimed %d greenbacks", user.Mention(), greenbacks)
+	if streak > 1 {
+		fmt.Fprintf(&content, " for a %d day streak", streak)
+	}
+
+	back, err := chooseBack(d.backs.ActiveBacks(now), d.rarityWeights)
+	if err != nil {
+		metrics.CommandFailures.With(DailyCmd.Name).Inc()
+		slog.Error("failed to roll daily back", append(logging.InteractionAttrs(i), logging.Err, err)...)
+		content.WriteString("!")
+	} else {
+		d.lootBag.AddLoot(userID, back)
+		d.lootBag.RecordRoll(userID, back.Rarity())
+		fmt.Fprintf(&content, " and rolled a %s back: %s!", back.Rarity(), back.Filename())
+	}
+
+	slog.Info("daily claimed", append(logging.InteractionAttrs(i), "streak", streak, "greenbacks", greenbacks)...)
+	respond(s, i, content.String(), false)
+}
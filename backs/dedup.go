@@ -0,0 +1,39 @@
+package backs
+
+import (
+	"sync"
+	"time"
+)
+
+// dedup remembers keys for a window of time, so the same event can't trigger a back twice.
+type dedup[K comparable] struct {
+	window time.Duration
+
+	mu   sync.Mutex
+	seen map[K]time.Time
+}
+
+func newDedup[K comparable](window time.Duration) *dedup[K] {
+	return &dedup[K]{
+		window: window,
+		seen:   make(map[K]time.Time),
+	}
+}
+
+// claim records key at now, reporting false if it was already claimed within the window.
+func (d *dedup[K]) claim(key K, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for k, seen := range d.seen {
+		if now.Sub(seen) > d.window {
+			delete(d.seen, k)
+		}
+	}
+
+	if _, ok := d.seen[key]; ok {
+		return false
+	}
+	d.seen[key] = now
+	return true
+}
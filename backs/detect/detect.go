@@ -0,0 +1,328 @@
+// Package detect finds trigger words in chat messages.
+//
+// Matching is done on whole words: "background" and "feedback" don't contain the
+// trigger "back". Both the message and the triggers are normalized first, so
+// case, compatibility forms (e.g. fullwidth letters) and diacritics on
+// Latin, Greek and Cyrillic letters don't matter.
+//
+// Scripts written without spaces between words (Chinese, Thai, Lao, Khmer,
+// Myanmar, Tibetan) have no word boundaries to speak of, so triggers in those
+// scripts match anywhere inside a run of that script. Japanese kana are a middle
+// ground: a change between Hiragana, Katakana and Kanji is treated as a word
+// boundary, so バック matches in "バックだ" but not in "バックアップ".
+package detect
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Match describes the trigger that was found in a message.
+type Match struct {
+	// Trigger is the trigger as it was given to the Detector.
+	// For pattern matches, it's the pattern's expression.
+	Trigger string
+	// Pattern is set if Trigger is a regular expression.
+	Pattern bool
+}
+
+type trigger struct {
+	original string
+	tokens   []token
+	// unspaced triggers are matched as substrings of a single message token
+	unspaced bool
+}
+
+// span is a byte range [start, end) of normalized content.
+type span struct {
+	start, end int
+}
+
+func (s span) within(other span) bool {
+	return other.start <= s.start && s.end <= other.end
+}
+
+// Rules are the triggers and exclusions a Detector matches with.
+type Rules struct {
+	Triggers []string
+	// Exclusions are words or phrases that stop any trigger inside them from counting,
+	// e.g. excluding "back end" keeps "back" from matching in "the back end is down"
+	// while still matching in "I'm back". Excluding a trigger itself disables it.
+	Exclusions []string
+	// Patterns are regular expressions matched against the normalized message.
+	Patterns []*Pattern
+}
+
+// Detector matches messages against a fixed set of triggers.
+type Detector struct {
+	triggers   []trigger
+	exclusions []trigger
+	patterns   []*Pattern
+}
+
+// New compiles the triggers. Triggers that normalize to nothing are ignored.
+func New(triggers []string) *Detector {
+	return Compile(Rules{Triggers: triggers})
+}
+
+// Compile compiles a Detector from rules.
+func Compile(rules Rules) *Detector {
+	return &Detector{
+		triggers:   compileTriggers(rules.Triggers),
+		exclusions: compileTriggers(rules.Exclusions),
+		patterns:   rules.Patterns,
+	}
+}
+
+func compileTriggers(words []string) []trigger {
+	var triggers []trigger
+
+	for _, t := range words {
+		tokens := tokenize(Normalize(t))
+		if len(tokens) == 0 {
+			continue
+		}
+
+		triggers = append(triggers, trigger{
+			original: t,
+			tokens:   tokens,
+			unspaced: len(tokens) == 1 && tokens[0].class.unspaced(),
+		})
+	}
+
+	return triggers
+}
+
+// Detect returns the first trigger, in the order given to the Detector, found in content
+// outside of any exclusion. Patterns are checked after every plain trigger.
+func (d *Detector) Detect(content string) (Match, bool) {
+	normalized := Normalize(content)
+	tokens := tokenize(normalized)
+
+	var excluded []span
+	for _, e := range d.exclusions {
+		excluded = append(excluded, e.occurrences(tokens)...)
+	}
+	isExcluded := func(occurrence span) bool {
+		for _, e := range excluded {
+			if occurrence.within(e) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, t := range d.triggers {
+		for _, occurrence := range t.occurrences(tokens) {
+			if !isExcluded(occurrence) {
+				return Match{Trigger: t.original}, true
+			}
+		}
+	}
+
+	remaining := evaluationBudget
+	for _, p := range d.patterns {
+		if !remaining.spend(p, normalized) {
+			break
+		}
+		for _, occurrence := range p.occurrences(normalized) {
+			if !isExcluded(occurrence) {
+				return Match{Trigger: p.Expr(), Pattern: true}, true
+			}
+		}
+	}
+
+	return Match{}, false
+}
+
+func (t trigger) occurrences(tokens []token) []span {
+	var occurrences []span
+
+	if t.unspaced {
+		needle := t.tokens[0].text
+		for _, tok := range tokens {
+			if tok.class != t.tokens[0].class {
+				continue
+			}
+			for offset := 0; ; {
+				i := strings.Index(tok.text[offset:], needle)
+				if i < 0 {
+					break
+				}
+				start := tok.start + offset + i
+				occurrences = append(occurrences, span{start, start + len(needle)})
+				offset += i + len(needle)
+			}
+		}
+		return occurrences
+	}
+
+	for start := 0; start+len(t.tokens) <= len(tokens); start++ {
+		matched := true
+		for i, tt := range t.tokens {
+			if tokens[start+i].text != tt.text {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			occurrences = append(occurrences, span{tokens[start].start, tokens[start+len(t.tokens)-1].end})
+		}
+	}
+	return occurrences
+}
+
+var folder = cases.Fold()
+
+// Normalize folds case, applies compatibility decomposition, strips diacritics from
+// Latin, Greek and Cyrillic letters, and drops invisible formatting characters.
+func Normalize(s string) string {
+	s = norm.NFKD.String(s)
+	s = folder.String(s)
+
+	var b strings.Builder
+	b.Grow(len(s))
+
+	stripMarks := false
+	for _, r := range s {
+		switch {
+		case isInvisible(r):
+			continue
+		case unicode.Is(unicode.Mn, r):
+			if stripMarks {
+				continue
+			}
+		default:
+			stripMarks = unicode.In(r, unicode.Latin, unicode.Greek, unicode.Cyrillic)
+		}
+		b.WriteRune(r)
+	}
+
+	return norm.NFC.String(b.String())
+}
+
+// isInvisible reports whether r is a formatting character that shouldn't affect matching,
+// like the zero width spaces some scripts use as optional word breaks.
+func isInvisible(r rune) bool {
+	switch r {
+	case '\u200b', '\u00ad', '\u2060', '\ufeff', '\ufe0e', '\ufe0f':
+		return true
+	}
+	return false
+}
+
+// prolongedSoundMark (ー) is shared by Hiragana and Katakana, but overwhelmingly used in Katakana.
+const prolongedSoundMark = '\u30fc'
+
+type class int
+
+const (
+	// spaced scripts separate words with spaces or punctuation
+	spaced class = iota
+	// symbol tokens are single runes like emoji
+	symbol
+	hiragana
+	katakana
+	han
+	thai
+	lao
+	khmer
+	myanmar
+	tibetan
+)
+
+func (c class) unspaced() bool {
+	switch c {
+	case han, thai, lao, khmer, myanmar, tibetan:
+		return true
+	}
+	return false
+}
+
+func classOf(r rune) class {
+	switch {
+	case unicode.Is(unicode.Hiragana, r):
+		return hiragana
+	case unicode.Is(unicode.Katakana, r), r == prolongedSoundMark:
+		return katakana
+	case unicode.Is(unicode.Han, r):
+		return han
+	case unicode.Is(unicode.Thai, r):
+		return thai
+	case unicode.Is(unicode.Lao, r):
+		return lao
+	case unicode.Is(unicode.Khmer, r):
+		return khmer
+	case unicode.Is(unicode.Myanmar, r):
+		return myanmar
+	case unicode.Is(unicode.Tibetan, r):
+		return tibetan
+	default:
+		return spaced
+	}
+}
+
+type token struct {
+	text  string
+	class class
+	// byte offsets of the token in the normalized text
+	start, end int
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsDigit(r) || unicode.Is(unicode.Braille, r) || r == prolongedSoundMark
+}
+
+func isSymbol(r rune) bool {
+	return unicode.In(r, unicode.So, unicode.Sk)
+}
+
+// tokenize splits normalized text into words and symbols.
+func tokenize(s string) []token {
+	var tokens []token
+	var currentClass class
+	start := -1
+
+	flush := func(end int) {
+		if start >= 0 {
+			tokens = append(tokens, token{text: s[start:end], class: currentClass, start: start, end: end})
+			start = -1
+		}
+	}
+
+	for i, r := range s {
+		switch {
+		case isWordRune(r):
+			c := currentClass
+			// marks belong to the letter they're attached to
+			if !unicode.IsMark(r) || start < 0 {
+				c = classOf(r)
+			}
+			if c != currentClass {
+				flush(i)
+				currentClass = c
+			}
+			if start < 0 {
+				start = i
+			}
+		case isSymbol(r):
+			flush(i)
+			tokens = append(tokens, token{text: string(r), class: symbol, start: i, end: i + utf8.RuneLen(r)})
+		default:
+			flush(i)
+		}
+	}
+	flush(len(s))
+
+	return tokens
+}
+
+// Matchable reports whether word contains anything a message could match,
+// i.e. it isn't empty or made up entirely of punctuation and whitespace.
+func Matchable(word string) bool {
+	return len(tokenize(Normalize(word))) > 0
+}
@@ -0,0 +1,245 @@
+package detect_test
+
+import (
+	"back-bot/backs"
+	"back-bot/backs/detect"
+	"strings"
+	"testing"
+)
+
+func TestDetectBackWords(t *testing.T) {
+	detector := detect.New(backs.BackWords)
+
+	cases := []struct {
+		content string
+		trigger string // empty if no back should be detected
+	}{
+		// English, the bread and butter
+		{"back", "back"},
+		{"I'm back", "back"},
+		{"BACK", "back"},
+		{"BaCk!!!", "back"},
+		{"back.", "back"},
+		{"(back)", "back"},
+		{"he's back-to-back champion", "back"},
+		{"back's", "back"},
+		{"\"back\"", "back"},
+		{"ｂａｃｋ", "back"},       // fullwidth
+		{"b\u200back", "back"}, // zero width space is ignored
+		{"background", ""},
+		{"feedback", ""},
+		{"backend", ""},
+		{"backpack", ""},
+		{"paperback", ""},
+		{"setback", ""},
+		{"backs", ""},
+		{"back2back", ""},
+		{"bac k", ""},
+		{"", ""},
+		{"hello there", ""},
+
+		// mixed-case entries in BackWords still match
+		{"atzera", "Atzera"},
+		{"ATZERA", "Atzera"},
+		{"Atzera etorri naiz", "Atzera"},
+
+		// whole words only
+		{"hoki", "hoki"},
+		{"go hokies", ""},
+		{"hokie", ""},
+		{"balikbayan", ""},
+		{"bali", "bali"},
+		{"pada", "pada"},
+		{"padang", ""},
+		{"dib", "dib"},
+		{"dibble", ""},
+		{"reen", "reen"},
+		{"green", ""},
+		{"baya", "baya"},
+		{"bayaran", ""},
+		{"lura", "lura"},
+		{"lurasan", ""},
+
+		// diacritics and case folding
+		{"arrière", "arrière"},
+		{"ARRIÈRE", "arrière"},
+		{"arriere", "arrière"},
+		{"zurück", "zurück"},
+		{"ZURÜCK", "zurück"},
+		{"zuruck", "zurück"},
+		{"zurückhaltend", ""},
+		{"zpět", "zpět"},
+		{"zpet", "zpět"},
+		{"späť", "späť"},
+		{"spat", "späť"},
+		{"atpakaļ", "atpakaļ"},
+		{"ΠΊΣΩ", "πίσω"},
+		{"πισω", "πίσω"},
+		{"ich bin wieder ZURÜCK", "zurück"},
+		{"trở lại", "trở lại"},
+		{"tro lai", "trở lại"},
+		{"TRỞ LẠI", "trở lại"},
+
+		// multi-word triggers need every word, in order
+		{"de volta", "de volta"},
+		{"estou de volta!", "de volta"},
+		{"volta de", ""},
+		{"de voltagem", ""},
+		{"tá ar ais", "ar ais"},
+		{"rov qab los", "rov qab"},
+		{"yn ôl", "yn ôl"},
+		{"yn ol", "yn ôl"},
+
+		// Cyrillic
+		{"назад", "назад"},
+		{"НАЗАД", "назад"},
+		{"я вернулся назад", "назад"},
+		{"назадний", ""},
+		{"обратно", "обратно"},
+		{"таму", "таму"},
+
+		// right to left scripts
+		{"إلى الوراء", "إلى الوراء"},
+		{"חזור", "חזור"},
+		{"بازگشت", "بازگشت"},
+		{"واپس", "واپس"},
+
+		// Indic scripts
+		{"मैं वापस आ गया", "वापस"},
+		{"পিছনে", "পিছনে"},
+		{"மீண்டும்", "மீண்டும்"},
+		{"ආපසු", "ආපසු"},
+
+		// scripts without word spacing match inside runs
+		{"กลับ", "กลับ"},
+		{"ผมกลับมาแล้ว", "กลับ"},
+		{"ត្រឡប់មកវិញ", "ត្រឡប់​មក​វិញ"},
+		{"ខ្ញុំត្រឡប់​មក​វិញហើយ", "ត្រឡប់​មក​វិញ"},
+		{"ກັບຄືນໄປບ່ອນ", "ກັບ​ຄືນ​ໄປ​ບ່ອນ"},
+		{"နောက်ကျော", "နောက်ကျော"},
+		{"他的背部很痛", "背部"},
+		{"在後面", "後面"},
+		{"後", ""},
+
+		// Japanese kana runs are words
+		{"バック", "バック"},
+		{"バックだよ", "バック"},
+		{"バックアップ", ""},
+		{"ﾊﾞｯｸ", "バック"}, // halfwidth katakana
+
+		// Korean is spaced
+		{"백", "백"},
+		{"나 백", "백"},
+
+		// symbols and braille
+		{"🔙", "\U0001f519"},
+		{"I'm🔙", "\U0001f519"},
+		{"🔙️", "\U0001f519"}, // with emoji variation selector
+		{"⠃⠁⠉⠅", "⠃⠁⠉⠅"},
+		{"⠃⠁⠉⠅⠎", ""},
+	}
+
+	for _, c := range cases {
+		match, ok := detector.Detect(c.content)
+
+		if c.trigger == "" {
+			if ok {
+				t.Errorf("expected no back in %q, but matched trigger %q", c.content, match.Trigger)
+			}
+			continue
+		}
+
+		if !ok {
+			t.Errorf("expected back in %q (trigger %q), but none was detected", c.content, c.trigger)
+			continue
+		}
+		if match.Trigger != c.trigger {
+			t.Errorf("expected %q to match trigger %q, got %q", c.content, c.trigger, match.Trigger)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	cases := map[string]string{
+		"BACK":     "back",
+		"Arrière":  "arriere",
+		"ＢＡＣＫ":     "back",
+		"Straße":   "strasse",
+		"ΠΊΣΩ":     "πισω",
+		"ﬁnally":   "finally",
+		"a\u200bb": "ab",
+		"กลับ":     "กลับ",
+		"バック":      "バック",
+	}
+
+	for in, expected := range cases {
+		if actual := detect.Normalize(in); actual != expected {
+			t.Errorf("Normalize(%q) = %q, expected %q", in, actual, expected)
+		}
+	}
+}
+
+func TestDetectRules(t *testing.T) {
+	mustCompile := func(expr string) *detect.Pattern {
+		p, err := detect.CompilePattern(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	detector := detect.Compile(detect.Rules{
+		Triggers:   []string{"back", "bali", "welcome home"},
+		Exclusions: []string{"back end", "bali", "kembali"},
+		Patterns:   []*detect.Pattern{mustCompile(`b+a+c+k+`), mustCompile(`\bi'?m ba+ck\b`)},
+	})
+
+	cases := []struct {
+		content string
+		trigger string
+		pattern bool
+	}{
+		{"back", "back", false},
+		{"the back end is down", "", false},
+		{"the back end is down, but I'm back", "back", false},
+		{"the BACK END is down", "", false},
+		{"going to bali", "", false},
+		{"welcome home!", "welcome home", false},
+		{"bbaaaccckk", `b+a+c+k+`, true},
+		{"im baaaack", `b+a+c+k+`, true},
+		{"BAAACK", `b+a+c+k+`, true},
+		{"background", `b+a+c+k+`, true},
+		{"nothing here", "", false},
+	}
+
+	for _, c := range cases {
+		match, ok := detector.Detect(c.content)
+		if c.trigger == "" {
+			if ok {
+				t.Errorf("expected no back in %q, but matched %q", c.content, match.Trigger)
+			}
+			continue
+		}
+		if !ok || match.Trigger != c.trigger || match.Pattern != c.pattern {
+			t.Errorf("expected %q to match %q (pattern: %v), got %+v (ok: %v)", c.content, c.trigger, c.pattern, match, ok)
+		}
+	}
+}
+
+func TestCompilePatternLimits(t *testing.T) {
+	invalid := []string{
+		`b(a`,
+		`a*`,
+		`(a{100}){100}`,
+		strings.Repeat("a", detect.MaxPatternLength+1),
+	}
+	for _, expr := range invalid {
+		if _, err := detect.CompilePattern(expr); err == nil {
+			t.Errorf("expected pattern %q to be rejected", expr)
+		}
+	}
+
+	if _, err := detect.CompilePattern(`b+a+c+k+`); err != nil {
+		t.Errorf("expected simple pattern to compile, got %v", err)
+	}
+}
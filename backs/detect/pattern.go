@@ -0,0 +1,93 @@
+package detect
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+)
+
+// Limits on regular expression triggers. Go's regexp package guarantees matching in
+// time linear in the input, so bounding the size of the compiled program and the
+// input bounds the cost of every evaluation.
+const (
+	MaxPatternLength = 100
+	// MaxPatternInsts bounds the compiled program, which counted repetitions like
+	// a{1000} inflate.
+	MaxPatternInsts = 500
+	// maxPatternInput is where message content is truncated before patterns see it.
+	// Discord messages are at most 4000 characters even with Nitro.
+	maxPatternInput = 4096
+	// evaluationBudget is the total instructions x input bytes that can be spent on
+	// a single message's patterns. Patterns past the budget are skipped.
+	evaluationBudget budget = 2 * MaxPatternInsts * maxPatternInput
+)
+
+// Pattern is a regular expression trigger, matched against normalized message content.
+type Pattern struct {
+	expr  string
+	re    *regexp.Regexp
+	insts int
+}
+
+// CompilePattern validates expr against the pattern limits and compiles it.
+// expr is normalized the same way as messages, so it should be written in lower case.
+func CompilePattern(expr string) (*Pattern, error) {
+	if len(expr) > MaxPatternLength {
+		return nil, fmt.Errorf("pattern is longer than %d characters", MaxPatternLength)
+	}
+
+	parsed, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	prog, err := syntax.Compile(parsed.Simplify())
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+	if len(prog.Inst) > MaxPatternInsts {
+		return nil, errors.New("pattern is too complex")
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	if re.MatchString("") {
+		return nil, errors.New("pattern can't match an empty message")
+	}
+
+	return &Pattern{expr: expr, re: re, insts: len(prog.Inst)}, nil
+}
+
+// Expr returns the pattern's source expression.
+func (p *Pattern) Expr() string {
+	return p.expr
+}
+
+func (p *Pattern) occurrences(normalized string) []span {
+	if len(normalized) > maxPatternInput {
+		normalized = normalized[:maxPatternInput]
+	}
+
+	var occurrences []span
+	for _, loc := range p.re.FindAllStringIndex(normalized, -1) {
+		occurrences = append(occurrences, span{loc[0], loc[1]})
+	}
+	return occurrences
+}
+
+type budget int
+
+// spend deducts the cost of evaluating p against content, reporting false
+// if there isn't enough budget left to do so.
+func (b *budget) spend(p *Pattern, content string) bool {
+	cost := budget(p.insts * min(len(content), maxPatternInput))
+	if cost > *b {
+		return false
+	}
+	*b -= cost
+	return true
+}
@@ -0,0 +1,51 @@
+package backs
+
+import (
+	"slices"
+	"time"
+)
+
+// Event is a limited-time pool of backs, read from model.EventsDir in back_repo,
+// that can roll alongside the regular backs while the event runs.
+type Event struct {
+	Name string
+	// Start and End bound when the event runs. End is exclusive.
+	Start, End time.Time
+	// Boost is how many times more likely each of the event's backs is to be picked
+	// than a regular back of the same rarity. Zero or one means equally likely.
+	Boost int
+}
+
+// Active reports whether the event is running at t.
+func (e Event) Active(t time.Time) bool {
+	return !t.Before(e.Start) && t.Before(e.End)
+}
+
+type eventPool struct {
+	Event
+	backs BackMapping
+}
+
+// withEvents returns the regular backs merged with the pools of events running
+// at now. Boosted backs appear once per point of boost.
+func withEvents(regular BackMapping, pools []eventPool, now time.Time) BackMapping {
+	merged := BackMapping{}
+	for rarity, backs := range regular {
+		merged[rarity] = backs
+	}
+
+	for _, pool := range pools {
+		if !pool.Active(now) {
+			continue
+		}
+		for rarity, backs := range pool.backs {
+			// clip so appending copies, rather than writing into the regular backs
+			list := slices.Clip(merged[rarity])
+			for range max(pool.Boost, 1) {
+				list = append(list, backs...)
+			}
+			merged[rarity] = list
+		}
+	}
+	return merged
+}
@@ -0,0 +1,51 @@
+package backs
+
+import (
+	"back-bot/backs/model"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestEventPools(t *testing.T) {
+	backfs := fstest.MapFS{
+		"Common/hello_back.dca":                   {},
+		"Rare/welcome_back.dca":                   {},
+		"Events/Halloween/Rare/spooky_back.dca":   {},
+		"Events/Halloween/Common/boo_back.dca":    {},
+		"Events/Christmas/Common/jingle_back.dca": {},
+	}
+
+	regular, err := GetBacks(backfs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(regular) != 2 || len(regular[model.Rare]) != 1 {
+		t.Fatalf("expected event pools to be left out of the regular backs, got %v", regular)
+	}
+
+	start := time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC)
+	provider := NewBackProvider(backfs, Event{Name: "Halloween", Start: start, End: start.AddDate(0, 1, 0), Boost: 2})
+
+	if active := provider.ActiveBacks(start.Add(-time.Second)); len(active[model.Rare]) != 1 {
+		t.Fatalf("expected only regular backs before the event, got %v", active)
+	}
+
+	active := provider.ActiveBacks(start)
+	if len(active[model.Rare]) != 3 || len(active[model.Common]) != 3 {
+		t.Fatalf("expected boosted event backs during the event, got %v", active)
+	}
+	if event := active[model.Rare][2].Event(); event != "Halloween" {
+		t.Fatalf("expected event back to be tagged Halloween, got %q", event)
+	}
+	if active[model.Rare][2].Rarity() != model.Rare {
+		t.Fatalf("expected event back to keep its rarity, got %s", active[model.Rare][2].Rarity())
+	}
+	if len(provider.Backs()[model.Rare]) != 1 {
+		t.Fatal("expected merging event backs to leave the regular backs alone")
+	}
+
+	if active := provider.ActiveBacks(start.AddDate(0, 1, 0)); len(active[model.Rare]) != 1 {
+		t.Fatalf("expected only regular backs after the event, got %v", active)
+	}
+}
@@ -0,0 +1,62 @@
+package backs
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// fuzzyScore matches query against candidate, ignoring case, if the runes of query
+// appear in candidate in order. Higher scores are better matches: runes that follow
+// each other, or start the candidate or one of its words, score extra. Every way of
+// matching the runes is tried, so "back" finds the end of "bigback" rather than its
+// first "b". An empty query matches everything equally.
+func fuzzyScore(query, candidate string) (int, bool) {
+	q := []rune(strings.ToLower(query))
+	c := []rune(strings.ToLower(candidate))
+
+	// best[ci] is the best score for the query so far with its last rune matched at
+	// ci, or -1 if it can't be matched there
+	best := make([]int, len(c))
+	for qi, qr := range q {
+		next := make([]int, len(c))
+		// before is the best score for the query before qi, matched before ci-1
+		before := -1
+		for ci, r := range c {
+			if qi > 0 && ci >= 2 {
+				before = max(before, best[ci-2])
+			}
+
+			next[ci] = -1
+			if r != qr {
+				continue
+			}
+			from := 0
+			if qi > 0 {
+				from = before
+				if ci >= 1 && best[ci-1] >= 0 {
+					from = max(from, best[ci-1]+3)
+				}
+				if from < 0 {
+					continue
+				}
+			}
+
+			next[ci] = from + 1
+			if ci == 0 || !unicode.IsLetter(c[ci-1]) && !unicode.IsDigit(c[ci-1]) {
+				next[ci] += 2
+			}
+		}
+		best = next
+	}
+
+	score := 0
+	if len(q) > 0 {
+		score = slices.Max(append(best, -1))
+	}
+	if score < 0 {
+		return 0, false
+	}
+	// prefer tighter matches, all else being equal
+	return score*100 - len(c), true
+}
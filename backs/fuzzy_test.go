@@ -0,0 +1,37 @@
+package backs
+
+import "testing"
+
+func TestFuzzyScore(t *testing.T) {
+	if _, ok := fuzzyScore("gkb", "gokusback"); !ok {
+		t.Error("expected runes in order to match")
+	}
+	if _, ok := fuzzyScore("bkg", "gokusback"); ok {
+		t.Error("expected runes out of order not to match")
+	}
+	if _, ok := fuzzyScore("GOKU", "gokusback"); !ok {
+		t.Error("expected matching to ignore case")
+	}
+
+	better := []struct{ query, better, worse string }{
+		{"back", "backagain", "big_and_cool_kaboom"},
+		{"hb", "hello_back", "ohbother"},
+		{"back", "back", "backagain"},
+	}
+	for _, c := range better {
+		b, _ := fuzzyScore(c.query, c.better)
+		w, _ := fuzzyScore(c.query, c.worse)
+		if b <= w {
+			t.Errorf("expected %q to match %q (%d) better than %q (%d)", c.query, c.better, b, c.worse, w)
+		}
+	}
+}
+
+func TestFuzzyScoreTriesEveryMatch(t *testing.T) {
+	// both are matched as one run of "back", with no word start
+	first, _ := fuzzyScore("back", "bigback")
+	only, _ := fuzzyScore("back", "xyzback")
+	if first != only {
+		t.Errorf("expected the run of \"back\" in bigback to be found, got %d rather than %d", first, only)
+	}
+}
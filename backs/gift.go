@@ -0,0 +1,166 @@
+package backs
+
+import (
+	"back-bot/backs/loot"
+	"back-bot/backs/model"
+	"back-bot/logging"
+	"back-bot/metrics"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const maxGiftMessageLength = 200
+
+var GiftBackCmd = &discordgo.ApplicationCommand{
+	Name:         "giftback",
+	Description:  "Give one of your backs to another member",
+	Type:         discordgo.ChatApplicationCommand,
+	DMPermission: &falseVar,
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionUser,
+			Name:        "user",
+			Description: "Who to give the back to",
+			Required:    true,
+		},
+		{
+			Type:         discordgo.ApplicationCommandOptionString,
+			Name:         "back",
+			Description:  "The back to give away",
+			Autocomplete: true,
+			Required:     true,
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "message",
+			Description: "A note to go with the gift",
+			MaxLength:   maxGiftMessageLength,
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionBoolean,
+			Name:        "public",
+			Description: "Announce the gift in this channel",
+		},
+	},
+}
+
+type giftCmdHandler struct {
+	lootBag  loot.LootBag
+	provider BackProvider
+	perDay   int
+}
+
+// NewGiftCmdHandler handles /giftback, letting each user give away perDay backs per
+// UTC day. Zero is no limit.
+func NewGiftCmdHandler(lb loot.LootBag, provider BackProvider, perDay int) *giftCmdHandler {
+	return &giftCmdHandler{
+		lootBag:  lb,
+		provider: provider,
+		perDay:   perDay,
+	}
+}
+
+func (g *giftCmdHandler) GiftBack(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	metrics.CommandInvocations.With(GiftBackCmd.Name).Inc()
+
+	data := i.ApplicationCommandData()
+	sender := interactionUser(i)
+	var recipient *discordgo.User
+	var backPath, message string
+	var public bool
+	for _, option := range data.Options {
+		switch option.Name {
+		case "user":
+			recipient = resolvedUser(data, option.Value.(string))
+		case "back":
+			backPath = option.StringValue()
+		case "message":
+			message = strings.TrimSpace(option.StringValue())
+		case "public":
+			public = option.BoolValue()
+		}
+	}
+
+	switch {
+	case recipient == nil:
+		return
+	case recipient.ID == sender.ID:
+		respond(s, i, "You can't gift a back to yourself!", true)
+		return
+	case recipient.Bot:
+		respond(s, i, "Bots don't have backpacks.", true)
+		return
+	}
+
+	back, err := model.GetBack(backPath)
+	if err != nil {
+		respond(s, i, fmt.Sprintf("%s is not a valid back path!", backPath), true)
+		return
+	}
+	name := g.provider.DisplayName(back)
+
+	now := time.Now()
+	gifts, err := g.lootBag.Gift(loot.UserID(sender.ID), loot.UserID(recipient.ID), back, now, g.perDay)
+	switch {
+	case errors.Is(err, loot.ErrGiftLimit):
+		tomorrow := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+		respond(s, i, fmt.Sprintf("You've already given away %d backs today. You can gift again in %s.", gifts, formatWait(tomorrow.Sub(now))), true)
+		return
+	case errors.Is(err, loot.ErrNotInBackpack):
+		respond(s, i, fmt.Sprintf("You don't have %s in your backpack to give away!", name), true)
+		return
+	case err != nil:
+		slog.Error("failed to gift a back", append(logging.InteractionAttrs(i), logging.BackPath, back.Path(), logging.Err, err)...)
+		respond(s, i, "Something went wrong giving that back. Try again later.", true)
+		return
+	}
+
+	slog.Info("back gifted", append(logging.InteractionAttrs(i), logging.BackPath, back.Path(), "recipient_id", recipient.ID, "gifts_today", gifts)...)
+
+	announcement := fmt.Sprintf("🎁 <@%s> gave <@%s> **%s** (%s)!", sender.ID, recipient.ID, name, back.Rarity())
+	if message != "" {
+		announcement += "\n> " + message
+	}
+
+	if public {
+		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: announcement,
+				// ping the recipient, not anyone mentioned in the message
+				AllowedMentions: &discordgo.MessageAllowedMentions{Users: []string{recipient.ID}},
+			},
+		})
+		if err != nil {
+			slog.Error("error responding to /giftback command", append(logging.InteractionAttrs(i), logging.Err, err)...)
+		}
+		return
+	}
+
+	content := fmt.Sprintf("You gave %s to %s.", name, recipient.Username)
+	if g.perDay > 0 {
+		content += fmt.Sprintf(" You can give away %d more today.", g.perDay-gifts)
+	}
+	respond(s, i, content, true)
+
+	// let the recipient know privately, if they accept DMs
+	if err := sendDM(s, recipient.ID, announcement); err != nil {
+		slog.Debug("could not DM gift recipient", append(logging.InteractionAttrs(i), "recipient_id", recipient.ID, logging.Err, err)...)
+	}
+}
+
+// GiftBackAutocomplete suggests backs from the sender's backpack.
+func (g *giftCmdHandler) GiftBackAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	for _, option := range i.ApplicationCommandData().Options {
+		if option.Focused && option.Name == "back" {
+			state := g.lootBag.GetState(loot.UserID(interactionUser(i).ID))
+			respondChoices(s, i, backpackChoices(g.provider, state, option.StringValue()))
+			return
+		}
+	}
+}
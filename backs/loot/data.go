@@ -3,13 +3,23 @@ package loot
 import (
 	"bytes"
 	"encoding/csv"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"maps"
 	"os"
+	"path/filepath"
 	"slices"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"back-bot/backs/model"
+	"back-bot/logging"
+	"back-bot/metrics"
 )
 
 // TODO: move to models
@@ -19,6 +29,56 @@ type UserID string
 type UserLootState struct {
 	Loot       map[model.Back]int
 	Greenbacks int
+	// DailyStreak is how many consecutive UTC days the user claimed their daily bonus,
+	// as of LastDaily.
+	DailyStreak int
+	// LastDaily is when the user last claimed their daily bonus.
+	LastDaily time.Time
+	// RollsSince is how many rolls the user has made since they last rolled each rarity.
+	RollsSince map[model.Rarity]int
+	// Private hides the user's backpack from other members.
+	Private bool
+	// GiftsSent is how many backs the user gave away on LastGift's UTC day.
+	GiftsSent int
+	// LastGift is when the user last gave a back away.
+	LastGift time.Time
+	// Escrow are the backs the user has listed on the market. They aren't in Loot
+	// until they're returned, and are taken from here when they're bought.
+	Escrow map[model.Back]int
+}
+
+// GiftsToday returns how many backs the user has given away on now's UTC day.
+func (u UserLootState) GiftsToday(now time.Time) int {
+	if u.LastGift.IsZero() || daysBetween(u.LastGift, now) > 0 {
+		return 0
+	}
+	return u.GiftsSent
+}
+
+// clone copies the state, so it can be read while the original changes.
+func (u UserLootState) clone() UserLootState {
+	u.Loot = maps.Clone(u.Loot)
+	u.RollsSince = maps.Clone(u.RollsSince)
+	u.Escrow = maps.Clone(u.Escrow)
+	return u
+}
+
+// Streak returns the user's daily streak as of now, which is zero if they missed a day.
+func (u UserLootState) Streak(now time.Time) int {
+	if u.LastDaily.IsZero() || daysBetween(u.LastDaily, now) > 1 {
+		return 0
+	}
+	return u.DailyStreak
+}
+
+// daysBetween returns the number of UTC midnights from a to b.
+func daysBetween(a, b time.Time) int {
+	return int(utcDay(b).Sub(utcDay(a)) / (24 * time.Hour))
+}
+
+func utcDay(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
 }
 
 // LootItem is the tuple of (Back, Count), representing a (k, v) pair from the Loot map
@@ -42,6 +102,23 @@ func (u UserLootState) LootByRarity() map[model.Rarity][]LootItem {
 	return out
 }
 
+// LootByEvent partitions the event-exclusive Loot by event, sorted by count
+func (u UserLootState) LootByEvent() map[string][]LootItem {
+	out := make(map[string][]LootItem)
+
+	for back, count := range u.Loot {
+		if event := back.Event(); event != "" {
+			out[event] = append(out[event], LootItem{Back: back, Count: count})
+		}
+	}
+	for k, backs := range out {
+		sortLootItemsByCount(backs)
+		out[k] = backs
+	}
+
+	return out
+}
+
 func (u UserLootState) RarityPoints() int {
 	var rarityPoints int
 	for rarity, backs := range u.LootByRarity() {
@@ -81,6 +158,107 @@ func sortLootItemsByCount(s []LootItem) {
 	})
 }
 
+// Metadata is stored in CSV records alongside loot, as pairs of a key with this
+// prefix and a value. Back paths never start with it.
+const metadataPrefix = "@"
+
+const (
+	metadataDailyStreak = "daily_streak"
+	metadataLastDaily   = "last_daily"
+	metadataPrivate     = "private"
+	metadataGiftsSent   = "gifts_sent"
+	metadataLastGift    = "last_gift"
+	// metadataRollsSince is followed by the rarity's name
+	metadataRollsSince = "since:"
+	// metadataEscrow is followed by the back's path
+	metadataEscrow = "escrow:"
+)
+
+func (u *UserLootState) setMetadata(key, value string) (err error) {
+	if name, ok := strings.CutPrefix(key, metadataRollsSince); ok {
+		rarity, err := model.LookUpRarity(name)
+		if err != nil {
+			return err
+		}
+		rolls, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		if u.RollsSince == nil {
+			u.RollsSince = make(map[model.Rarity]int)
+		}
+		u.RollsSince[rarity] = rolls
+		return nil
+	}
+	if path, ok := strings.CutPrefix(key, metadataEscrow); ok {
+		back, err := model.GetBack(path)
+		if err != nil {
+			return err
+		}
+		count, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		if u.Escrow == nil {
+			u.Escrow = make(map[model.Back]int)
+		}
+		u.Escrow[back] = count
+		return nil
+	}
+
+	switch key {
+	case metadataDailyStreak:
+		u.DailyStreak, err = strconv.Atoi(value)
+	case metadataLastDaily:
+		u.LastDaily, err = time.Parse(time.RFC3339, value)
+	case metadataPrivate:
+		u.Private, err = strconv.ParseBool(value)
+	case metadataGiftsSent:
+		u.GiftsSent, err = strconv.Atoi(value)
+	case metadataLastGift:
+		u.LastGift, err = time.Parse(time.RFC3339, value)
+	default:
+		err = fmt.Errorf("unknown metadata key")
+	}
+	return err
+}
+
+// metadata returns the state's non-zero metadata as CSV fields.
+func (u UserLootState) metadata() []string {
+	var fields []string
+	if u.DailyStreak != 0 {
+		fields = append(fields, metadataPrefix+metadataDailyStreak, strconv.Itoa(u.DailyStreak))
+	}
+	if !u.LastDaily.IsZero() {
+		fields = append(fields, metadataPrefix+metadataLastDaily, u.LastDaily.UTC().Format(time.RFC3339))
+	}
+	for _, rarity := range model.Rarities {
+		if rolls := u.RollsSince[rarity]; rolls != 0 {
+			fields = append(fields, metadataPrefix+metadataRollsSince+rarity.String(), strconv.Itoa(rolls))
+		}
+	}
+	if u.Private {
+		fields = append(fields, metadataPrefix+metadataPrivate, strconv.FormatBool(u.Private))
+	}
+	if u.GiftsSent != 0 {
+		fields = append(fields, metadataPrefix+metadataGiftsSent, strconv.Itoa(u.GiftsSent))
+	}
+	if !u.LastGift.IsZero() {
+		fields = append(fields, metadataPrefix+metadataLastGift, u.LastGift.UTC().Format(time.RFC3339))
+	}
+	var escrow []LootItem
+	for back, count := range u.Escrow {
+		if count > 0 {
+			escrow = append(escrow, LootItem{Back: back, Count: count})
+		}
+	}
+	sortLootItemsByPath(escrow)
+	for _, item := range escrow {
+		fields = append(fields, metadataPrefix+metadataEscrow+item.Path(), strconv.Itoa(item.Count))
+	}
+	return fields
+}
+
 func StateFromCSVRecord(record []string) (UserID, UserLootState, error) {
 	state := UserLootState{
 		Loot: make(map[model.Back]int),
@@ -102,6 +280,13 @@ func StateFromCSVRecord(record []string) (UserID, UserLootState, error) {
 	for record = record[2:]; len(record) >= 2; record = record[2:] {
 		lootPath, countString := record[0], record[1]
 
+		if key, ok := strings.CutPrefix(lootPath, metadataPrefix); ok {
+			if err := state.setMetadata(key, countString); err != nil {
+				slog.Warn("invalid metadata in user loot record", logging.UserID, userID, "key", key, logging.Err, err)
+			}
+			continue
+		}
+
 		back, err := model.GetBack(lootPath)
 		if err != nil {
 			continue
@@ -118,8 +303,7 @@ func StateFromCSVRecord(record []string) (UserID, UserLootState, error) {
 	}
 
 	if len(record) > 0 {
-		// TODO: structured log here
-		fmt.Printf("WARNING: corrupted user loot record discovered. userID: %v remainder of record: %v\n", userID, record)
+		slog.Warn("corrupted user loot record discovered", logging.UserID, userID, "remainder", record)
 	}
 
 	return userID, state, nil
@@ -129,6 +313,7 @@ func CSVRecordFromState(userID UserID, userState UserLootState) []string {
 	var record []string
 
 	record = append(record, string(userID), strconv.Itoa(userState.Greenbacks))
+	record = append(record, userState.metadata()...)
 
 	var lootItems []LootItem
 	for back, count := range userState.Loot {
@@ -151,17 +336,72 @@ type LootBag interface {
 	GetState(userID UserID) UserLootState
 	AddLoot(userID UserID, loot model.Back)
 	RemoveLoot(userID UserID, loot model.Back) bool
+	AddGreenbacks(userID UserID, gb int)
+	// ClaimDaily records the user claiming their daily bonus at now, returning their
+	// new streak. It returns false if they already claimed on now's UTC day.
+	ClaimDaily(userID UserID, now time.Time) (streak int, ok bool)
+	// RecordRoll counts a roll of rarity towards the user's rolls since each rarity.
+	RecordRoll(userID UserID, rarity model.Rarity)
+	// SetPrivate hides the user's backpack from other members, or shows it again.
+	SetPrivate(userID UserID, private bool)
+	// Owners are the users with at least one of back in their backpack.
+	Owners(back model.Back) []UserID
+	// Gift moves one of back from one user's backpack to another's, as long as from
+	// has given fewer than limit backs on now's UTC day. Zero is no limit. It returns
+	// how many backs from has given that day, including this one. The gift is on disk
+	// by the time it returns.
+	Gift(from, to UserID, back model.Back, now time.Time, limit int) (int, error)
+	// Escrow moves one of back out of the user's backpack and into escrow, while it's
+	// listed on the market. Escrow, ReturnEscrow and Purchase are on disk by the time
+	// they return, so the market can order its own writes around them.
+	Escrow(userID UserID, back model.Back) error
+	// ReturnEscrow moves one of back out of escrow and back into the user's backpack.
+	ReturnEscrow(userID UserID, back model.Back) error
+	// Escrowed are the backs in escrow for every user who has any.
+	Escrowed() map[UserID]map[model.Back]int
+	// Purchase pays price from buyer's greenbacks to seller, and gives buyer one of
+	// back from seller's escrow.
+	Purchase(buyer, seller UserID, back model.Back, price int) error
 	// TODO: IMPL!
-	// AddGreenbacks(userID UserID, gb int)
 	// SubtractGreenbacks(userID UserID, gb int)
+	// Rollback empties the user's backpack, and their escrow with it.
 	Rollback(userID UserID)
 }
 
+// Errors returned by LootBag operations that can be refused.
+var (
+	ErrNotInBackpack       = errors.New("back isn't in the backpack")
+	ErrGiftLimit           = errors.New("daily gift limit reached")
+	ErrNotEnoughGreenbacks = errors.New("not enough greenbacks")
+	ErrNotInEscrow         = errors.New("back isn't in escrow")
+)
+
+// Checker is implemented by LootBags that can verify their backing store is usable.
+type Checker interface {
+	Check() error
+}
+
+// FlushReporter is implemented by LootBags that persist their state periodically,
+// reporting when they last did so successfully.
+type FlushReporter interface {
+	LastFlush() time.Time
+}
+
+// Shutdowner is implemented by LootBags that need to persist their state before exiting.
+type Shutdowner interface {
+	Shutdown() error
+}
+
 type FlushPolicy interface {
 	NotifyFlush()
 	ShouldFlush() bool
 }
 
+// NewStalenessFlushPolicy flushes whenever the last flush is older than threshold.
+func NewStalenessFlushPolicy(threshold time.Duration) FlushPolicy {
+	return &stalenessFlushPolicy{flushThreshold: threshold}
+}
+
 type stalenessFlushPolicy struct {
 	flushThreshold time.Duration
 	lastFlushed    time.Time
@@ -176,12 +416,20 @@ func (sfp *stalenessFlushPolicy) ShouldFlush() bool {
 }
 
 type csvLootBag struct {
+	path string
+	// mu guards userStates, and file, which is replaced on every flush
+	mu          sync.Mutex
 	file        *os.File
 	userStates  map[UserID]UserLootState
 	flushPolicy FlushPolicy
+	// unix nanos of the last successful flush, read concurrently by health checks
+	lastFlush atomic.Int64
 }
 
-var _ LootBag = new(csvLootBag) // *csvLootBag implements LootBag
+var _ LootBag = new(csvLootBag)       // *csvLootBag implements LootBag
+var _ Checker = new(csvLootBag)       // *csvLootBag implements Checker
+var _ FlushReporter = new(csvLootBag) // *csvLootBag implements FlushReporter
+var _ Shutdowner = new(csvLootBag)    // *csvLootBag implements Shutdowner
 
 func NewCsvLootBag(datapath string) (*csvLootBag, error) {
 	file, err := os.OpenFile(datapath, os.O_RDWR|os.O_CREATE, 0644)
@@ -207,8 +455,7 @@ func NewCsvLootBag(datapath string) (*csvLootBag, error) {
 
 		userID, restoredState, err := StateFromCSVRecord(record)
 		if err != nil {
-			// TODO: structured log
-			fmt.Printf("error restoring loot state from csv record. record: %v\n", record)
+			slog.Error("error restoring loot state from csv record", "record", record, logging.Err, err)
 			continue
 		}
 
@@ -216,23 +463,46 @@ func NewCsvLootBag(datapath string) (*csvLootBag, error) {
 	}
 
 	c := &csvLootBag{
+		path:        datapath,
 		file:        file,
 		userStates:  userStates,
 		flushPolicy: new(stalenessFlushPolicy),
 	}
+	c.updateUserCount()
 
 	return c, nil
 }
 
 func (c *csvLootBag) GetState(userID UserID) UserLootState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	defer c.maybeFlush()
 
-	return c.userStates[userID]
+	return c.userStates[userID].clone()
+}
+
+func (c *csvLootBag) Owners(back model.Back) []UserID {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var owners []UserID
+	for userID, state := range c.userStates {
+		if state.Loot[back] > 0 {
+			owners = append(owners, userID)
+		}
+	}
+	return owners
 }
 
 func (c *csvLootBag) AddLoot(userID UserID, loot model.Back) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	defer c.maybeFlush()
 
+	c.addLoot(userID, loot)
+}
+
+func (c *csvLootBag) addLoot(userID UserID, loot model.Back) {
 	state := c.userStates[userID]
 
 	if state.Loot == nil {
@@ -243,11 +513,18 @@ func (c *csvLootBag) AddLoot(userID UserID, loot model.Back) {
 
 	state.Loot[loot] = prevCount + 1
 	c.userStates[userID] = state
+	c.updateUserCount()
 }
 
 func (c *csvLootBag) RemoveLoot(userID UserID, loot model.Back) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	defer c.maybeFlush()
 
+	return c.removeLoot(userID, loot)
+}
+
+func (c *csvLootBag) removeLoot(userID UserID, loot model.Back) bool {
 	state := c.userStates[userID]
 
 	if state.Loot[loot] < 1 {
@@ -264,25 +541,273 @@ func (c *csvLootBag) RemoveLoot(userID UserID, loot model.Back) bool {
 	// all take direct effect on the Loot map, but why not be defensive
 	// against future quirks or changes to the logic?
 	c.userStates[userID] = state
+	c.updateUserCount()
 
 	return true
 }
 
-func (c *csvLootBag) Rollback(userID UserID) {
+func (c *csvLootBag) Gift(from, to UserID, back model.Back, now time.Time, limit int) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state := c.userStates[from]
+	gifts := state.GiftsToday(now)
+	if limit > 0 && gifts >= limit {
+		return gifts, ErrGiftLimit
+	}
+
+	before := c.snapshot(from, to)
+	if !c.removeLoot(from, back) {
+		return gifts, ErrNotInBackpack
+	}
+	c.addLoot(to, back)
+
+	state = c.userStates[from]
+	state.GiftsSent = gifts + 1
+	state.LastGift = now
+	c.userStates[from] = state
+
+	if err := c.flushOrUndo(before); err != nil {
+		return gifts, err
+	}
+	return state.GiftsSent, nil
+}
+
+func (c *csvLootBag) Escrow(userID UserID, back model.Back) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	before := c.snapshot(userID)
+	if !c.removeLoot(userID, back) {
+		return ErrNotInBackpack
+	}
+
+	state := c.userStates[userID]
+	if state.Escrow == nil {
+		state.Escrow = make(map[model.Back]int)
+	}
+	state.Escrow[back]++
+	c.userStates[userID] = state
+
+	return c.flushOrUndo(before)
+}
+
+func (c *csvLootBag) ReturnEscrow(userID UserID, back model.Back) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	before := c.snapshot(userID)
+	if !c.removeEscrow(userID, back) {
+		return ErrNotInEscrow
+	}
+	c.addLoot(userID, back)
+
+	return c.flushOrUndo(before)
+}
+
+func (c *csvLootBag) Escrowed() map[UserID]map[model.Back]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	escrowed := make(map[UserID]map[model.Back]int)
+	for userID, state := range c.userStates {
+		if len(state.Escrow) > 0 {
+			escrowed[userID] = maps.Clone(state.Escrow)
+		}
+	}
+	return escrowed
+}
+
+func (c *csvLootBag) Purchase(buyer, seller UserID, back model.Back, price int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.userStates[buyer].Greenbacks < price {
+		return ErrNotEnoughGreenbacks
+	}
+
+	before := c.snapshot(buyer, seller)
+	if !c.removeEscrow(seller, back) {
+		return ErrNotInEscrow
+	}
+
+	buyerState := c.userStates[buyer]
+	buyerState.Greenbacks -= price
+	c.userStates[buyer] = buyerState
+
+	sellerState := c.userStates[seller]
+	sellerState.Greenbacks += price
+	c.userStates[seller] = sellerState
+
+	c.addLoot(buyer, back)
+
+	return c.flushOrUndo(before)
+}
+
+func (c *csvLootBag) removeEscrow(userID UserID, back model.Back) bool {
+	state := c.userStates[userID]
+	if state.Escrow[back] < 1 {
+		return false
+	}
+
+	state.Escrow[back]--
+	if state.Escrow[back] < 1 {
+		delete(state.Escrow, back)
+	}
+	c.userStates[userID] = state
+	return true
+}
+
+// snapshot copies the users' states, so flushOrUndo can put them back. Users without
+// a state yet are nil.
+func (c *csvLootBag) snapshot(userIDs ...UserID) map[UserID]*UserLootState {
+	states := make(map[UserID]*UserLootState, len(userIDs))
+	for _, userID := range userIDs {
+		states[userID] = nil
+		if state, ok := c.userStates[userID]; ok {
+			state = state.clone()
+			states[userID] = &state
+		}
+	}
+	return states
+}
+
+// flushOrUndo flushes immediately, rather than following the flush policy. If the
+// flush fails, the users in snapshot are put back as they were, so nothing changes
+// in memory that isn't on disk.
+func (c *csvLootBag) flushOrUndo(snapshot map[UserID]*UserLootState) error {
+	err := c.flush()
+	if err == nil {
+		return nil
+	}
+
+	for userID, state := range snapshot {
+		if state == nil {
+			delete(c.userStates, userID)
+		} else {
+			c.userStates[userID] = *state
+		}
+	}
+	c.updateUserCount()
+	return err
+}
+
+func (c *csvLootBag) AddGreenbacks(userID UserID, gb int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	defer c.maybeFlush()
 
 	state := c.userStates[userID]
 
+	state.Greenbacks += gb
+	c.userStates[userID] = state
+	c.updateUserCount()
+}
+
+func (c *csvLootBag) ClaimDaily(userID UserID, now time.Time) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.maybeFlush()
+
+	state := c.userStates[userID]
+
+	if !state.LastDaily.IsZero() && daysBetween(state.LastDaily, now) < 1 {
+		return state.DailyStreak, false
+	}
+
+	state.DailyStreak = state.Streak(now) + 1
+	state.LastDaily = now
+	c.userStates[userID] = state
+	c.updateUserCount()
+
+	return state.DailyStreak, true
+}
+
+func (c *csvLootBag) SetPrivate(userID UserID, private bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.maybeFlush()
+
+	state := c.userStates[userID]
+
+	state.Private = private
+	c.userStates[userID] = state
+	c.updateUserCount()
+}
+
+func (c *csvLootBag) RecordRoll(userID UserID, rarity model.Rarity) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.maybeFlush()
+
+	state := c.userStates[userID]
+
+	if state.RollsSince == nil {
+		state.RollsSince = make(map[model.Rarity]int)
+	}
+	for _, r := range model.Rarities {
+		if r == rarity {
+			delete(state.RollsSince, r)
+		} else {
+			state.RollsSince[r]++
+		}
+	}
+	c.userStates[userID] = state
+	c.updateUserCount()
+}
+
+func (c *csvLootBag) Rollback(userID UserID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state := c.userStates[userID]
+
 	state.Loot = make(map[model.Back]int)
+	state.Escrow = nil
 	c.userStates[userID] = state
+	c.updateUserCount()
+
+	// flushed right away, like escrow, so that a crash can't bring back listed backs
+	// whose listings were already withdrawn
+	if err := c.flush(); err != nil {
+		slog.Error("errored while flushing csv loot state to disk after a rollback", logging.Err, err)
+	}
+}
+
+// Check verifies that the csv data file can still be read.
+func (c *csvLootBag) Check() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := c.file.Stat(); err != nil {
+		return fmt.Errorf("failed to stat csv loot bag data file: %w", err)
+	}
+
+	buf := make([]byte, 1)
+	if _, err := c.file.ReadAt(buf, 0); err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read csv loot bag data file: %w", err)
+	}
+
+	return nil
 }
 
 func (c *csvLootBag) Shutdown() error {
-	defer c.file.Close()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// flushing replaces the file, so close whichever one is open afterwards
+	defer func() { c.file.Close() }()
 
 	return c.flush()
 }
 
+func (c *csvLootBag) LastFlush() time.Time {
+	nanos := c.lastFlush.Load()
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
 func (c *csvLootBag) SetFlushPolicy(fp FlushPolicy) {
 	if fp != nil {
 		c.flushPolicy = fp
@@ -296,12 +821,23 @@ func (c *csvLootBag) maybeFlush() {
 
 	err := c.flush()
 	if err != nil {
-		// TODO: structured log
-		fmt.Printf("errored while flushing csv loot state to disk. err: %v\n", err)
+		slog.Error("errored while flushing csv loot state to disk", logging.Err, err)
 	}
 }
 
-func (c *csvLootBag) flush() error {
+func (c *csvLootBag) updateUserCount() {
+	metrics.LootStoreUsers.Set(float64(len(c.userStates)))
+}
+
+func (c *csvLootBag) flush() (err error) {
+	start := time.Now()
+	defer func() {
+		metrics.LootStoreFlushSeconds.Observe(time.Since(start).Seconds())
+		if err != nil {
+			metrics.LootStoreFlushErrors.Inc()
+		}
+	}()
+
 	var records [][]string
 
 	for userID, userState := range c.userStates {
@@ -323,23 +859,56 @@ func (c *csvLootBag) flush() error {
 	// if we try again soon after.
 	c.flushPolicy.NotifyFlush()
 
-	// Set the file's write head back to the top
-	_, err := c.file.Seek(0, 0)
+	// Write to a new file and swap it into place, so that a crash mid-flush leaves
+	// either the old loot state or the new one on disk, never a mix of the two
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".tmp*")
 	if err != nil {
-		return fmt.Errorf("CRITICAL: could not reset file for flushing to csv. err: %w", err)
+		return fmt.Errorf("CRITICAL: could not create file for flushing to csv. err: %w", err)
+	}
+	renamed := false
+	defer func() {
+		if !renamed {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	err = tmp.Chmod(0644)
+	if err != nil {
+		return fmt.Errorf("error while setting csv file permissions. err: %w", err)
 	}
 
 	// Write the contents of the buffer to the file
-	writtenBytes, err := buf.WriteTo(c.file)
+	_, err = buf.WriteTo(tmp)
 	if err != nil {
 		return fmt.Errorf("CRITICAL: error while flushing csv buffer to file. err: %w", err)
 	}
 
-	// Truncate the file to what was written
-	err = c.file.Truncate(writtenBytes)
+	// Make sure the contents are on disk before the file replaces the old one
+	err = tmp.Sync()
+	if err != nil {
+		return fmt.Errorf("CRITICAL: error while syncing csv file to disk. err: %w", err)
+	}
+
+	err = os.Rename(tmp.Name(), c.path)
 	if err != nil {
-		return fmt.Errorf("error while truncating csv file to fit buffer. err: %w", err)
+		return fmt.Errorf("CRITICAL: could not replace csv file. err: %w", err)
+	}
+	renamed = true
+
+	// The new file is the data file now
+	c.file.Close()
+	c.file = tmp
+
+	// Persist the rename itself. The flush already took effect, so this is only logged
+	if dir, err := os.Open(filepath.Dir(c.path)); err == nil {
+		if err := dir.Sync(); err != nil {
+			slog.Warn("failed to sync csv loot bag directory after flushing", logging.Err, err)
+		}
+		dir.Close()
 	}
 
+	c.lastFlush.Store(time.Now().UnixNano())
+
 	return nil
 }
@@ -3,9 +3,13 @@ package loot
 import (
 	"back-bot/backs/model"
 	"encoding/csv"
+	"io"
+	"maps"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 )
 
 func testBack(path string) model.Back {
@@ -66,6 +70,56 @@ func TestStateFromCSVRecord(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			record:         []string{"bigback", "0", "@daily_streak", "3", "@last_daily", "2024-03-01T12:00:00Z", "a", "1"},
+			expectedUserID: "bigback",
+			expectedState: UserLootState{
+				Greenbacks:  0,
+				Loot:        map[model.Back]int{testBack("a"): 1},
+				DailyStreak: 3,
+				LastDaily:   time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+			},
+			wantErr: false,
+		},
+		{
+			record:         []string{"bigback", "0", "@since:Rare", "12", "@since:Mythic", "3", "a", "1"},
+			expectedUserID: "bigback",
+			expectedState: UserLootState{
+				Greenbacks: 0,
+				Loot:       map[model.Back]int{testBack("a"): 1},
+				RollsSince: map[model.Rarity]int{model.Rare: 12},
+			},
+			wantErr: false,
+		},
+		{
+			record:         []string{"bigback", "0", "@private", "true", "a", "1"},
+			expectedUserID: "bigback",
+			expectedState: UserLootState{
+				Greenbacks: 0,
+				Loot:       map[model.Back]int{testBack("a"): 1},
+				Private:    true,
+			},
+			wantErr: false,
+		},
+		{
+			record:         []string{"bigback", "0", "@escrow:Rare/welcome_back.dca", "2", "a", "1"},
+			expectedUserID: "bigback",
+			expectedState: UserLootState{
+				Greenbacks: 0,
+				Loot:       map[model.Back]int{testBack("a"): 1},
+				Escrow:     map[model.Back]int{testBack("Rare/welcome_back.dca"): 2},
+			},
+			wantErr: false,
+		},
+		{
+			record:         []string{"bigback", "0", "@mystery", "1", "a", "1"},
+			expectedUserID: "bigback",
+			expectedState: UserLootState{
+				Greenbacks: 0,
+				Loot:       map[model.Back]int{testBack("a"): 1},
+			},
+			wantErr: false,
+		},
 		{
 			record:         []string{"bigback", "0", "a", "1", "b", ":()", "c", "419"},
 			expectedUserID: "bigback",
@@ -88,11 +142,23 @@ func TestStateFromCSVRecord(t *testing.T) {
 			t.Fatalf("actual state greenbacks (%v) does not match expected (%v)", actualState.Greenbacks, c.expectedState.Greenbacks)
 		}
 
+		if actualState.DailyStreak != c.expectedState.DailyStreak || !actualState.LastDaily.Equal(c.expectedState.LastDaily) {
+			t.Fatalf("actual daily state (%v, %v) does not match expected (%v, %v)", actualState.DailyStreak, actualState.LastDaily, c.expectedState.DailyStreak, c.expectedState.LastDaily)
+		}
+
+		if actualState.Private != c.expectedState.Private {
+			t.Fatalf("actual privacy (%v) does not match expected (%v)", actualState.Private, c.expectedState.Private)
+		}
+
 		mapLenEquals := len(actualState.Loot) == len(c.expectedState.Loot)
 		if !mapLenEquals {
 			t.Fatalf("actual state loot map (%v) is different length from expected (%v)", actualState.Loot, c.expectedState.Loot)
 		}
 
+		if !maps.Equal(actualState.RollsSince, c.expectedState.RollsSince) {
+			t.Fatalf("actual rolls since (%v) do not match expected (%v)", actualState.RollsSince, c.expectedState.RollsSince)
+		}
+
 		for k, v := range c.expectedState.Loot {
 			vv, found := actualState.Loot[k]
 			if !found || v != vv {
@@ -138,6 +204,19 @@ func TestCSVRecordFromState(t *testing.T) {
 			},
 			expectedRecord: []string{"bigback", "419", "aa", "10", "ab", "3", "zza", "5", "zzz", "1"},
 		},
+		{
+			userID: "bigback",
+			state: UserLootState{
+				Greenbacks:  20,
+				Loot:        map[model.Back]int{testBack("aa"): 1},
+				DailyStreak: 2,
+				LastDaily:   time.Date(2024, 3, 1, 12, 0, 0, 0, time.FixedZone("UTC+1", 3600)),
+				RollsSince:  map[model.Rarity]int{model.Common: 0, model.Rare: 7, model.Rollback: 30},
+				Private:     true,
+				Escrow:      map[model.Back]int{testBack("zz"): 1, testBack("ab"): 2, testBack("ac"): 0},
+			},
+			expectedRecord: []string{"bigback", "20", "@daily_streak", "2", "@last_daily", "2024-03-01T11:00:00Z", "@since:Rollback", "30", "@since:Rare", "7", "@private", "true", "@escrow:ab", "2", "@escrow:zz", "1", "aa", "1"},
+		},
 	}
 
 	for _, c := range cases {
@@ -155,6 +234,285 @@ func TestCSVRecordFromState(t *testing.T) {
 	}
 }
 
+func TestClaimDaily(t *testing.T) {
+	csvLB, err := NewCsvLootBag(filepath.Join(t.TempDir(), "loot.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	csvLB.SetFlushPolicy(testFlushPolicy(false))
+
+	day := func(d, hour int) time.Time { return time.Date(2024, 3, d, hour, 0, 0, 0, time.UTC) }
+
+	claims := []struct {
+		at             time.Time
+		expectedStreak int
+		expectedOK     bool
+	}{
+		{day(1, 23), 1, true},
+		{day(1, 23), 1, false}, // same day
+		{day(2, 0), 2, true},   // just after midnight counts as the next day
+		{day(3, 12), 3, true},
+		{day(3, 13), 3, false},
+		{day(5, 12), 1, true}, // missed the 4th
+	}
+
+	for _, c := range claims {
+		streak, ok := csvLB.ClaimDaily("bigback", c.at)
+		if streak != c.expectedStreak || ok != c.expectedOK {
+			t.Fatalf("claim at %v: expected (%v, %v), got (%v, %v)", c.at, c.expectedStreak, c.expectedOK, streak, ok)
+		}
+	}
+
+	state := csvLB.GetState("bigback")
+	if state.Streak(day(6, 12)) != 1 || state.Streak(day(7, 0)) != 0 {
+		t.Fatalf("expected streak to survive one day and reset after a missed day, got %v and %v", state.Streak(day(6, 12)), state.Streak(day(7, 0)))
+	}
+}
+
+func TestRecordRoll(t *testing.T) {
+	csvLB, err := NewCsvLootBag(filepath.Join(t.TempDir(), "loot.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	csvLB.SetFlushPolicy(testFlushPolicy(false))
+
+	for _, rarity := range []model.Rarity{model.Common, model.Common, model.Rare, model.Uncommon} {
+		csvLB.RecordRoll("bigback", rarity)
+	}
+
+	expected := map[model.Rarity]int{model.Rollback: 4, model.Rare: 1, model.Common: 2}
+	if actual := csvLB.GetState("bigback").RollsSince; !maps.Equal(actual, expected) {
+		t.Fatalf("expected rolls since %v, got %v", expected, actual)
+	}
+}
+
+func TestGift(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "loot.csv")
+	csvLB, err := NewCsvLootBag(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// gifts are flushed immediately, whatever the flush policy
+	csvLB.SetFlushPolicy(testFlushPolicy(false))
+
+	back := testBack("Rare/welcome_back.dca")
+	csvLB.AddLoot("bigback", back)
+	csvLB.AddLoot("bigback", back)
+	csvLB.AddLoot("bigback", back)
+
+	day := func(d, hour int) time.Time { return time.Date(2024, 3, d, hour, 0, 0, 0, time.UTC) }
+
+	gifts := []struct {
+		at            time.Time
+		expectedGifts int
+		expectedErr   error
+	}{
+		{day(1, 12), 1, nil},
+		{day(1, 13), 2, nil},
+		{day(1, 14), 2, ErrGiftLimit},
+		{day(2, 0), 1, nil}, // a new day
+		{day(2, 1), 1, ErrNotInBackpack},
+	}
+
+	for _, c := range gifts {
+		count, err := csvLB.Gift("bigback", "smallback", back, c.at, 2)
+		if count != c.expectedGifts || err != c.expectedErr {
+			t.Fatalf("gift at %v: expected (%v, %v), got (%v, %v)", c.at, c.expectedGifts, c.expectedErr, count, err)
+		}
+	}
+
+	reopened, err := NewCsvLootBag(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sender, recipient := reopened.GetState("bigback"), reopened.GetState("smallback"); sender.Loot[back] != 0 || recipient.Loot[back] != 3 || sender.GiftsToday(day(2, 1)) != 1 {
+		t.Fatalf("expected every back to move to the recipient on disk, got %v and %v", sender.Loot, recipient.Loot)
+	}
+}
+
+func TestEscrow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "loot.csv")
+	csvLB, err := NewCsvLootBag(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// escrow is flushed immediately, whatever the flush policy
+	csvLB.SetFlushPolicy(testFlushPolicy(false))
+
+	back := testBack("Rare/welcome_back.dca")
+	csvLB.AddLoot("parkour", back)
+	csvLB.AddLoot("parkour", back)
+	csvLB.AddGreenbacks("bigback", 150)
+
+	if err := csvLB.Escrow("parkour", back); err != nil {
+		t.Fatal(err)
+	}
+	if err := csvLB.Escrow("bigback", back); err != ErrNotInBackpack {
+		t.Fatalf("expected escrow without the back to be refused, got %v", err)
+	}
+
+	reopened, err := NewCsvLootBag(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := reopened.GetState("parkour"); state.Loot[back] != 1 || state.Escrow[back] != 1 {
+		t.Fatalf("expected the escrow to be on disk, got %v and %v in escrow", state.Loot, state.Escrow)
+	}
+
+	if err := csvLB.Purchase("bigback", "parkour", back, 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := csvLB.Purchase("bigback", "parkour", back, 10); err != ErrNotInEscrow {
+		t.Fatalf("expected a purchase of a back that isn't in escrow to be refused, got %v", err)
+	}
+	if err := csvLB.Escrow("parkour", back); err != nil {
+		t.Fatal(err)
+	}
+	if err := csvLB.Purchase("bigback", "parkour", back, 100); err != ErrNotEnoughGreenbacks {
+		t.Fatalf("expected purchase to be refused, got %v", err)
+	}
+	if escrowed := csvLB.Escrowed(); len(escrowed) != 1 || escrowed["parkour"][back] != 1 {
+		t.Fatalf("expected one back in escrow, got %v", escrowed)
+	}
+	if err := csvLB.ReturnEscrow("parkour", back); err != nil {
+		t.Fatal(err)
+	}
+	if err := csvLB.ReturnEscrow("parkour", back); err != ErrNotInEscrow {
+		t.Fatalf("expected returning a back that isn't in escrow to be refused, got %v", err)
+	}
+
+	reopened, err = NewCsvLootBag(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buyer, seller := reopened.GetState("bigback"), reopened.GetState("parkour")
+	if buyer.Greenbacks != 50 || buyer.Loot[back] != 1 {
+		t.Fatalf("expected the buyer to pay for one back, got %v greenbacks and %v", buyer.Greenbacks, buyer.Loot)
+	}
+	if seller.Greenbacks != 100 || seller.Loot[back] != 1 || len(seller.Escrow) != 0 {
+		t.Fatalf("expected the seller to be paid once and keep the other back, got %v greenbacks, %v and %v in escrow", seller.Greenbacks, seller.Loot, seller.Escrow)
+	}
+}
+
+func TestRollbackTakesEscrow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "loot.csv")
+	csvLB, err := NewCsvLootBag(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csvLB.SetFlushPolicy(testFlushPolicy(false))
+
+	back := testBack("Rare/welcome_back.dca")
+	csvLB.AddLoot("parkour", back)
+	csvLB.AddLoot("parkour", back)
+	if err := csvLB.Escrow("parkour", back); err != nil {
+		t.Fatal(err)
+	}
+
+	csvLB.Rollback("parkour")
+	if err := csvLB.ReturnEscrow("parkour", back); err != ErrNotInEscrow {
+		t.Fatalf("expected nothing to return from escrow after a rollback, got %v", err)
+	}
+
+	// rollbacks are flushed right away, whatever the flush policy
+	reopened, err := NewCsvLootBag(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := reopened.GetState("parkour"); len(state.Loot) != 0 || len(state.Escrow) != 0 {
+		t.Fatalf("expected the rollback to take the backpack and escrow, got %v and %v in escrow", state.Loot, state.Escrow)
+	}
+}
+
+func TestTransfersUndoneWhenFlushFails(t *testing.T) {
+	csvLB, err := NewCsvLootBag(filepath.Join(t.TempDir(), "loot.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	csvLB.SetFlushPolicy(testFlushPolicy(false))
+
+	back := testBack("Rare/welcome_back.dca")
+	csvLB.AddLoot("parkour", back)
+	if err := csvLB.Escrow("parkour", back); err != nil {
+		t.Fatal(err)
+	}
+	csvLB.AddLoot("parkour", back)
+
+	// points the loot bag somewhere it can't write, so flushing fails
+	csvLB.path = filepath.Join(t.TempDir(), "missing", "loot.csv")
+
+	if err := csvLB.Purchase("newbie", "parkour", back, 0); err == nil || err == ErrNotInEscrow {
+		t.Fatalf("expected the purchase to fail to flush, got %v", err)
+	}
+	if err := csvLB.ReturnEscrow("parkour", back); err == nil || err == ErrNotInEscrow {
+		t.Fatalf("expected returning the back to fail to flush, got %v", err)
+	}
+	if err := csvLB.Escrow("parkour", back); err == nil || err == ErrNotInBackpack {
+		t.Fatalf("expected escrow to fail to flush, got %v", err)
+	}
+	if count, err := csvLB.Gift("parkour", "newbie", back, time.Now(), 0); err == nil || err == ErrNotInBackpack || count != 0 {
+		t.Fatalf("expected the gift to fail to flush, got (%v, %v)", count, err)
+	}
+
+	if state := csvLB.GetState("parkour"); state.Loot[back] != 1 || state.Escrow[back] != 1 || state.GiftsToday(time.Now()) != 0 {
+		t.Fatalf("expected every failed change to be undone, got %v and %v in escrow", state.Loot, state.Escrow)
+	}
+	if _, ok := csvLB.userStates["newbie"]; ok {
+		t.Fatal("expected no state to be left for a buyer or recipient whose change was undone")
+	}
+}
+
+func TestFlushReplacesFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "loot.csv")
+	csvLB, err := NewCsvLootBag(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csvLB.SetFlushPolicy(testFlushPolicy(true))
+
+	back := testBack("Rare/welcome_back.dca")
+	csvLB.AddLoot("parkour", back)
+
+	// the file from before a flush is left whole, rather than rewritten in place
+	before, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer before.Close()
+	csvLB.AddGreenbacks("parkour", 100)
+
+	old, err := io.ReadAll(before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "parkour,0,Rare/welcome_back.dca,1\n"; string(old) != expected {
+		t.Errorf("expected the old file to be untouched, got %q", old)
+	}
+
+	reopened, err := NewCsvLootBag(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := reopened.GetState("parkour"); state.Greenbacks != 100 || state.Loot[back] != 1 {
+		t.Errorf("expected the flush to be on disk, got %v greenbacks and %v", state.Greenbacks, state.Loot)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected no temporary files to be left behind, got %v", entries)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0644 {
+		t.Errorf("expected the file to keep its permissions, got %v", info.Mode())
+	}
+	if err := csvLB.Check(); err != nil {
+		t.Errorf("expected the flushed file to be readable, got %v", err)
+	}
+}
+
 type testFlushPolicy bool
 
 func (t testFlushPolicy) ShouldFlush() bool { return bool(t) }
@@ -251,6 +609,14 @@ func TestCsvLootBag(t *testing.T) {
 			t.Fatalf("expected %v count for back %v, got %v", 1, testback3, state.Loot[testback3])
 		}
 
+		csvLB.AddGreenbacks("bigback", 25)
+		csvLB.AddGreenbacks("bigback", 25)
+
+		state = csvLB.GetState("bigback")
+		if state.Greenbacks != 50 {
+			t.Fatalf("expected %v greenbacks, got %v", 50, state.Greenbacks)
+		}
+
 		csvLB.Rollback("bigback")
 
 		state = csvLB.GetState("bigback")
@@ -337,3 +703,33 @@ func TestCsvLootBag(t *testing.T) {
 		}
 	})
 }
+
+func TestCsvLootBagConcurrentAccess(t *testing.T) {
+	csvLB, err := NewCsvLootBag(filepath.Join(t.TempDir(), "loot.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	csvLB.SetFlushPolicy(testFlushPolicy(true))
+
+	back := testBack("Rare/welcome_back.dca")
+
+	// command handlers each run on their own goroutine
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				csvLB.AddLoot("bigback", back)
+				for range csvLB.GetState("bigback").Loot {
+				}
+				csvLB.RemoveLoot("bigback", back)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if state := csvLB.GetState("bigback"); state.Loot[back] != 0 {
+		t.Fatalf("expected every back added to be removed, got %v", state.Loot)
+	}
+}
@@ -3,9 +3,16 @@ package backs
 import (
 	"back-bot/backs/loot"
 	"back-bot/backs/model"
+	"back-bot/logging"
+	"back-bot/metrics"
 	"fmt"
 	"io/fs"
+	"log/slog"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/bwmarrin/discordgo"
 )
@@ -13,13 +20,48 @@ import (
 // need an addressable "false" for DMPermission field
 var falseVar bool
 
-var backpackCmd = &discordgo.ApplicationCommand{
+var BackpackCmd = &discordgo.ApplicationCommand{
 	Name:         "backpack",
-	Description:  "View your backpack",
+	Description:  "View your backpack, or someone else's",
 	Type:         discordgo.ChatApplicationCommand,
 	DMPermission: &falseVar,
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionUser,
+			Name:        "user",
+			Description: "Whose backpack to look in",
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionBoolean,
+			Name:        "public",
+			Description: "Show the backpack to everyone in the channel",
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "privacy",
+			Description: "Hide your backpack from other members, or let them see it again",
+			Choices: []*discordgo.ApplicationCommandOptionChoice{
+				{Name: "hidden", Value: backpackHidden},
+				{Name: "visible", Value: backpackVisible},
+			},
+		},
+	},
 }
-var playbackCmd = &discordgo.ApplicationCommand{
+
+// ViewBackpackCmd is a user context menu command for looking in a member's backpack.
+var ViewBackpackCmd = &discordgo.ApplicationCommand{
+	Name:         "View backpack",
+	Type:         discordgo.UserApplicationCommand,
+	DMPermission: &falseVar,
+}
+
+// values of the /backpack privacy option
+const (
+	backpackHidden  = "hidden"
+	backpackVisible = "visible"
+)
+
+var PlaybackCmd = &discordgo.ApplicationCommand{
 	Name:         "playback",
 	Description:  "Play one of the backs from your backpack",
 	Type:         discordgo.ChatApplicationCommand,
@@ -34,7 +76,7 @@ var playbackCmd = &discordgo.ApplicationCommand{
 		},
 	},
 }
-var rollbackCmd = &discordgo.ApplicationCommand{
+var RollbackCmd = &discordgo.ApplicationCommand{
 	Name:         "rollback",
 	Description:  "It's time to go back to the way things were",
 	Type:         discordgo.ChatApplicationCommand,
@@ -42,220 +84,332 @@ var rollbackCmd = &discordgo.ApplicationCommand{
 }
 
 type LootCommands interface {
-	RegisterCommands(s *discordgo.Session) error
 	Backpack(s *discordgo.Session, i *discordgo.InteractionCreate)
+	ViewBackpack(s *discordgo.Session, i *discordgo.InteractionCreate)
+	BackpackPage(s *discordgo.Session, i *discordgo.InteractionCreate)
 	Playback(s *discordgo.Session, i *discordgo.InteractionCreate)
+	PlaybackAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate)
 	Rollback(s *discordgo.Session, i *discordgo.InteractionCreate)
 }
 
 type lootCmdHandler struct {
-	lootBag loot.LootBag
-	backfs  fs.FS
-	backs   BackMapping
+	lootBag  loot.LootBag
+	backfs   fs.FS
+	backs    BackMapping
+	provider BackProvider
+	pity     PityRules
+	// beforeRollback runs before /rollback takes a user's loot, if set
+	beforeRollback func(userID loot.UserID)
 }
 
 func NewLootCmdHandler(lb loot.LootBag, backfs fs.FS, provider BackProvider) *lootCmdHandler {
 	return &lootCmdHandler{
-		lootBag: lb,
-		backfs:  backfs,
-		backs:   provider.Backs(),
+		lootBag:  lb,
+		backfs:   backfs,
+		backs:    provider.Backs(),
+		provider: provider,
 	}
 }
 
+// SetPity shows users their progress towards the rarities with pity in their backpacks.
+func (l *lootCmdHandler) SetPity(rules PityRules) {
+	l.pity = rules
+}
+
+// OnRollback runs hook before /rollback takes the user's loot.
+func (l *lootCmdHandler) OnRollback(hook func(userID loot.UserID)) {
+	l.beforeRollback = hook
+}
+
 var _ LootCommands = new(lootCmdHandler) // *lootCmdHandler implements LootCommands
 
 func (l *lootCmdHandler) Backpack(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	user := i.Member.User
-	if user == nil {
-		// in DM context, User is populated instead of Member. yeah I don't know.
-		user = i.User
+	metrics.CommandInvocations.With(BackpackCmd.Name).Inc()
+
+	data := i.ApplicationCommandData()
+	viewer := interactionUser(i)
+	owner := viewer
+	var public bool
+
+	for _, option := range data.Options {
+		switch option.Name {
+		case "user":
+			owner = resolvedUser(data, option.Value.(string))
+		case "public":
+			public = option.BoolValue()
+		case "privacy":
+			private := option.StringValue() == backpackHidden
+			l.lootBag.SetPrivate(loot.UserID(viewer.ID), private)
+			slog.Info("backpack privacy changed", append(logging.InteractionAttrs(i), "private", private)...)
+		}
 	}
 
-	userID := loot.UserID(user.ID)
-	userState := l.lootBag.GetState(userID)
+	l.respondBackpack(s, i, discordgo.InteractionResponseChannelMessageWithSource, owner, 0, !public)
+}
 
-	lootByRarity := userState.LootByRarity()
-
-	var content strings.Builder
-	w := func(s string, args ...any) { fmt.Fprintf(&content, s, args...) }
-	wln := func(s string, args ...any) { s = s + "\n"; w(s, args...) }
-
-	// TODO: improvements to message content:
-	//   * empty states
-	//   * color for different rarities
-	//   * more compact columnar layout (look at https://pkg.go.dev/text/tabwriter)
-	wln("%s's loot:", user.Username)
-	wln("Rare (%d each):", model.RarityLootValues[model.Rare])
-	for _, lootItem := range lootByRarity[model.Rare] {
-		if lootItem.Count > 0 {
-			wln("🔙 %s: %d", lootItem.Back.Filename(), lootItem.Count)
-		}
-	}
+// ViewBackpack shows a member's backpack from the user context menu.
+func (l *lootCmdHandler) ViewBackpack(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	metrics.CommandInvocations.With(ViewBackpackCmd.Name).Inc()
 
-	wln("")
-	wln("Uncommon (%d each):", model.RarityLootValues[model.Uncommon])
-	for _, lootItem := range lootByRarity[model.Uncommon] {
-		if lootItem.Count > 0 {
-			wln("🔙 %s: %d", lootItem.Back.Filename(), lootItem.Count)
-		}
+	data := i.ApplicationCommandData()
+	l.respondBackpack(s, i, discordgo.InteractionResponseChannelMessageWithSource, resolvedUser(data, data.TargetID), 0, true)
+}
+
+// BackpackPage turns to another page of a backpack, from its buttons.
+func (l *lootCmdHandler) BackpackPage(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	// custom IDs look like "backpack:page:<owner ID>:<page>"
+	segments := strings.Split(i.MessageComponentData().CustomID, ":")
+	if len(segments) != 4 {
+		slog.Error("malformed backpack page button", logging.InteractionAttrs(i)...)
+		return
+	}
+	page, err := strconv.Atoi(segments[3])
+	if err != nil {
+		slog.Error("malformed backpack page button", append(logging.InteractionAttrs(i), logging.Err, err)...)
+		return
 	}
 
-	wln("")
-	wln("Common (%d each):", model.RarityLootValues[model.Common])
-	for _, lootItem := range lootByRarity[model.Common] {
-		if lootItem.Count > 0 {
-			wln("🔙 %s: %d", lootItem.Back.Filename(), lootItem.Count)
-		}
+	owner := interactionUser(i)
+	if ownerID := segments[2]; ownerID != owner.ID {
+		owner = lookUpUser(s, i.GuildID, ownerID)
 	}
 
-	wln("")
-	wln("Total nominal value is %d greenbacks", userState.RarityPoints())
+	// updating a message keeps it ephemeral or public, whatever it was
+	l.respondBackpack(s, i, discordgo.InteractionResponseUpdateMessage, owner, page, false)
+}
 
+// respondBackpack shows page of owner's backpack, unless they've hidden it from the interacting user.
+func (l *lootCmdHandler) respondBackpack(s *discordgo.Session, i *discordgo.InteractionCreate, responseType discordgo.InteractionResponseType, owner *discordgo.User, page int, ephemeral bool) {
 	resp := &discordgo.InteractionResponse{
-		Type: discordgo.InteractionResponseChannelMessageWithSource,
-		Data: &discordgo.InteractionResponseData{
-			Flags:   discordgo.MessageFlagsEphemeral,
-			Content: content.String(),
-		},
+		Type: responseType,
+		Data: &discordgo.InteractionResponseData{},
+	}
+	if ephemeral {
+		resp.Data.Flags = discordgo.MessageFlagsEphemeral
+	}
+
+	userState := l.lootBag.GetState(loot.UserID(owner.ID))
+	if userState.Private && owner.ID != interactionUser(i).ID {
+		// never reveal a private backpack, even to those who could see it before
+		resp.Data.Flags = discordgo.MessageFlagsEphemeral
+		resp.Data.Content = fmt.Sprintf("%s keeps their backpack private.", owner.Username)
+		resp.Data.Embeds = []*discordgo.MessageEmbed{}
+		resp.Data.Components = []discordgo.MessageComponent{}
+		if responseType == discordgo.InteractionResponseUpdateMessage {
+			// don't touch the original message, which is someone else's to page through
+			resp.Type = discordgo.InteractionResponseChannelMessageWithSource
+		}
+	} else {
+		pages := backpackPages(owner.Username, userState, l.provider.DisplayName, l.pity, time.Now())
+		// the backpack may have shrunk since the buttons were sent
+		page = max(min(page, len(pages)-1), 0)
+		resp.Data.Embeds = pages[page]
+		resp.Data.Components = backpackButtons(owner.ID, page, len(pages))
 	}
 
 	err := s.InteractionRespond(i.Interaction, resp)
 	if err != nil {
-		// TODO: structured logging
-		fmt.Printf("error responding to /backpack command: %v\n", err)
+		slog.Error("error responding to /backpack command", append(logging.InteractionAttrs(i), logging.Err, err)...)
 	}
 }
 
-func (l *lootCmdHandler) Playback(s *discordgo.Session, i *discordgo.InteractionCreate) {
+// interactionUser is the user who made the interaction.
+func interactionUser(i *discordgo.InteractionCreate) *discordgo.User {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User
+	}
+	// in DM context, User is populated instead of Member. yeah I don't know.
+	return i.User
+}
+
+// resolvedUser finds a user mentioned in a command's options or targeted by a context menu.
+func resolvedUser(data discordgo.ApplicationCommandInteractionData, userID string) *discordgo.User {
+	if data.Resolved != nil {
+		if user, ok := data.Resolved.Users[userID]; ok {
+			return user
+		}
+	}
+	return &discordgo.User{ID: userID, Username: "Someone"}
+}
+
+// lookUpUser finds a guild member, preferring the session's cache over asking Discord.
+func lookUpUser(s *discordgo.Session, guildID, userID string) *discordgo.User {
+	if member, err := s.State.Member(guildID, userID); err == nil && member.User != nil {
+		return member.User
+	}
+	if user, err := s.User(userID); err == nil {
+		return user
+	}
+	return &discordgo.User{ID: userID, Username: "Someone"}
+}
+
+// PlaybackAutocomplete generates and presents autocomplete results for /playback
+func (l *lootCmdHandler) PlaybackAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	// Command only allowed in channels, so user will be in Member field
 	userID := loot.UserID(i.Member.User.ID)
 	userState := l.lootBag.GetState(userID)
 	userInput := i.ApplicationCommandData().Options[0].StringValue()
 
-	// Handle generating and presenting autocomplete results
-	if i.Type == discordgo.InteractionApplicationCommandAutocomplete {
-
-		var choices []*discordgo.ApplicationCommandOptionChoice
-		for back, count := range userState.Loot {
-			if count < 1 {
-				continue
-			}
-
-			if strings.Contains(back.Backname(), userInput) {
-				choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
-					Name:  back.Backname(),
-					Value: back.Path(),
-				})
-			}
+	respondChoices(s, i, backpackChoices(l.provider, userState, userInput))
+}
+
+// backpackChoices are the backs in a backpack that fuzzily match input, best matches
+// first, then the backs the user has most of, then by name and path.
+func backpackChoices(provider BackProvider, state loot.UserLootState, input string) []*discordgo.ApplicationCommandOptionChoice {
+	type match struct {
+		back  model.Back
+		name  string
+		count int
+		score int
+	}
+	var matches []match
+	for back, count := range state.Loot {
+		if count < 1 {
+			continue
 		}
 
-		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionApplicationCommandAutocompleteResult,
-			Data: &discordgo.InteractionResponseData{
-				Choices: choices,
-			},
-		})
-		if err != nil {
-			// TODO: structured logging
-			fmt.Printf("failed to send autocomplete response. username: %v input: %v err: %v\n", i.Member.User.Username, userInput, err)
+		name := provider.DisplayName(back)
+		score, ok := fuzzyScore(input, name)
+		if fileScore, fileOK := fuzzyScore(input, back.Backname()); fileOK && (!ok || fileScore > score) {
+			score, ok = fileScore, true
+		}
+		if ok {
+			matches = append(matches, match{back: back, name: name, count: count, score: score})
 		}
 	}
 
-	// Handle user's definitive selection of an option from autocomplete results
-	if i.Type == discordgo.InteractionApplicationCommand {
-		// userInput should be a valid back path from their loot
-		back, err := model.GetBack(userInput)
-		if err != nil {
-			s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-				Type: discordgo.InteractionResponseChannelMessageWithSource,
-				Data: &discordgo.InteractionResponseData{
-					Flags:   discordgo.MessageFlagsEphemeral,
-					Content: fmt.Sprintf("%s is not a valid back path!", userInput),
-				},
-			})
-			return
+	slices.SortFunc(matches, func(a, b match) int {
+		if a.score != b.score {
+			return b.score - a.score
 		}
-
-		count, ok := userState.Loot[back]
-		if count < 1 || !ok {
-			s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-				Type: discordgo.InteractionResponseChannelMessageWithSource,
-				Data: &discordgo.InteractionResponseData{
-					Flags:   discordgo.MessageFlagsEphemeral,
-					Content: fmt.Sprintf("you don't appear to have %s in your backpack! back off!", back.Backname()),
-				},
-			})
-			return
+		if a.count != b.count {
+			return b.count - a.count
+		}
+		if a.name != b.name {
+			return strings.Compare(a.name, b.name)
 		}
+		// backs can share a display name, so the order falls back on their unique paths
+		return strings.Compare(a.back.Path(), b.back.Path())
+	})
 
-		// TODO: maybe we should just do this at the end instead of having
-		// logic to undo it. oh well
-		l.lootBag.RemoveLoot(userID, back)
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, min(len(matches), maxChoices))
+	for _, m := range matches[:min(len(matches), maxChoices)] {
+		suffix := fmt.Sprintf(" (%s ×%d)", m.back.Rarity(), m.count)
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			// Discord limits choice names to 100 characters
+			Name:  truncate(m.name, 100-utf8.RuneCountInString(suffix)) + suffix,
+			Value: m.back.Path(),
+		})
+	}
+	return choices
+}
 
-		var playbackFailed bool
-		defer func() {
-			if playbackFailed {
-				l.lootBag.AddLoot(userID, back)
-			}
-		}()
+// Playback handles the user's definitive selection of an option from autocomplete results
+func (l *lootCmdHandler) Playback(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	logger := slog.With(logging.InteractionAttrs(i)...)
+	metrics.CommandInvocations.With(PlaybackCmd.Name).Inc()
 
-		backData, err := loadBack(l.backfs, back.Path())
-		if err != nil {
-			playbackFailed = true
-			// TODO: structured logging
-			fmt.Printf("failed to load back data while handling /playback. path: %v err: %v\n", back.Path(), err)
-			return
-		}
-		vs, err := retrieveVoiceStateForPlayback(s, i.Member.User.ID, i.ChannelID)
-		if err != nil {
-			playbackFailed = true
-			// TODO: structured logging
-			fmt.Printf("failed to retrieve voice state for playback. username: %v channelID: %v err: %v\n", i.Member.User.ID, i.ChannelID, err)
-			return
-		}
+	// Command only allowed in channels, so user will be in Member field
+	userID := loot.UserID(i.Member.User.ID)
+	userState := l.lootBag.GetState(userID)
+	userInput := i.ApplicationCommandData().Options[0].StringValue()
 
-		if vs == nil {
-			playbackFailed = true
-			s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-				Type: discordgo.InteractionResponseChannelMessageWithSource,
-				Data: &discordgo.InteractionResponseData{
-					Content: fmt.Sprintf("Hey %s, get back in a voice channel if you want playback.", i.Member.User.Username),
-				},
-			})
-			return
-		}
+	// userInput should be a valid back path from their loot
+	back, err := model.GetBack(userInput)
+	if err != nil {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Flags:   discordgo.MessageFlagsEphemeral,
+				Content: fmt.Sprintf("%s is not a valid back path!", userInput),
+			},
+		})
+		return
+	}
 
+	count, ok := userState.Loot[back]
+	if count < 1 || !ok {
 		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
 				Flags:   discordgo.MessageFlagsEphemeral,
-				Content: "Yeah, I'm thinking you're back.",
+				Content: fmt.Sprintf("you don't appear to have %s in your backpack! back off!", back.Backname()),
 			},
 		})
+		return
+	}
 
-		err = playBack(s, BackInfo{
-			VoiceState: vs,
-			Back:       i.Member.User,
-			Message:    nil, // Message unused?
-		}, backData)
-		if err != nil {
-			playbackFailed = true
-			// TODO: structured logging
-			fmt.Printf("error in playBack while handling /playback. back: %v username: %v err: %v\n", back.Filename(), i.Member.User.Username, err)
-			return
+	// TODO: maybe we should just do this at the end instead of having
+	// logic to undo it. oh well
+	l.lootBag.RemoveLoot(userID, back)
+
+	var playbackFailed bool
+	defer func() {
+		if playbackFailed {
+			l.lootBag.AddLoot(userID, back)
 		}
+	}()
+
+	backData, err := loadBack(l.backfs, back.Path())
+	if err != nil {
+		playbackFailed = true
+		logger.Error("failed to load back data while handling /playback", logging.BackPath, back.Path(), logging.Err, err)
+		metrics.CommandFailures.With(PlaybackCmd.Name).Inc()
+		return
+	}
+	vs, err := retrieveVoiceStateForPlayback(s, i.Member.User.ID, i.ChannelID)
+	if err != nil {
+		playbackFailed = true
+		logger.Error("failed to retrieve voice state for playback", logging.Err, err)
+		metrics.CommandFailures.With(PlaybackCmd.Name).Inc()
+		return
 	}
+
+	if vs == nil {
+		playbackFailed = true
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: fmt.Sprintf("Hey %s, get back in a voice channel if you want playback.", i.Member.User.Username),
+			},
+		})
+		return
+	}
+
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags:   discordgo.MessageFlagsEphemeral,
+			Content: "Yeah, I'm thinking you're back.",
+		},
+	})
+
+	err = playBack(s, BackInfo{
+		VoiceState: vs,
+		Back:       i.Member.User,
+		Message:    nil, // Message unused?
+	}, backData)
+	if err != nil {
+		playbackFailed = true
+		logger.Error("error in playBack while handling /playback", logging.BackPath, back.Path(), logging.Err, err)
+		metrics.CommandFailures.With(PlaybackCmd.Name).Inc()
+		return
+	}
+
+	metrics.BacksPlayed.With(back.Rarity().String()).Inc()
 }
 
 func (l *lootCmdHandler) Rollback(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	logger := slog.With(logging.InteractionAttrs(i)...)
+	metrics.CommandInvocations.With(RollbackCmd.Name).Inc()
+
 	// Command only allowed in channels, so user will be in Member field
 	userID := loot.UserID(i.Member.User.ID)
 	userState := l.lootBag.GetState(userID)
 
 	rarityPoints := userState.RarityPoints()
 
-	// TODO: structured logging
-	fmt.Printf("%s wants to roll back with %d rarity points...\n", i.Member.User.Username, rarityPoints)
+	logger.Info("user wants to roll back", "rarity_points", rarityPoints)
 
 	if rarityPoints < 10_000 {
 		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
@@ -270,8 +424,7 @@ func (l *lootCmdHandler) Rollback(s *discordgo.Session, i *discordgo.Interaction
 			},
 		})
 		if err != nil {
-			// TODO: structured logging
-			fmt.Printf("error sending interaction response: %v\n", err)
+			logger.Error("error sending interaction response", logging.Err, err)
 		}
 		return
 	}
@@ -283,27 +436,32 @@ func (l *lootCmdHandler) Rollback(s *discordgo.Session, i *discordgo.Interaction
 		},
 	})
 	if err != nil {
-		// TODO: structured logging
-		fmt.Printf("error sending interaction response: %v\n", err)
+		logger.Error("error sending interaction response", logging.Err, err)
 	}
 
-	rollback, err := pickFromBackList(l.backs, model.Rollback)
+	rarity, ok := model.RollbackRarity()
+	if !ok {
+		logger.Error("no rollback tier is configured while handling /rollback")
+		metrics.CommandFailures.With(RollbackCmd.Name).Inc()
+		return
+	}
+	rollback, err := pickFromBackList(l.backs, rarity)
 	if err != nil {
-		// TODO: structured logging
-		fmt.Printf("failed to pick rollback model while handling /rollback. err: %v\n", err)
+		logger.Error("failed to pick rollback model while handling /rollback", logging.Err, err)
+		metrics.CommandFailures.With(RollbackCmd.Name).Inc()
 		return
 	}
 
 	backData, err := loadBack(l.backfs, rollback.Path())
 	if err != nil {
-		// TODO: structured logging
-		fmt.Printf("failed to load back data while handling /rollback. err: %v\n", err)
+		logger.Error("failed to load back data while handling /rollback", logging.BackPath, rollback.Path(), logging.Err, err)
+		metrics.CommandFailures.With(RollbackCmd.Name).Inc()
 		return
 	}
 	vs, err := retrieveVoiceStateForPlayback(s, i.Member.User.ID, i.ChannelID)
 	if err != nil {
-		// TODO: structured logging
-		fmt.Printf("failed to retrieve voice state for /rollback. username: %v channelID: %v err: %v\n", i.Member.User.ID, i.ChannelID, err)
+		logger.Error("failed to retrieve voice state for /rollback", logging.Err, err)
+		metrics.CommandFailures.With(RollbackCmd.Name).Inc()
 		return
 	}
 
@@ -318,6 +476,9 @@ func (l *lootCmdHandler) Rollback(s *discordgo.Session, i *discordgo.Interaction
 	}
 
 	// Ooohhh
+	if l.beforeRollback != nil {
+		l.beforeRollback(userID)
+	}
 	l.lootBag.Rollback(userID)
 
 	err = playBack(s, BackInfo{
@@ -326,42 +487,10 @@ func (l *lootCmdHandler) Rollback(s *discordgo.Session, i *discordgo.Interaction
 		Message:    nil, // Message unused?
 	}, backData)
 	if err != nil {
-		// TODO: structured logging
-		fmt.Printf("error in playBack while handling /rollback. back: %v username: %v err: %v\n", rollback.Filename(), i.Member.User.Username, err)
+		logger.Error("error in playBack while handling /rollback", logging.BackPath, rollback.Path(), logging.Err, err)
+		metrics.CommandFailures.With(RollbackCmd.Name).Inc()
 		return
 	}
-}
-
-// RegisterCommands should be called on the bot's Session to initially register the commands
-// and appropriate handlers.
-func (l *lootCmdHandler) RegisterCommands(s *discordgo.Session) error {
-	_, err := s.ApplicationCommandCreate(s.State.User.ID, "", backpackCmd)
-	if err != nil {
-		return fmt.Errorf("failed to create backpackCmd: %w", err)
-	}
-
-	_, err = s.ApplicationCommandCreate(s.State.User.ID, "", playbackCmd)
-	if err != nil {
-		return fmt.Errorf("failed to create playbackCmd: %w", err)
-	}
-
-	_, err = s.ApplicationCommandCreate(s.State.User.ID, "", rollbackCmd)
-	if err != nil {
-		return fmt.Errorf("failed to create rollbackCmd: %w", err)
-	}
-
-	s.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-		fmt.Printf("handling an interaction! name: %s\n", i.ApplicationCommandData().Name)
-
-		switch i.ApplicationCommandData().Name {
-		case "backpack":
-			l.Backpack(s, i)
-		case "playback":
-			l.Playback(s, i)
-		case "rollback":
-			l.Rollback(s, i)
-		}
-	})
 
-	return nil
+	metrics.BacksPlayed.With(rollback.Rarity().String()).Inc()
 }
@@ -0,0 +1,508 @@
+package backs
+
+import (
+	"back-bot/backs/loot"
+	"back-bot/backs/market"
+	"back-bot/backs/model"
+	"back-bot/logging"
+	"back-bot/metrics"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const marketPageSize = 10
+
+var priceMin = 1.0
+
+func listingOption(description string) *discordgo.ApplicationCommandOption {
+	return &discordgo.ApplicationCommandOption{
+		Type:         discordgo.ApplicationCommandOptionInteger,
+		Name:         "listing",
+		Description:  description,
+		Autocomplete: true,
+		Required:     true,
+	}
+}
+
+var MarketCmd = &discordgo.ApplicationCommand{
+	Name:         "market",
+	Description:  "Buy and sell backs for greenbacks with other members",
+	Type:         discordgo.ChatApplicationCommand,
+	DMPermission: &falseVar,
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "list",
+			Description: "Put one of your backs up for sale. It leaves your backpack until it sells or you cancel",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:         discordgo.ApplicationCommandOptionString,
+					Name:         "back",
+					Description:  "The back to sell",
+					Autocomplete: true,
+					Required:     true,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "price",
+					Description: "How many greenbacks to sell it for",
+					MinValue:    &priceMin,
+					Required:    true,
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "browse",
+			Description: "See the backs for sale in this server",
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "buy",
+			Description: "Buy a listed back",
+			Options:     []*discordgo.ApplicationCommandOption{listingOption("The listing to buy")},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "cancel",
+			Description: "Take one of your listings off the market, returning the back to your backpack",
+			Options:     []*discordgo.ApplicationCommandOption{listingOption("The listing to cancel")},
+		},
+	},
+}
+
+// Refusals from the market's listing checks.
+var (
+	errOwnListing     = errors.New("can't buy your own listing")
+	errNotYourListing = errors.New("listing belongs to someone else")
+)
+
+// marketCmdHandler runs a market where the loot store holds listed backs in escrow.
+// Escrowing a back is written before its listing, and taking a listing is written
+// before its back leaves escrow, so a crash in between can only leave a back in escrow
+// without a listing, which ReconcileEscrow returns to its seller.
+type marketCmdHandler struct {
+	lootBag     loot.LootBag
+	provider    BackProvider
+	listings    *market.Store
+	expiry      time.Duration
+	maxListings int
+}
+
+// NewMarketCmdHandler handles /market. Listings stay up for expiry before their backs
+// return to the seller, and each member can have maxListings listings in a guild at
+// once. Zero is no limit.
+func NewMarketCmdHandler(lb loot.LootBag, provider BackProvider, listings *market.Store, expiry time.Duration, maxListings int) *marketCmdHandler {
+	return &marketCmdHandler{
+		lootBag:     lb,
+		provider:    provider,
+		listings:    listings,
+		expiry:      expiry,
+		maxListings: maxListings,
+	}
+}
+
+func (m *marketCmdHandler) Market(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	metrics.CommandInvocations.With(MarketCmd.Name).Inc()
+
+	subcommand := i.ApplicationCommandData().Options[0]
+
+	switch subcommand.Name {
+	case "list":
+		m.list(s, i, subcommand.Options)
+	case "browse":
+		m.respondMarket(s, i, discordgo.InteractionResponseChannelMessageWithSource, 0)
+	case "buy":
+		m.buy(s, i, int(subcommand.Options[0].IntValue()))
+	case "cancel":
+		m.cancel(s, i, int(subcommand.Options[0].IntValue()))
+	}
+}
+
+func (m *marketCmdHandler) list(s *discordgo.Session, i *discordgo.InteractionCreate, options []*discordgo.ApplicationCommandInteractionDataOption) {
+	seller := interactionUser(i)
+	var backPath string
+	var price int
+	for _, option := range options {
+		switch option.Name {
+		case "back":
+			backPath = option.StringValue()
+		case "price":
+			price = int(option.IntValue())
+		}
+	}
+
+	back, err := model.GetBack(backPath)
+	if err != nil {
+		respond(s, i, fmt.Sprintf("%s is not a valid back path!", backPath), true)
+		return
+	}
+	name := m.provider.DisplayName(back)
+
+	// escrow the back, so it can't be played, gifted or listed twice while it's for sale
+	err = m.lootBag.Escrow(loot.UserID(seller.ID), back)
+	if errors.Is(err, loot.ErrNotInBackpack) {
+		respond(s, i, fmt.Sprintf("You don't have %s in your backpack to sell!", name), true)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to escrow a back for the market", append(logging.InteractionAttrs(i), logging.BackPath, back.Path(), logging.Err, err)...)
+		respond(s, i, "Something went wrong listing that back. Try again later.", true)
+		return
+	}
+
+	now := time.Now()
+	listing, err := m.listings.Add(market.Listing{
+		GuildID: i.GuildID,
+		Seller:  seller.ID,
+		Back:    back.Path(),
+		Price:   price,
+		Listed:  now,
+		Expires: now.Add(m.expiry),
+	}, m.maxListings)
+	if err != nil {
+		m.returnEscrow(logging.InteractionAttrs(i), seller.ID, back)
+
+		if errors.Is(err, market.ErrTooManyListings) {
+			respond(s, i, fmt.Sprintf("You already have %d backs on the market here. Cancel one with /market cancel first.", m.maxListings), true)
+			return
+		}
+		slog.Error("failed to list a back", append(logging.InteractionAttrs(i), logging.BackPath, back.Path(), logging.Err, err)...)
+		respond(s, i, "Something went wrong listing that back. Try again later.", true)
+		return
+	}
+
+	slog.Info("back listed", append(logging.InteractionAttrs(i), logging.BackPath, back.Path(), "listing_id", listing.ID, "price", price)...)
+	respond(s, i, fmt.Sprintf("Listed %s as #%d for %d greenbacks. If nobody buys it by <t:%d:f>, it'll come back to your backpack.", name, listing.ID, price, listing.Expires.Unix()), true)
+}
+
+func (m *marketCmdHandler) buy(s *discordgo.Session, i *discordgo.InteractionCreate, id int) {
+	buyer := interactionUser(i)
+
+	listing, err := m.listings.Take(i.GuildID, id, func(l market.Listing) error {
+		if l.Seller == buyer.ID {
+			return errOwnListing
+		}
+		if m.lootBag.GetState(loot.UserID(buyer.ID)).Greenbacks < l.Price {
+			return loot.ErrNotEnoughGreenbacks
+		}
+		return nil
+	})
+	if err != nil {
+		m.respondListingError(s, i, id, err)
+		return
+	}
+
+	back, err := model.GetBack(listing.Back)
+	if err == nil {
+		err = m.lootBag.Purchase(loot.UserID(buyer.ID), loot.UserID(listing.Seller), back, listing.Price)
+	}
+	if err != nil {
+		// a back that's left escrow was rolled back, so its listing stays down
+		if !errors.Is(err, loot.ErrNotInEscrow) {
+			m.restore(i, listing)
+		}
+		m.respondListingError(s, i, id, err)
+		return
+	}
+
+	name := m.provider.DisplayName(back)
+	slog.Info("back bought", append(logging.InteractionAttrs(i), logging.BackPath, back.Path(), "listing_id", listing.ID, "seller_id", listing.Seller, "price", listing.Price)...)
+	respond(s, i, fmt.Sprintf("You bought %s from <@%s> for %d greenbacks.", name, listing.Seller, listing.Price), true)
+
+	sale := fmt.Sprintf("🛒 <@%s> bought your **%s** (listing #%d) for %d greenbacks!", buyer.ID, name, listing.ID, listing.Price)
+	if err := sendDM(s, listing.Seller, sale); err != nil {
+		slog.Debug("could not DM market seller", append(logging.InteractionAttrs(i), "seller_id", listing.Seller, logging.Err, err)...)
+	}
+}
+
+func (m *marketCmdHandler) cancel(s *discordgo.Session, i *discordgo.InteractionCreate, id int) {
+	seller := interactionUser(i)
+
+	listing, err := m.listings.Take(i.GuildID, id, func(l market.Listing) error {
+		if l.Seller != seller.ID {
+			return errNotYourListing
+		}
+		return nil
+	})
+	if err != nil {
+		m.respondListingError(s, i, id, err)
+		return
+	}
+
+	back, err := model.GetBack(listing.Back)
+	if err == nil {
+		err = m.lootBag.ReturnEscrow(loot.UserID(seller.ID), back)
+	}
+	if err != nil {
+		if !errors.Is(err, loot.ErrNotInEscrow) {
+			m.restore(i, listing)
+		}
+		m.respondListingError(s, i, id, err)
+		return
+	}
+
+	slog.Info("market listing cancelled", append(logging.InteractionAttrs(i), logging.BackPath, back.Path(), "listing_id", listing.ID)...)
+	respond(s, i, fmt.Sprintf("Cancelled listing #%d. %s is back in your backpack.", listing.ID, m.provider.DisplayName(back)), true)
+}
+
+// restore puts a listing back on the market after a failed purchase or cancellation.
+// If that fails, the back goes back to the seller rather than staying in escrow.
+func (m *marketCmdHandler) restore(i *discordgo.InteractionCreate, listing market.Listing) {
+	err := m.listings.Restore(listing)
+	if err == nil {
+		return
+	}
+	slog.Error("failed to restore market listing", append(logging.InteractionAttrs(i), "listing_id", listing.ID, logging.BackPath, listing.Back, logging.Err, err)...)
+
+	if back, err := model.GetBack(listing.Back); err == nil {
+		m.returnEscrow(logging.InteractionAttrs(i), listing.Seller, back)
+	}
+}
+
+// returnEscrow returns the seller's back from escrow. If that fails, it's left for
+// ReconcileEscrow to return on the next start.
+func (m *marketCmdHandler) returnEscrow(attrs []any, sellerID string, back model.Back) {
+	if err := m.lootBag.ReturnEscrow(loot.UserID(sellerID), back); err != nil {
+		slog.Error("failed to return a back from escrow", append(attrs, "seller_id", sellerID, logging.BackPath, back.Path(), logging.Err, err)...)
+	}
+}
+
+// respondListingError tells the user why they couldn't buy or cancel listing id.
+func (m *marketCmdHandler) respondListingError(s *discordgo.Session, i *discordgo.InteractionCreate, id int, err error) {
+	var content string
+	switch {
+	case errors.Is(err, market.ErrNoListing):
+		content = fmt.Sprintf("There's no listing #%d on this server's market. It may have sold or expired.", id)
+	case errors.Is(err, errOwnListing):
+		content = "That's your own listing! Use /market cancel to take it back."
+	case errors.Is(err, errNotYourListing):
+		content = fmt.Sprintf("Listing #%d isn't yours to cancel.", id)
+	case errors.Is(err, loot.ErrNotEnoughGreenbacks):
+		content = fmt.Sprintf("You don't have enough greenbacks for listing #%d.", id)
+	case errors.Is(err, loot.ErrNotInEscrow):
+		content = fmt.Sprintf("Listing #%d's back was lost to a rollback, so it's been taken off the market.", id)
+	default:
+		slog.Error("failed to complete market listing", append(logging.InteractionAttrs(i), "listing_id", id, logging.Err, err)...)
+		content = "Something went wrong with that listing. Try again later."
+	}
+	respond(s, i, content, true)
+}
+
+// MarketPage turns the page of a market browsed with /market browse.
+func (m *marketCmdHandler) MarketPage(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	// custom IDs look like "market:page:<page>"
+	segments := strings.Split(i.MessageComponentData().CustomID, ":")
+	if len(segments) != 3 {
+		slog.Error("malformed market page button", logging.InteractionAttrs(i)...)
+		return
+	}
+	page, err := strconv.Atoi(segments[2])
+	if err != nil {
+		slog.Error("malformed market page button", append(logging.InteractionAttrs(i), logging.Err, err)...)
+		return
+	}
+
+	m.respondMarket(s, i, discordgo.InteractionResponseUpdateMessage, page)
+}
+
+func (m *marketCmdHandler) respondMarket(s *discordgo.Session, i *discordgo.InteractionCreate, responseType discordgo.InteractionResponseType, page int) {
+	listings := m.listings.Guild(i.GuildID)
+
+	resp := &discordgo.InteractionResponse{
+		Type: responseType,
+		Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+	}
+
+	if len(listings) == 0 {
+		resp.Data.Content = "Nothing's for sale here yet. List one of your backs with /market list."
+		resp.Data.Embeds = []*discordgo.MessageEmbed{}
+		resp.Data.Components = []discordgo.MessageComponent{}
+	} else {
+		pages := (len(listings) + marketPageSize - 1) / marketPageSize
+		page = max(min(page, pages-1), 0)
+		onPage := listings[page*marketPageSize : min((page+1)*marketPageSize, len(listings))]
+
+		resp.Data.Content = ""
+		resp.Data.Embeds = []*discordgo.MessageEmbed{m.marketEmbed(onPage, page, pages, len(listings))}
+		resp.Data.Components = marketButtons(page, pages)
+	}
+
+	err := s.InteractionRespond(i.Interaction, resp)
+	if err != nil {
+		slog.Error("error responding to /market command", append(logging.InteractionAttrs(i), logging.Err, err)...)
+	}
+}
+
+func (m *marketCmdHandler) marketEmbed(listings []market.Listing, page, pages, total int) *discordgo.MessageEmbed {
+	var description strings.Builder
+	for _, l := range listings {
+		name, rarity := l.Back, "?"
+		if back, err := model.GetBack(l.Back); err == nil {
+			name, rarity = m.provider.DisplayName(back), back.Rarity().String()
+		}
+		fmt.Fprintf(&description, "**#%d** %s (%s) · **%d** greenbacks from <@%s>, expires <t:%d:R>\n",
+			l.ID, truncate(name, maxBackpackNameLength), rarity, l.Price, l.Seller, l.Expires.Unix())
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:       "🏪 Market",
+		Description: description.String(),
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("Page %d of %d · %d listings · buy with /market buy", page+1, pages, total),
+		},
+	}
+}
+
+// marketButtons page through the market from page, counting from zero, of pages.
+func marketButtons(page, pages int) []discordgo.MessageComponent {
+	if pages <= 1 {
+		return []discordgo.MessageComponent{}
+	}
+
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{
+				Label:    "◀ Previous",
+				Style:    discordgo.SecondaryButton,
+				CustomID: fmt.Sprintf("%s:page:%d", MarketCmd.Name, page-1),
+				Disabled: page == 0,
+			},
+			discordgo.Button{
+				Label:    "Next ▶",
+				Style:    discordgo.SecondaryButton,
+				CustomID: fmt.Sprintf("%s:page:%d", MarketCmd.Name, page+1),
+				Disabled: page == pages-1,
+			},
+		}},
+	}
+}
+
+// MarketAutocomplete suggests backs from the seller's backpack to list, other members'
+// listings to buy, and the user's own listings to cancel.
+func (m *marketCmdHandler) MarketAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	subcommand := i.ApplicationCommandData().Options[0]
+	user := interactionUser(i)
+
+	for _, option := range subcommand.Options {
+		if !option.Focused {
+			continue
+		}
+		input := fmt.Sprint(option.Value)
+
+		switch subcommand.Name {
+		case "list":
+			state := m.lootBag.GetState(loot.UserID(user.ID))
+			respondChoices(s, i, backpackChoices(m.provider, state, input))
+		case "buy":
+			respondChoices(s, i, m.listingChoices(i.GuildID, input, func(l market.Listing) bool { return l.Seller != user.ID }))
+		case "cancel":
+			respondChoices(s, i, m.listingChoices(i.GuildID, input, func(l market.Listing) bool { return l.Seller == user.ID }))
+		}
+		return
+	}
+}
+
+// listingChoices are the guild's listings that include allows and that fuzzily match input, oldest first.
+func (m *marketCmdHandler) listingChoices(guildID, input string, include func(market.Listing) bool) []*discordgo.ApplicationCommandOptionChoice {
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for _, l := range m.listings.Guild(guildID) {
+		if !include(l) || len(choices) >= maxChoices {
+			continue
+		}
+
+		name := l.Back
+		if back, err := model.GetBack(l.Back); err == nil {
+			name = fmt.Sprintf("%s (%s)", m.provider.DisplayName(back), back.Rarity())
+		}
+		prefix := fmt.Sprintf("#%d ", l.ID)
+		suffix := fmt.Sprintf(" · %d greenbacks", l.Price)
+		label := prefix + truncate(name, 100-utf8.RuneCountInString(prefix+suffix)) + suffix
+
+		if _, ok := fuzzyScore(input, label); ok {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: label, Value: l.ID})
+		}
+	}
+	return choices
+}
+
+// ExpireListings returns the back of every listing that has expired as of now to its seller.
+func (m *marketCmdHandler) ExpireListings(s *discordgo.Session, now time.Time) {
+	expired, err := m.listings.Expired(now)
+	if err != nil {
+		slog.Error("failed to expire market listings", logging.Err, err)
+		return
+	}
+
+	for _, l := range expired {
+		attrs := []any{logging.GuildID, l.GuildID, logging.UserID, l.Seller, logging.BackPath, l.Back, "listing_id", l.ID}
+
+		back, err := model.GetBack(l.Back)
+		if err != nil {
+			slog.Error("expired market listing has an invalid back", append(attrs, logging.Err, err)...)
+			continue
+		}
+		if err := m.lootBag.ReturnEscrow(loot.UserID(l.Seller), back); err != nil {
+			slog.Error("failed to return an expired listing's back from escrow", append(attrs, logging.Err, err)...)
+			continue
+		}
+		slog.Info("market listing expired", attrs...)
+
+		notice := fmt.Sprintf("Nobody bought your %s (listing #%d), so it's back in your backpack.", m.provider.DisplayName(back), l.ID)
+		if err := sendDM(s, l.Seller, notice); err != nil {
+			slog.Debug("could not DM market seller", append(attrs, logging.Err, err)...)
+		}
+	}
+}
+
+// WithdrawListings takes down every listing the user has in any guild, leaving their
+// backs in escrow. It runs before a rollback, which takes escrow along with the rest
+// of the user's loot, so listed backs can't be cancelled back into their backpack.
+func (m *marketCmdHandler) WithdrawListings(userID loot.UserID) {
+	withdrawn, err := m.listings.Withdraw(string(userID))
+	if err != nil {
+		slog.Error("failed to withdraw market listings before a rollback", logging.UserID, userID, logging.Err, err)
+		return
+	}
+
+	for _, l := range withdrawn {
+		slog.Info("market listing withdrawn by a rollback", logging.GuildID, l.GuildID, logging.UserID, l.Seller, logging.BackPath, l.Back, "listing_id", l.ID)
+	}
+}
+
+// ReconcileEscrow returns backs in escrow that aren't listed anywhere to their sellers.
+// It must run before the market takes any commands.
+func (m *marketCmdHandler) ReconcileEscrow() {
+	listed := make(map[loot.UserID]map[model.Back]int)
+	for _, l := range m.listings.All() {
+		back, err := model.GetBack(l.Back)
+		if err != nil {
+			continue
+		}
+		seller := loot.UserID(l.Seller)
+		if listed[seller] == nil {
+			listed[seller] = make(map[model.Back]int)
+		}
+		listed[seller][back]++
+	}
+
+	for seller, escrow := range m.lootBag.Escrowed() {
+		for back, count := range escrow {
+			attrs := []any{logging.UserID, seller, logging.BackPath, back.Path()}
+			for range count - listed[seller][back] {
+				if err := m.lootBag.ReturnEscrow(seller, back); err != nil {
+					slog.Error("failed to return an unlisted back from escrow", append(attrs, logging.Err, err)...)
+					break
+				}
+				slog.Warn("returned an unlisted back from escrow", attrs...)
+			}
+		}
+	}
+}
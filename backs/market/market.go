@@ -0,0 +1,228 @@
+// Package market persists the backs members have listed for sale in their guilds.
+package market
+
+import (
+	"back-bot/backs/jsonfile"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Listing is a back held in escrow until it's bought, cancelled or expires.
+type Listing struct {
+	ID      int    `json:"id"`
+	GuildID string `json:"guild_id"`
+	Seller  string `json:"seller"`
+	// Back is the listed back's path.
+	Back    string    `json:"back"`
+	Price   int       `json:"price"`
+	Listed  time.Time `json:"listed"`
+	Expires time.Time `json:"expires"`
+}
+
+// Errors returned by Store operations that can be refused.
+var (
+	ErrNoListing       = errors.New("no such listing")
+	ErrTooManyListings = errors.New("too many listings")
+)
+
+// state is what's persisted. IDs keep counting up across restarts, so a stale
+// listing number never refers to a newer listing.
+type state struct {
+	NextID   int       `json:"next_id"`
+	Listings []Listing `json:"listings"`
+}
+
+// Store holds every guild's listings, persisting them as JSON after each change.
+type Store struct {
+	path string
+
+	mu    sync.Mutex
+	state state
+}
+
+// Open loads the store from path, which is created on the first listing if it doesn't exist.
+// If path is empty, listings are kept in memory only.
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path:  path,
+		state: state{NextID: 1},
+	}
+
+	if path == "" {
+		return s, nil
+	}
+
+	if err := jsonfile.Read(path, &s.state); err != nil {
+		return nil, fmt.Errorf("failed to load market listings: %w", err)
+	}
+	slices.SortFunc(s.state.Listings, func(a, b Listing) int { return a.ID - b.ID })
+
+	return s, nil
+}
+
+// Add numbers the listing and persists it, unless its seller already has limit
+// listings in the guild. Zero is no limit.
+func (s *Store) Add(listing Listing, limit int) (Listing, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if limit > 0 {
+		var count int
+		for _, l := range s.state.Listings {
+			if l.GuildID == listing.GuildID && l.Seller == listing.Seller {
+				count++
+			}
+		}
+		if count >= limit {
+			return Listing{}, ErrTooManyListings
+		}
+	}
+
+	prev := s.state
+	listing.ID = s.state.NextID
+	s.state.NextID++
+	s.state.Listings = append(slices.Clip(s.state.Listings), listing)
+
+	if err := s.save(); err != nil {
+		s.state = prev
+		return Listing{}, err
+	}
+	return listing, nil
+}
+
+// Guild returns the guild's listings, oldest first.
+func (s *Store) Guild(guildID string) []Listing {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var listings []Listing
+	for _, l := range s.state.Listings {
+		if l.GuildID == guildID {
+			listings = append(listings, l)
+		}
+	}
+	return listings
+}
+
+// All returns every guild's listings, oldest first.
+func (s *Store) All() []Listing {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.state.Listings)
+}
+
+// Take removes the guild's listing id and persists the change, as long as allow
+// doesn't refuse it. allow's error is returned unchanged.
+func (s *Store) Take(guildID string, id int, allow func(Listing) error) (Listing, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := slices.IndexFunc(s.state.Listings, func(l Listing) bool { return l.GuildID == guildID && l.ID == id })
+	if index < 0 {
+		return Listing{}, ErrNoListing
+	}
+	listing := s.state.Listings[index]
+	if allow != nil {
+		if err := allow(listing); err != nil {
+			return Listing{}, err
+		}
+	}
+
+	prev := s.state
+	s.state.Listings = slices.Delete(slices.Clone(s.state.Listings), index, index+1)
+
+	if err := s.save(); err != nil {
+		s.state = prev
+		return Listing{}, err
+	}
+	return listing, nil
+}
+
+// Restore puts back a listing that was taken, but couldn't be completed.
+func (s *Store) Restore(listing Listing) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev := s.state
+	index, _ := slices.BinarySearchFunc(s.state.Listings, listing.ID, func(l Listing, id int) int { return l.ID - id })
+	s.state.Listings = slices.Insert(slices.Clone(s.state.Listings), index, listing)
+
+	if err := s.save(); err != nil {
+		s.state = prev
+		return err
+	}
+	return nil
+}
+
+// Withdraw removes and returns every listing the seller has, in every guild.
+// If the change can't be persisted, nothing is removed.
+func (s *Store) Withdraw(seller string) ([]Listing, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var withdrawn, remaining []Listing
+	for _, l := range s.state.Listings {
+		if l.Seller == seller {
+			withdrawn = append(withdrawn, l)
+		} else {
+			remaining = append(remaining, l)
+		}
+	}
+	if len(withdrawn) == 0 {
+		return nil, nil
+	}
+
+	prev := s.state
+	s.state.Listings = remaining
+
+	if err := s.save(); err != nil {
+		s.state = prev
+		return nil, err
+	}
+	return withdrawn, nil
+}
+
+// Expired removes and returns every listing that has expired as of now.
+// If the change can't be persisted, nothing is removed.
+func (s *Store) Expired(now time.Time) ([]Listing, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var expired, remaining []Listing
+	for _, l := range s.state.Listings {
+		if now.Before(l.Expires) {
+			remaining = append(remaining, l)
+		} else {
+			expired = append(expired, l)
+		}
+	}
+	if len(expired) == 0 {
+		return nil, nil
+	}
+
+	prev := s.state
+	s.state.Listings = remaining
+
+	if err := s.save(); err != nil {
+		s.state = prev
+		return nil, err
+	}
+	return expired, nil
+}
+
+// save writes every listing to disk. Callers must hold s.mu.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	if err := jsonfile.Write(s.path, s.state); err != nil {
+		return fmt.Errorf("failed to save market listings: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package market
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStorePersistsListings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "market.json")
+	listed := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	store, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listing := func(seller, back string, expiresIn time.Duration) Listing {
+		return Listing{GuildID: "guild", Seller: seller, Back: back, Price: 100, Listed: listed, Expires: listed.Add(expiresIn)}
+	}
+
+	first, err := store.Add(listing("bigback", "Rare/welcome_back.dca", time.Hour), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Add(listing("bigback", "Common/back.dca", 2*time.Hour), 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Add(listing("bigback", "Common/back.dca", time.Hour), 2); !errors.Is(err, ErrTooManyListings) {
+		t.Fatalf("expected the listing limit to be enforced, got %v", err)
+	}
+	third, err := store.Add(listing("parkour", "Common/back.dca", 3*time.Hour), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID != 1 || third.ID != 3 {
+		t.Fatalf("expected listings to be numbered in order, got %d and %d", first.ID, third.ID)
+	}
+
+	refused := errors.New("refused")
+	if _, err := store.Take("guild", first.ID, func(Listing) error { return refused }); !errors.Is(err, refused) {
+		t.Fatalf("expected take to be refused, got %v", err)
+	}
+	if _, err := store.Take("other guild", first.ID, nil); !errors.Is(err, ErrNoListing) {
+		t.Fatalf("expected listings to belong to their guild, got %v", err)
+	}
+	taken, err := store.Take("guild", first.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Restore(taken); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if listings := reopened.Guild("guild"); len(listings) != 3 || listings[0] != first {
+		t.Fatalf("unexpected listings after reopening: %+v", listings)
+	}
+
+	expired, err := reopened.Expired(listed.Add(2 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 2 || expired[0].ID != 1 || expired[1].ID != 2 {
+		t.Fatalf("expected the first two listings to expire, got %+v", expired)
+	}
+
+	next, err := reopened.Add(listing("parkour", "Rare/welcome_back.dca", time.Hour), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.ID != 4 {
+		t.Fatalf("expected listing numbers to survive reopening, got %d", next.ID)
+	}
+}
+
+func TestStoreWithdraw(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "market.json")
+	store, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, l := range []Listing{
+		{GuildID: "guild", Seller: "parkour", Back: "Common/back.dca"},
+		{GuildID: "guild", Seller: "bigback", Back: "Common/back.dca"},
+		{GuildID: "other", Seller: "parkour", Back: "Rare/welcome_back.dca"},
+	} {
+		if _, err := store.Add(l, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	withdrawn, err := store.Withdraw("parkour")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(withdrawn) != 2 || withdrawn[0].ID != 1 || withdrawn[1].ID != 3 {
+		t.Fatalf("expected the seller's listings in every guild to be withdrawn, got %+v", withdrawn)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if listings := reopened.All(); len(listings) != 1 || listings[0].Seller != "bigback" {
+		t.Fatalf("expected only other sellers' listings to be left, got %+v", listings)
+	}
+}
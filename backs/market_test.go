@@ -0,0 +1,210 @@
+package backs
+
+import (
+	"back-bot/backs/loot"
+	"back-bot/backs/market"
+	"back-bot/backs/model"
+	"io"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestListingChoices(t *testing.T) {
+	backfs := fstest.MapFS{
+		"Common/hello_back.dca": {},
+		"Rare/welcome_back.dca": {},
+		MetadataFile:            {Data: []byte(`{"Rare/welcome_back.dca": {"name": "Welcome back!"}}`)},
+	}
+	listings, err := market.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewMarketCmdHandler(nil, NewBackProvider(backfs), listings, time.Hour, 0)
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, l := range []market.Listing{
+		{GuildID: "guild", Seller: "bigback", Back: "Rare/welcome_back.dca", Price: 500},
+		{GuildID: "guild", Seller: "parkour", Back: "Common/hello_back.dca", Price: 20},
+		{GuildID: "other", Seller: "parkour", Back: "Common/hello_back.dca", Price: 30},
+	} {
+		l.Listed, l.Expires = now, now.Add(time.Hour)
+		if _, err := listings.Add(l, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	labels := func(input string, seller string) []string {
+		var out []string
+		for _, choice := range m.listingChoices("guild", input, func(l market.Listing) bool { return l.Seller != seller }) {
+			out = append(out, choice.Name)
+		}
+		return out
+	}
+
+	if actual, expected := labels("", ""), []string{"#1 Welcome back! (Rare) · 500 greenbacks", "#2 hello_back (Common) · 20 greenbacks"}; !slices.Equal(actual, expected) {
+		t.Errorf("expected every guild listing, got %v", actual)
+	}
+	if actual, expected := labels("welc", ""), []string{"#1 Welcome back! (Rare) · 500 greenbacks"}; !slices.Equal(actual, expected) {
+		t.Errorf("expected listings matching the input, got %v", actual)
+	}
+	if actual, expected := labels("", "bigback"), []string{"#2 hello_back (Common) · 20 greenbacks"}; !slices.Equal(actual, expected) {
+		t.Errorf("expected the seller's own listings to be left out, got %v", actual)
+	}
+}
+
+// recordingTransport answers every Discord API request with an empty object, keeping
+// the request bodies.
+type recordingTransport struct {
+	bodies []string
+}
+
+func (r *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		body, _ := io.ReadAll(req.Body)
+		r.bodies = append(r.bodies, string(body))
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader("{}")),
+		Request:    req,
+	}, nil
+}
+
+func TestMarketEscrow(t *testing.T) {
+	backfs := fstest.MapFS{"Rare/welcome_back.dca": {}}
+	back, _ := model.GetBack("Rare/welcome_back.dca")
+	lootPath := filepath.Join(t.TempDir(), "loot.csv")
+	marketPath := filepath.Join(t.TempDir(), "market.json")
+
+	lootBag, err := loot.NewCsvLootBag(lootPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// after the first change, only escrow is flushed
+	lootBag.SetFlushPolicy(loot.NewStalenessFlushPolicy(time.Hour))
+	listings, err := market.Open(marketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewMarketCmdHandler(lootBag, NewBackProvider(backfs), listings, time.Hour, 0)
+
+	lootBag.AddLoot("parkour", back)
+	lootBag.AddLoot("parkour", back)
+	lootBag.AddGreenbacks("bigback", 150)
+
+	transport := new(recordingTransport)
+	s, _ := discordgo.New("Bot token")
+	s.Client = &http.Client{Transport: transport}
+
+	command := func(userID, subcommand string, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+		return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+			Type:    discordgo.InteractionApplicationCommand,
+			GuildID: "guild",
+			Member:  &discordgo.Member{User: &discordgo.User{ID: userID}},
+			Data: discordgo.ApplicationCommandInteractionData{
+				Name: MarketCmd.Name,
+				Options: []*discordgo.ApplicationCommandInteractionDataOption{
+					{Type: discordgo.ApplicationCommandOptionSubCommand, Name: subcommand, Options: options},
+				},
+			},
+		}}
+	}
+	list := func() {
+		m.Market(s, command("parkour", "list",
+			&discordgo.ApplicationCommandInteractionDataOption{Type: discordgo.ApplicationCommandOptionString, Name: "back", Value: back.Path()},
+			&discordgo.ApplicationCommandInteractionDataOption{Type: discordgo.ApplicationCommandOptionInteger, Name: "price", Value: float64(100)},
+		))
+	}
+	listing := func(id int) *discordgo.ApplicationCommandInteractionDataOption {
+		return &discordgo.ApplicationCommandInteractionDataOption{Type: discordgo.ApplicationCommandOptionInteger, Name: "listing", Value: float64(id)}
+	}
+
+	// onDisk checks what would be left after a crash
+	onDisk := func(step string, backpack, escrow, listed int) {
+		t.Helper()
+		reopenedLoot, err := loot.NewCsvLootBag(lootPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reopenedListings, err := market.Open(marketPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		seller := reopenedLoot.GetState("parkour")
+		if seller.Loot[back] != backpack || seller.Escrow[back] != escrow {
+			t.Errorf("%s: expected the seller to have %d backs and %d in escrow, got %v and %v", step, backpack, escrow, seller.Loot, seller.Escrow)
+		}
+		if actual := len(reopenedListings.Guild("guild")); actual != listed {
+			t.Errorf("%s: expected %d listings, got %d", step, listed, actual)
+		}
+	}
+	// responded checks the requests made since it was last called
+	var seen int
+	responded := func(step, content string) {
+		t.Helper()
+		sent := strings.Join(transport.bodies[seen:], "\n")
+		seen = len(transport.bodies)
+		if !strings.Contains(sent, content) {
+			t.Errorf("%s: expected a response containing %q, got %s", step, content, sent)
+		}
+	}
+
+	list()
+	responded("list", "Listed welcome_back as #1")
+	onDisk("list", 1, 1, 1)
+
+	m.Market(s, command("bigback", "buy", listing(1)))
+	responded("buy", "You bought welcome_back")
+	onDisk("buy", 1, 0, 0)
+	if buyer := lootBag.GetState("bigback"); buyer.Greenbacks != 50 || buyer.Loot[back] != 1 {
+		t.Errorf("expected the buyer to pay for the back, got %d greenbacks and %v", buyer.Greenbacks, buyer.Loot)
+	}
+
+	list()
+	onDisk("second list", 0, 1, 1)
+	m.Market(s, command("bigback", "buy", listing(2)))
+	responded("buy without enough greenbacks", "enough greenbacks")
+	onDisk("buy without enough greenbacks", 0, 1, 1)
+	m.Market(s, command("parkour", "cancel", listing(2)))
+	responded("cancel", "Cancelled listing #2")
+	onDisk("cancel", 1, 0, 0)
+
+	list()
+	m.ExpireListings(s, time.Now().Add(2*time.Hour))
+	onDisk("expire", 1, 0, 0)
+
+	// a crash after escrowing a back, but before listing it, leaves it in escrow
+	if err := lootBag.Escrow("parkour", back); err != nil {
+		t.Fatal(err)
+	}
+	lootBag.AddLoot("parkour", back)
+	list()
+	onDisk("crash while listing", 0, 2, 1)
+	m.ReconcileEscrow()
+	onDisk("reconcile", 1, 1, 1)
+
+	// a rollback withdraws the seller's listings, then takes their escrow with their loot
+	m.WithdrawListings("parkour")
+	lootBag.Rollback("parkour")
+	onDisk("rollback", 0, 0, 0)
+	m.Market(s, command("parkour", "cancel", listing(4)))
+	responded("cancel after a rollback", "There's no listing #4")
+	onDisk("cancel after a rollback", 0, 0, 0)
+
+	// if withdrawing fails, the listing is left without a back, and comes down when used
+	lootBag.AddLoot("parkour", back)
+	list()
+	lootBag.Rollback("parkour")
+	m.Market(s, command("parkour", "cancel", listing(5)))
+	responded("cancel a listing left by a rollback", "lost to a rollback")
+	onDisk("cancel a listing left by a rollback", 0, 0, 0)
+}
@@ -1,7 +1,8 @@
 package backs
 
 import (
-	"fmt"
+	"back-bot/logging"
+	"log/slog"
 
 	"github.com/bwmarrin/discordgo"
 )
@@ -26,8 +27,7 @@ func (m *MessageDelegator) Handle(s *discordgo.Session, msg *discordgo.MessageCr
 	for _, handler := range m.Handlers {
 		handled, err = handler.Handle(s, msg)
 		if err != nil {
-			// TODO: structured logging
-			fmt.Printf("MessageDelegator: error from delegatee. msg: %+v  err: %v \n", msg.Message, err)
+			slog.Error("MessageDelegator: error from delegatee", append(logging.MessageAttrs(msg.Message), logging.Err, err)...)
 		}
 		if handled {
 			return
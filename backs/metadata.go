@@ -0,0 +1,47 @@
+package backs
+
+import (
+	"back-bot/backs/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// MetadataFile is an optional file at the root of back_repo describing backs,
+// keyed by their path, e.g. {"Rare/welcome_back.ogg.dca": {"name": "Welcome Back!"}}.
+const MetadataFile = "metadata.json"
+
+// BackMetadata describes a back beyond what its path says.
+type BackMetadata struct {
+	// Name is shown instead of the back's file name.
+	Name string `json:"name,omitempty"`
+	// Tags group backs for browsing, e.g. by who's in them.
+	Tags []string `json:"tags,omitempty"`
+}
+
+// GetBackMetadata reads MetadataFile from backfs. It's fine for the file not to exist.
+func GetBackMetadata(backfs fs.FS) (map[string]BackMetadata, error) {
+	metadata := make(map[string]BackMetadata)
+
+	data, err := fs.ReadFile(backfs, MetadataFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return metadata, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %v: %w", MetadataFile, err)
+	}
+
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to parse %v: %w", MetadataFile, err)
+	}
+	return metadata, nil
+}
+
+// displayName is the back's name from metadata, or its file name without extensions.
+func displayName(metadata map[string]BackMetadata, back model.Back) string {
+	if name := metadata[back.Path()].Name; name != "" {
+		return name
+	}
+	return back.Backname()
+}
@@ -0,0 +1,33 @@
+package backs
+
+import (
+	"back-bot/backs/model"
+	"testing"
+	"testing/fstest"
+)
+
+func TestBackMetadata(t *testing.T) {
+	backfs := fstest.MapFS{
+		"Common/hello_back.ogg.dca": {},
+		"Rare/welcome_back.ogg.dca": {},
+		MetadataFile:                {Data: []byte(`{"Rare/welcome_back.ogg.dca": {"name": "Welcome Back!"}}`)},
+	}
+
+	provider := NewBackProvider(backfs)
+	if len(provider.Backs()) != 2 {
+		t.Fatalf("expected the metadata file not to be read as a rarity, got %v", provider.Backs())
+	}
+
+	rare, common := provider.Backs()[model.Rare][0], provider.Backs()[model.Common][0]
+	if name := provider.DisplayName(rare); name != "Welcome Back!" {
+		t.Errorf("expected the name from metadata, got %q", name)
+	}
+	if name := provider.DisplayName(common); name != "hello_back" {
+		t.Errorf("expected the file name without extensions, got %q", name)
+	}
+
+	delete(backfs, MetadataFile)
+	if _, err := GetBackMetadata(backfs); err != nil {
+		t.Errorf("expected a missing metadata file to be fine, got %v", err)
+	}
+}
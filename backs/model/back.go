@@ -34,3 +34,16 @@ func (b Back) Rarity() Rarity {
 	r, _ := LookUpRarity(path.Base(path.Dir(b.path)))
 	return r
 }
+
+// EventsDir is the back_repo directory holding each event's pool of backs,
+// laid out like back_repo itself: Events/<event>/<rarity>/<back>.
+const EventsDir = "Events"
+
+// Event is the name of the event the back is exclusive to, or empty for regular backs.
+func (b Back) Event() string {
+	parts := strings.Split(b.path, "/")
+	if len(parts) < 3 || parts[0] != EventsDir {
+		return ""
+	}
+	return parts[1]
+}
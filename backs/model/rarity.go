@@ -1,11 +1,15 @@
 package model
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
-//go:generate go run golang.org/x/tools/cmd/stringer@v0.22.0 -type=Rarity
 type Rarity int
 
-// Remember to rerun `go generate rarity.go` if you modify this block!
+// The built-in rarities. Tiers configured with these names keep these values,
+// so they can still be referred to directly.
 const (
 	Rollback Rarity = 1
 	Rare     Rarity = 10
@@ -13,48 +17,191 @@ const (
 	Common   Rarity = 400
 )
 
-var Rarities = [...]Rarity{Rollback, Rare, Uncommon, Common}
+// customRarities is the first value given to configured tiers that aren't built in.
+const customRarities Rarity = 1000
+
+// Tier describes a rarity: how often it rolls, what it's worth, and how it's shown.
+type Tier struct {
+	// Name is also the name of the rarity's directory in back_repo.
+	Name string
+	// Weight is the relative odds of rolling the tier.
+	Weight int
+	// LootValue is how many "rarity points" each back of the tier is worth. Zero derives
+	// it from the weights, so rarer tiers are worth more.
+	LootValue int
+	// Color is a 0xRRGGBB color for the tier.
+	Color int
+	Emoji string
+	// Rollback tiers take the user's loot instead of adding to it.
+	Rollback bool
+}
+
+// DefaultTiers are the original four rarities.
+var DefaultTiers = []Tier{
+	{Name: "Rollback", Weight: 2, Color: 0xE74C3C, Emoji: "⏪", Rollback: true},
+	{Name: "Rare", Weight: 9, Color: 0xF1C40F, Emoji: "🌟"},
+	{Name: "Uncommon", Weight: 80, Color: 0x3498DB, Emoji: "🔷"},
+	{Name: "Common", Weight: 309, Color: 0x95A5A6, Emoji: "🔙"},
+}
+
+var builtinRarities = map[string]Rarity{
+	"Rollback": Rollback,
+	"Rare":     Rare,
+	"Uncommon": Uncommon,
+	"Common":   Common,
+}
+
+// Rarities are the rarities of the configured tiers, rarest first.
+var Rarities []Rarity
+
+// DefaultRarityWeights are the relative odds of rolling each rarity, from the configured tiers.
+var DefaultRarityWeights map[Rarity]int
 
 // RarityLootValues represents how many "rarity points" a given back
-// has for its rarity, derived from the Rarity values themselves, inversely.
-var RarityLootValues = make(map[Rarity]int)
+// has for its rarity. Rollback tiers aren't worth anything.
+var RarityLootValues map[Rarity]int
+
+var tiers map[Rarity]Tier
 
-// init RarityLootValue using Tom's algorithm: https://github.com/pillig/back-bot/blob/master/LootTools/loottracker.py#L45-L49
 func init() {
-	const lootMultiplier = 300
+	if err := SetTiers(DefaultTiers); err != nil {
+		panic(err)
+	}
+}
 
-	// don't included Rollback rarity
-	nonRollbackRarities := Rarities[1:]
+// CheckTiers reports everything wrong with a list of tiers.
+func CheckTiers(tiers []Tier) error {
+	var errs []error
+	fail := func(format string, args ...any) { errs = append(errs, fmt.Errorf(format, args...)) }
 
-	var sum int
-	for _, rarity := range nonRollbackRarities {
-		sum += int(rarity)
+	if len(tiers) == 0 {
+		fail("at least one rarity tier is required")
 	}
 
-	weight := sum * lootMultiplier / len(nonRollbackRarities)
+	names := make(map[string]bool)
+	var total int
+	for _, tier := range tiers {
+		switch {
+		case tier.Name == "" || strings.ContainsAny(tier.Name, `/\`) || tier.Name == EventsDir:
+			fail("invalid rarity tier name %q", tier.Name)
+		case names[tier.Name]:
+			fail("rarity tier %s is defined more than once", tier.Name)
+		}
+		names[tier.Name] = true
 
-	for _, rarity := range nonRollbackRarities {
-		RarityLootValues[rarity] = weight / int(rarity)
+		if tier.Weight < 0 || tier.LootValue < 0 {
+			fail("weight and loot value for %s cannot be negative", tier.Name)
+		}
+		if tier.Color < 0 || tier.Color > 0xFFFFFF {
+			fail("color for %s is not a valid 0xRRGGBB color", tier.Name)
+		}
+		total += max(tier.Weight, 0)
 	}
+
+	if len(tiers) > 0 && total <= 0 {
+		fail("at least one rarity tier needs a positive weight")
+	}
+
+	return errors.Join(errs...)
 }
 
-func LookUpRarity(name string) (Rarity, error) {
+// SetTiers replaces the rarities with tiers, listed rarest first. It must be called
+// before anything rolls, looks up or stores rarities.
+func SetTiers(configured []Tier) error {
+	if err := CheckTiers(configured); err != nil {
+		return err
+	}
+
+	rarities := make([]Rarity, 0, len(configured))
+	weights := make(map[Rarity]int, len(configured))
+	byRarity := make(map[Rarity]Tier, len(configured))
+	for i, tier := range configured {
+		rarity, ok := builtinRarities[tier.Name]
+		if !ok {
+			rarity = customRarities + Rarity(i)
+		}
+		rarities = append(rarities, rarity)
+		weights[rarity] = tier.Weight
+		byRarity[rarity] = tier
+	}
+
+	Rarities, DefaultRarityWeights, tiers = rarities, weights, byRarity
+	RarityLootValues = lootValues(configured, rarities)
+	return nil
+}
+
+// lootValues fills in the loot values of tiers without one using Tom's algorithm:
+// https://github.com/pillig/back-bot/blob/master/LootTools/loottracker.py#L45-L49
+//
+// The algorithm divides by each rarity's threshold in the original roll, where a roll in
+// [0, total weight) picked the first rarity whose threshold was at least the roll. So a
+// tier's threshold is one less than its cumulative weight, except the commonest tier's,
+// which was the bound of the roll itself.
+func lootValues(configured []Tier, rarities []Rarity) map[Rarity]int {
+	const lootMultiplier = 300
+
+	thresholds := make([]int, len(configured))
+	var cumulative int
+	for i, tier := range configured {
+		cumulative += tier.Weight
+		thresholds[i] = max(cumulative-1, 1)
+	}
+	thresholds[len(thresholds)-1] = cumulative
+
+	var sum, count int
+	for i, tier := range configured {
+		if !tier.Rollback {
+			sum += thresholds[i]
+			count++
+		}
+	}
+
+	values := make(map[Rarity]int)
+	for i, tier := range configured {
+		switch {
+		case tier.Rollback:
+		case tier.LootValue > 0:
+			values[rarities[i]] = tier.LootValue
+		case tier.Weight > 0:
+			values[rarities[i]] = sum * lootMultiplier / count / thresholds[i]
+		}
+	}
+	return values
+}
+
+// Tier is the rarity's configured tier.
+func (r Rarity) Tier() Tier {
+	return tiers[r]
+}
+
+// IsRollback reports whether the rarity takes loot instead of adding to it.
+func (r Rarity) IsRollback() bool {
+	return tiers[r].Rollback
+}
+
+// RollbackRarity is the rarest rollback tier, if any tier is one.
+func RollbackRarity() (Rarity, bool) {
 	for _, rarity := range Rarities {
-		if rarity.String() == name {
-			return rarity, nil
+		if rarity.IsRollback() {
+			return rarity, true
 		}
 	}
+	return 0, false
+}
 
-	return 0, errors.New("unknown rarity")
+func (r Rarity) String() string {
+	if tier, ok := tiers[r]; ok {
+		return tier.Name
+	}
+	return fmt.Sprintf("Rarity(%d)", int(r))
 }
 
-func MaxRarity() int {
-	max := 0
+func LookUpRarity(name string) (Rarity, error) {
 	for _, rarity := range Rarities {
-		rarity := int(rarity)
-		if rarity > max {
-			max = rarity
+		if rarity.String() == name {
+			return rarity, nil
 		}
 	}
-	return max
+
+	return 0, errors.New("unknown rarity")
 }
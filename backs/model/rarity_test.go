@@ -0,0 +1,56 @@
+package model
+
+import "testing"
+
+func TestDefaultLootValues(t *testing.T) {
+	// the original rarity thresholds were 10, 90 and 400, so (10 + 90 + 400) * 300 / 3 = 50000
+	expected := map[Rarity]int{Rare: 5000, Uncommon: 555, Common: 125}
+	for rarity, value := range expected {
+		if RarityLootValues[rarity] != value {
+			t.Errorf("expected %s to be worth %d, got %d", rarity, value, RarityLootValues[rarity])
+		}
+	}
+}
+
+func TestSetTiers(t *testing.T) {
+	t.Cleanup(func() { SetTiers(DefaultTiers) })
+
+	err := SetTiers([]Tier{
+		{Name: "Mythic", Weight: 1},
+		{Name: "Rollback", Weight: 2, Rollback: true},
+		{Name: "Rare", Weight: 9, LootValue: 5000},
+		{Name: "Common", Weight: 90},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mythic, err := LookUpRarity("Mythic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mythic.String() != "Mythic" || Rarities[0] != mythic || Rarities[2] != Rare {
+		t.Fatalf("unexpected rarities %v", Rarities)
+	}
+	if _, err := LookUpRarity("Uncommon"); err == nil {
+		t.Fatal("expected unconfigured built-in rarity to be unknown")
+	}
+
+	// the thresholds are 1, 2, 11 and 102, so (1 + 11 + 102) * 300 / 3 = 11400, divided by each threshold
+	expected := map[Rarity]int{mythic: 11400, Rare: 5000, Common: 111}
+	for rarity, value := range expected {
+		if RarityLootValues[rarity] != value {
+			t.Errorf("expected %s to be worth %d, got %d", rarity, value, RarityLootValues[rarity])
+		}
+	}
+	if _, ok := RarityLootValues[Rollback]; ok || !Rollback.IsRollback() {
+		t.Error("expected rollback tier to be worth nothing")
+	}
+	if rarity, ok := RollbackRarity(); !ok || rarity != Rollback {
+		t.Errorf("expected Rollback to be the rollback rarity, got %s", rarity)
+	}
+
+	if err := SetTiers([]Tier{{Name: "Events", Weight: 1}}); err == nil {
+		t.Fatal("expected the events directory to be refused as a tier name")
+	}
+}
@@ -0,0 +1,42 @@
+package backs
+
+import (
+	"back-bot/backs/model"
+	"maps"
+)
+
+// Pity boosts a rarity's odds for users who haven't rolled it in a while.
+type Pity struct {
+	// SoftAfter is how many rolls without the rarity before its weight starts to increase.
+	SoftAfter int
+	// SoftStep is added to the rarity's weight for each roll past SoftAfter.
+	SoftStep int
+	// GuaranteedAfter is how many rolls without the rarity guarantee it on the next. Zero never does.
+	GuaranteedAfter int
+}
+
+// PityRules are the pity for each rarity. Rarities without rules roll at their usual odds.
+type PityRules map[model.Rarity]Pity
+
+// weights adjusts the base rarity weights for a user who has made rollsSince rolls since
+// each rarity. If several rarities are guaranteed, the rarest wins.
+func (p PityRules) weights(base map[model.Rarity]int, rollsSince map[model.Rarity]int) map[model.Rarity]int {
+	if len(p) == 0 {
+		return base
+	}
+
+	for _, rarity := range model.Rarities {
+		pity, ok := p[rarity]
+		if ok && pity.GuaranteedAfter > 0 && rollsSince[rarity] >= pity.GuaranteedAfter {
+			return map[model.Rarity]int{rarity: 1}
+		}
+	}
+
+	adjusted := maps.Clone(base)
+	for rarity, pity := range p {
+		if past := rollsSince[rarity] - pity.SoftAfter; pity.SoftStep > 0 && past >= 0 {
+			adjusted[rarity] += pity.SoftStep * (past + 1)
+		}
+	}
+	return adjusted
+}
@@ -0,0 +1,56 @@
+package backs
+
+import (
+	"back-bot/backs/model"
+	"maps"
+	"testing"
+)
+
+func TestPityWeights(t *testing.T) {
+	rules := PityRules{
+		model.Rare:     {SoftAfter: 50, SoftStep: 2, GuaranteedAfter: 100},
+		model.Rollback: {GuaranteedAfter: 500},
+	}
+
+	cases := []struct {
+		name       string
+		rollsSince map[model.Rarity]int
+		expected   map[model.Rarity]int
+	}{
+		{
+			name:       "no pity yet",
+			rollsSince: map[model.Rarity]int{model.Rare: 49},
+			expected:   model.DefaultRarityWeights,
+		},
+		{
+			name:       "soft pity starts",
+			rollsSince: map[model.Rarity]int{model.Rare: 50},
+			expected:   map[model.Rarity]int{model.Rollback: 2, model.Rare: 11, model.Uncommon: 80, model.Common: 309},
+		},
+		{
+			name:       "soft pity grows",
+			rollsSince: map[model.Rarity]int{model.Rare: 99},
+			expected:   map[model.Rarity]int{model.Rollback: 2, model.Rare: 109, model.Uncommon: 80, model.Common: 309},
+		},
+		{
+			name:       "guaranteed",
+			rollsSince: map[model.Rarity]int{model.Rare: 100},
+			expected:   map[model.Rarity]int{model.Rare: 1},
+		},
+		{
+			name:       "rarest guarantee wins",
+			rollsSince: map[model.Rarity]int{model.Rare: 100, model.Rollback: 500},
+			expected:   map[model.Rarity]int{model.Rollback: 1},
+		},
+	}
+
+	for _, c := range cases {
+		if actual := rules.weights(model.DefaultRarityWeights, c.rollsSince); !maps.Equal(actual, c.expected) {
+			t.Errorf("%s: expected weights %v, got %v", c.name, c.expected, actual)
+		}
+	}
+
+	if actual := PityRules(nil).weights(model.DefaultRarityWeights, map[model.Rarity]int{model.Rare: 1000}); !maps.Equal(actual, model.DefaultRarityWeights) {
+		t.Errorf("expected no pity rules to leave weights alone, got %v", actual)
+	}
+}
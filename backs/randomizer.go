@@ -2,38 +2,57 @@ package backs
 
 import (
 	"back-bot/backs/model"
+	"back-bot/logging"
 	"fmt"
 	"io/fs"
+	"log/slog"
 	"math/rand"
+	"path"
 )
 
 type BackMapping map[model.Rarity][]model.Back
 
-// GetBacks gets all the file paths assigned to their rarities
+// GetBacks gets all the file paths assigned to their rarities. Event pools are
+// left out, see GetEventBacks.
 func GetBacks(backfs fs.FS) (BackMapping, error) {
+	return getBacksIn(backfs, ".")
+}
+
+// GetEventBacks gets the file paths of an event's pool, under model.EventsDir,
+// assigned to their rarities.
+func GetEventBacks(backfs fs.FS, event string) (BackMapping, error) {
+	return getBacksIn(backfs, path.Join(model.EventsDir, event))
+}
 
+func getBacksIn(backfs fs.FS, dir string) (BackMapping, error) {
 	backMap := BackMapping{}
-	tiers, err := fs.ReadDir(backfs, ".")
+	tiers, err := fs.ReadDir(backfs, dir)
 	if err != nil {
-		fmt.Printf("what happened to my backs? %x\n", err)
+		slog.Error("what happened to my backs?", "dir", dir, logging.Err, err)
 		return nil, err
 	}
 	for _, tier := range tiers {
+		// files like MetadataFile can sit alongside the tiers
+		if !tier.IsDir() || dir == "." && tier.Name() == model.EventsDir {
+			continue
+		}
+
 		var backs []model.Back
 		rarityString := tier.Name()
+		rarityDir := path.Join(dir, rarityString)
 
 		rarity, err := model.LookUpRarity(rarityString)
 		if err != nil {
 			return nil, fmt.Errorf("unknown rarity encountered as member of back_repo: %w", err)
 		}
 
-		fs.WalkDir(backfs, rarityString, func(path string, d fs.DirEntry, err error) error {
+		fs.WalkDir(backfs, rarityDir, func(path string, d fs.DirEntry, err error) error {
 			if err != nil {
-				fmt.Printf("err while walking back_repo subdirectory. path: %s err: %s\n", path, err)
+				slog.Error("err while walking back_repo subdirectory", logging.BackPath, path, logging.Err, err)
 			}
 
 			// skip the rarity dir itself
-			if path == rarityString {
+			if path == rarityDir {
 				return nil
 			}
 
@@ -48,22 +67,33 @@ func GetBacks(backfs fs.FS) (BackMapping, error) {
 	return backMap, nil
 }
 
-func chooseBack(bl BackMapping) (model.Back, error) {
+func chooseBack(bl BackMapping, weights map[model.Rarity]int) (model.Back, error) {
+	rarity, err := rollRarity(weights)
+	if err != nil {
+		return model.Back{}, err
+	}
+	return pickFromBackList(bl, rarity)
+}
 
-	max := model.MaxRarity()
-	roll := rand.Intn(max)
-	fmt.Printf("rolled a %d\n", roll)
+// rollRarity picks a rarity with odds proportional to its weight.
+func rollRarity(weights map[model.Rarity]int) (model.Rarity, error) {
+	var total int
 	for _, r := range model.Rarities {
-		if roll <= int(r) {
-			back, err := pickFromBackList(bl, r)
-			if err != nil {
-				return model.Back{}, err
-			}
-			return back, nil
-		}
+		total += weights[r]
+	}
+	if total <= 0 {
+		return 0, fmt.Errorf("no rarity has a positive weight")
 	}
-	return model.Back{}, fmt.Errorf("no back was able to be chosen")
 
+	roll := rand.Intn(total)
+	slog.Debug("rolled for rarity", "roll", roll, "total", total)
+	for _, r := range model.Rarities {
+		roll -= weights[r]
+		if roll < 0 {
+			return r, nil
+		}
+	}
+	return 0, fmt.Errorf("no back was able to be chosen")
 }
 
 func pickFromBackList(bl BackMapping, rarity model.Rarity) (model.Back, error) {
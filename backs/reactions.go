@@ -0,0 +1,105 @@
+package backs
+
+import (
+	"back-bot/backs/detect"
+	"back-bot/logging"
+	"back-bot/metrics"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// BackReaction is the emoji members react to messages with to back.
+const BackReaction = "\U0001f519" // 🔙
+
+// emojiPresentation is the variation selector some clients send after emoji.
+const emojiPresentation = "\ufe0f"
+
+// reactionDedupWindow is how long a reaction back is remembered. Reacting to the same
+// message again within it, even after removing the reaction, doesn't back again.
+const reactionDedupWindow = 24 * time.Hour
+
+type ReactionHandler interface {
+	Handle(s *discordgo.Session, r *discordgo.MessageReactionAdd)
+}
+
+// reactionHandler plays a back for members who react to a message with a back emoji.
+type reactionHandler struct {
+	backs *backHandler
+	// reacted remembers each member that backed by reacting to each message
+	reacted *dedup[reactionKey]
+}
+
+type reactionKey struct {
+	messageID string
+	userID    string
+}
+
+var _ ReactionHandler = new(reactionHandler) // *reactionHandler implements ReactionHandler
+
+func NewReactionHandler(backs *backHandler) *reactionHandler {
+	return &reactionHandler{
+		backs:   backs,
+		reacted: newDedup[reactionKey](reactionDedupWindow),
+	}
+}
+
+// Handle is added as a handler to the Discord bot's connection, and is called
+// whenever someone reacts to a message in a channel the bot can see.
+func (r *reactionHandler) Handle(s *discordgo.Session, m *discordgo.MessageReactionAdd) {
+	logger := slog.With(
+		slog.String(logging.GuildID, m.GuildID),
+		slog.String(logging.ChannelID, m.ChannelID),
+		slog.String(logging.MessageID, m.MessageID),
+		slog.String(logging.UserID, m.UserID),
+	)
+
+	user, ok := r.backer(s, logger, m, time.Now())
+	if !ok {
+		return
+	}
+
+	logger.Info("reaction back detected, playing back")
+	metrics.ReactionBacks.Inc()
+
+	_, err := r.backs.back(s, logger, backRequest{
+		user:      user,
+		guildID:   m.GuildID,
+		channelID: m.ChannelID,
+		messageID: m.MessageID,
+		match:     detect.Match{Trigger: BackReaction},
+		reaction:  true,
+	})
+	if err != nil {
+		logger.Error("error handling reaction back", logging.Err, err)
+	}
+}
+
+// backer returns the member to back for the reaction, if it's a BackReaction that
+// the message policy allows and that member hasn't already backed the message with.
+func (r *reactionHandler) backer(s *discordgo.Session, logger *slog.Logger, m *discordgo.MessageReactionAdd, now time.Time) (*discordgo.User, bool) {
+	// custom emoji have IDs, and can't be the back emoji
+	if m.UserID == s.State.User.ID || m.Emoji.ID != "" {
+		return nil, false
+	}
+	if strings.TrimSuffix(m.Emoji.Name, emojiPresentation) != BackReaction {
+		return nil, false
+	}
+
+	user := &discordgo.User{ID: m.UserID}
+	if m.Member != nil && m.Member.User != nil {
+		user = m.Member.User
+	}
+	if user.Bot || r.backs.ignored(m.ChannelID, m.Member) {
+		return nil, false
+	}
+
+	if !r.reacted.claim(reactionKey{messageID: m.MessageID, userID: m.UserID}, now) {
+		logger.Debug("ignoring repeated reaction back")
+		return nil, false
+	}
+
+	return user, true
+}
@@ -0,0 +1,102 @@
+package backs
+
+import (
+	"log/slog"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestReactionBacker(t *testing.T) {
+	s := &discordgo.Session{State: discordgo.NewState()}
+	s.State.User = &discordgo.User{ID: "backbot"}
+
+	reaction := func(userID, emoji string) *discordgo.MessageReactionAdd {
+		return &discordgo.MessageReactionAdd{MessageReaction: &discordgo.MessageReaction{
+			UserID:    userID,
+			MessageID: "message",
+			ChannelID: "channel",
+			GuildID:   "guild",
+			Emoji:     discordgo.Emoji{Name: emoji},
+		}}
+	}
+
+	cases := []struct {
+		name     string
+		reaction *discordgo.MessageReactionAdd
+		expected bool
+	}{
+		{name: "back emoji", reaction: reaction("alice", BackReaction), expected: true},
+		{name: "back emoji with a variation selector", reaction: reaction("alice", BackReaction+emojiPresentation), expected: true},
+		{name: "other emoji", reaction: reaction("alice", "\U0001f44d")},
+		{name: "emoji spelling a back word", reaction: reaction("alice", "\U0001f1e7")},
+		{name: "custom emoji named back", reaction: func() *discordgo.MessageReactionAdd {
+			r := reaction("alice", "back")
+			r.Emoji.ID = "emoji"
+			return r
+		}()},
+		{name: "the bot's own reaction", reaction: reaction("backbot", BackReaction)},
+		{name: "bot reaction", reaction: func() *discordgo.MessageReactionAdd {
+			r := reaction("otherbot", BackReaction)
+			r.Member = &discordgo.Member{User: &discordgo.User{ID: "otherbot", Bot: true}}
+			return r
+		}()},
+		{name: "ignored role", reaction: func() *discordgo.MessageReactionAdd {
+			r := reaction("alice", BackReaction)
+			r.Member = &discordgo.Member{User: &discordgo.User{ID: "alice"}, Roles: []string{"muted"}}
+			return r
+		}()},
+	}
+
+	for _, tc := range cases {
+		b, _ := NewBackHandler(fstest.MapFS{}, nil)
+		b.SetMessagePolicy(MessagePolicy{IgnoreRoles: []string{"muted"}})
+		r := NewReactionHandler(b)
+
+		if _, actual := r.backer(s, slog.Default(), tc.reaction, time.Now()); actual != tc.expected {
+			t.Errorf("%s: expected backer to return %v", tc.name, tc.expected)
+		}
+	}
+}
+
+func TestReactionDedup(t *testing.T) {
+	s := &discordgo.Session{State: discordgo.NewState()}
+	s.State.User = &discordgo.User{ID: "backbot"}
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	b, _ := NewBackHandler(fstest.MapFS{}, nil)
+	r := NewReactionHandler(b)
+
+	reaction := func(userID, messageID string) *discordgo.MessageReactionAdd {
+		return &discordgo.MessageReactionAdd{MessageReaction: &discordgo.MessageReaction{
+			UserID:    userID,
+			MessageID: messageID,
+			ChannelID: "channel",
+			GuildID:   "guild",
+			Emoji:     discordgo.Emoji{Name: BackReaction},
+		}}
+	}
+
+	events := []struct {
+		name     string
+		reaction *discordgo.MessageReactionAdd
+		at       time.Duration
+		expected bool
+	}{
+		{name: "first reaction", reaction: reaction("alice", "message"), expected: true},
+		// removing a reaction isn't seen by the handler, so re-adding it is just another reaction
+		{name: "reacting again", reaction: reaction("alice", "message"), at: time.Minute},
+		{name: "re-adding after removing", reaction: reaction("alice", "message"), at: time.Hour},
+		{name: "someone else reacting", reaction: reaction("bob", "message"), at: time.Hour, expected: true},
+		{name: "reacting to another message", reaction: reaction("alice", "other message"), at: time.Hour, expected: true},
+		{name: "reacting after the window", reaction: reaction("alice", "message"), at: reactionDedupWindow + time.Second, expected: true},
+	}
+
+	for _, e := range events {
+		if _, actual := r.backer(s, slog.Default(), e.reaction, start.Add(e.at)); actual != e.expected {
+			t.Errorf("%s: expected backer to return %v", e.name, e.expected)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package backs
+
+import (
+	"back-bot/backs/settings"
+	"back-bot/logging"
+	"back-bot/metrics"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var RejoinCmd = &discordgo.ApplicationCommand{
+	Name:         "rejoin",
+	Description:  "Backs for members who leave voice and come back",
+	Type:         discordgo.ChatApplicationCommand,
+	DMPermission: &falseVar,
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "status",
+			Description: "Check whether rejoin backs are on for this server and for you",
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "enable",
+			Description: "Turn on rejoin backs for this server",
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "disable",
+			Description: "Turn off rejoin backs for this server",
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "opt-out",
+			Description: "Stop getting backed when you rejoin voice",
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "opt-in",
+			Description: "Get backed when you rejoin voice again",
+		},
+	},
+}
+
+type VoiceStateHandler interface {
+	Handle(s *discordgo.Session, v *discordgo.VoiceStateUpdate)
+}
+
+// rejoinHandler plays a back for members who reconnect to voice shortly after leaving.
+type rejoinHandler struct {
+	backs    *backHandler
+	settings *settings.Store
+	// window is how soon after leaving a member must reconnect to be backed
+	window     time.Duration
+	adminRoles []string
+
+	mu sync.Mutex
+	// left is when each member last left voice, keyed by guild and user
+	left map[rejoinKey]time.Time
+}
+
+type rejoinKey struct {
+	guildID string
+	userID  string
+}
+
+var _ VoiceStateHandler = new(rejoinHandler) // *rejoinHandler implements VoiceStateHandler
+
+func NewRejoinHandler(backs *backHandler, store *settings.Store, window time.Duration, adminRoles []string) *rejoinHandler {
+	return &rejoinHandler{
+		backs:      backs,
+		settings:   store,
+		window:     window,
+		adminRoles: adminRoles,
+		left:       make(map[rejoinKey]time.Time),
+	}
+}
+
+// Handle is added as a handler to the Discord bot's connection, and is called
+// whenever a member joins, leaves or moves between voice channels.
+func (r *rejoinHandler) Handle(s *discordgo.Session, v *discordgo.VoiceStateUpdate) {
+	if r.window <= 0 || v.UserID == s.State.User.ID {
+		return
+	}
+	if v.Member != nil && v.Member.User != nil && v.Member.User.Bot {
+		return
+	}
+
+	key := rejoinKey{guildID: v.GuildID, userID: v.UserID}
+	now := time.Now()
+
+	if v.ChannelID == "" {
+		r.recordLeave(key, now)
+		return
+	}
+
+	if !r.rejoined(key, now) {
+		return
+	}
+
+	guild, _ := r.settings.Get(v.GuildID)
+	if !rejoinBacksFor(guild, v.UserID) {
+		return
+	}
+
+	logger := slog.With(slog.String(logging.GuildID, v.GuildID), slog.String(logging.ChannelID, v.ChannelID), slog.String(logging.UserID, v.UserID))
+	logger.Info("member rejoined voice, playing back")
+
+	user := &discordgo.User{ID: v.UserID}
+	if v.Member != nil && v.Member.User != nil {
+		user = v.Member.User
+	}
+
+	allowed, err := r.backs.whoUnlessCoolingDown(s, logger, BackInfo{
+		VoiceState: v.VoiceState,
+		Back:       user,
+	})
+	if err != nil {
+		logger.Error("error playing rejoin back", logging.Err, err)
+	}
+	if allowed {
+		metrics.VoiceRejoinBacks.Inc()
+	}
+}
+
+// rejoinBacksFor reports whether the guild backs the member when they rejoin voice.
+func rejoinBacksFor(guild settings.GuildSettings, userID string) bool {
+	return guild.RejoinBacks && !slices.Contains(guild.RejoinOptOut, userID)
+}
+
+// recordLeave notes that the member left voice at now, forgetting anyone whose window has passed.
+func (r *rejoinHandler) recordLeave(key rejoinKey, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for k, left := range r.left {
+		if now.Sub(left) > r.window {
+			delete(r.left, k)
+		}
+	}
+	r.left[key] = now
+}
+
+// rejoined reports whether the member is connecting within the window after leaving.
+// Moving between channels doesn't count, since the member never left.
+func (r *rejoinHandler) rejoined(key rejoinKey, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	left, ok := r.left[key]
+	if !ok {
+		return false
+	}
+	delete(r.left, key)
+
+	return now.Sub(left) <= r.window
+}
+
+func (r *rejoinHandler) Rejoin(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	subcommand := i.ApplicationCommandData().Options[0]
+
+	user := i.Member.User
+	if user == nil {
+		user = i.User
+	}
+
+	var content string
+	update := func(change func(*settings.GuildSettings)) error {
+		return r.settings.Update(i.GuildID, func(g *settings.GuildSettings) error {
+			change(g)
+			return nil
+		})
+	}
+
+	var err error
+	switch subcommand.Name {
+	case "status":
+		guild, _ := r.settings.Get(i.GuildID)
+		switch {
+		case r.window <= 0:
+			content = "Rejoin backs are turned off for everyone."
+		case !guild.RejoinBacks:
+			content = "Rejoin backs are off in this server."
+		case slices.Contains(guild.RejoinOptOut, user.ID):
+			content = "Rejoin backs are on in this server, but you've opted out."
+		default:
+			content = fmt.Sprintf("Rejoin backs are on! Leave voice and come back within %s to get backed.", r.window)
+		}
+	case "enable", "disable":
+		if !isAdmin(i, r.adminRoles) {
+			respond(s, i, "Only server admins can turn rejoin backs on or off.", true)
+			return
+		}
+		enabled := subcommand.Name == "enable"
+		err = update(func(g *settings.GuildSettings) { g.RejoinBacks = enabled })
+		content = fmt.Sprintf("Rejoin backs are now %sd for this server.", subcommand.Name)
+	case "opt-out":
+		err = update(func(g *settings.GuildSettings) {
+			if !slices.Contains(g.RejoinOptOut, user.ID) {
+				g.RejoinOptOut = append(g.RejoinOptOut, user.ID)
+			}
+		})
+		content = "You won't be backed when you rejoin voice here."
+	case "opt-in":
+		err = update(func(g *settings.GuildSettings) {
+			g.RejoinOptOut = slices.DeleteFunc(g.RejoinOptOut, func(id string) bool { return id == user.ID })
+		})
+		content = "You'll be backed when you rejoin voice here, if the server has rejoin backs on."
+	}
+
+	if err != nil {
+		slog.Error("failed to update guild settings", append(logging.InteractionAttrs(i), logging.Err, err)...)
+		respond(s, i, "Something went wrong saving that. Try again later.", true)
+		return
+	}
+
+	respond(s, i, content, true)
+}
@@ -0,0 +1,103 @@
+package backs
+
+import (
+	"back-bot/backs/settings"
+	"testing"
+	"time"
+)
+
+func TestRejoinWindow(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	alice := rejoinKey{guildID: "guild", userID: "alice"}
+	bob := rejoinKey{guildID: "guild", userID: "bob"}
+	aliceElsewhere := rejoinKey{guildID: "other", userID: "alice"}
+
+	type event struct {
+		leave    bool
+		key      rejoinKey
+		at       time.Duration
+		expected bool
+	}
+
+	cases := []struct {
+		name   string
+		events []event
+	}{
+		{name: "rejoin inside the window", events: []event{
+			{leave: true, key: alice},
+			{key: alice, at: time.Minute, expected: true},
+		}},
+		{name: "rejoin right at the end of the window", events: []event{
+			{leave: true, key: alice},
+			{key: alice, at: 2 * time.Minute, expected: true},
+		}},
+		{name: "rejoin outside the window", events: []event{
+			{leave: true, key: alice},
+			{key: alice, at: 2*time.Minute + time.Second},
+		}},
+		{name: "joining without leaving", events: []event{
+			{key: alice},
+		}},
+		{name: "moving between channels", events: []event{
+			{leave: true, key: alice},
+			{key: alice, at: time.Second, expected: true},
+			// a move is a voice state update with a channel, but no leave before it
+			{key: alice, at: 2 * time.Second},
+		}},
+		{name: "leaving another guild", events: []event{
+			{leave: true, key: aliceElsewhere},
+			{key: alice, at: time.Second},
+		}},
+		{name: "someone else leaving", events: []event{
+			{leave: true, key: bob},
+			{key: alice, at: time.Second},
+			{key: bob, at: time.Second, expected: true},
+		}},
+	}
+
+	for _, tc := range cases {
+		r := NewRejoinHandler(nil, nil, 2*time.Minute, nil)
+		for i, e := range tc.events {
+			now := start.Add(e.at)
+			if e.leave {
+				r.recordLeave(e.key, now)
+				continue
+			}
+			if actual := r.rejoined(e.key, now); actual != e.expected {
+				t.Errorf("%s: event %d: expected rejoined to be %v", tc.name, i, e.expected)
+			}
+		}
+	}
+}
+
+func TestRejoinPrunesOldLeaves(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	r := NewRejoinHandler(nil, nil, time.Minute, nil)
+
+	r.recordLeave(rejoinKey{guildID: "guild", userID: "alice"}, start)
+	r.recordLeave(rejoinKey{guildID: "guild", userID: "bob"}, start.Add(30*time.Second))
+	r.recordLeave(rejoinKey{guildID: "guild", userID: "carol"}, start.Add(90*time.Second))
+
+	if _, ok := r.left[rejoinKey{guildID: "guild", userID: "alice"}]; ok || len(r.left) != 2 {
+		t.Fatalf("expected leaves outside the window to be forgotten, got %v", r.left)
+	}
+}
+
+func TestRejoinBacksFor(t *testing.T) {
+	cases := []struct {
+		name     string
+		guild    settings.GuildSettings
+		expected bool
+	}{
+		{name: "guild hasn't opted in", guild: settings.GuildSettings{}},
+		{name: "guild opted in", guild: settings.GuildSettings{RejoinBacks: true}, expected: true},
+		{name: "member opted out", guild: settings.GuildSettings{RejoinBacks: true, RejoinOptOut: []string{"bob", "alice"}}},
+		{name: "someone else opted out", guild: settings.GuildSettings{RejoinBacks: true, RejoinOptOut: []string{"bob"}}, expected: true},
+	}
+
+	for _, tc := range cases {
+		if actual := rejoinBacksFor(tc.guild, "alice"); actual != tc.expected {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, actual)
+		}
+	}
+}
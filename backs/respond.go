@@ -0,0 +1,53 @@
+package backs
+
+import (
+	"back-bot/logging"
+	"log/slog"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// respond sends a plain message in response to the interaction, logging any failure.
+func respond(s *discordgo.Session, i *discordgo.InteractionCreate, content string, ephemeral bool) {
+	var flags discordgo.MessageFlags
+	if ephemeral {
+		flags = discordgo.MessageFlagsEphemeral
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags:   flags,
+			Content: content,
+		},
+	})
+	if err != nil {
+		slog.Error("error sending interaction response", append(logging.InteractionAttrs(i), logging.Err, err)...)
+	}
+}
+
+// maxChoices is the most autocomplete choices Discord accepts in one response.
+const maxChoices = 25
+
+// respondChoices sends autocomplete choices in response to the interaction, logging any failure.
+func respondChoices(s *discordgo.Session, i *discordgo.InteractionCreate, choices []*discordgo.ApplicationCommandOptionChoice) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+	if err != nil {
+		slog.Error("failed to send autocomplete response", append(logging.InteractionAttrs(i), logging.Err, err)...)
+	}
+}
+
+// sendDM messages the user privately, which fails if they don't accept DMs.
+func sendDM(s *discordgo.Session, userID, content string) error {
+	channel, err := s.UserChannelCreate(userID)
+	if err != nil {
+		return err
+	}
+	_, err = s.ChannelMessageSend(channel.ID, content)
+	return err
+}
@@ -0,0 +1,117 @@
+package backs
+
+import (
+	"back-bot/backs/model"
+	"back-bot/backs/settings"
+	"fmt"
+	"math/rand"
+	"slices"
+	"sync"
+)
+
+// Strategies for picking which back of a rolled rarity plays.
+const (
+	// SelectUniform picks any back of the rarity with equal odds, every time.
+	SelectUniform = "uniform"
+	// SelectShuffle plays every back of the rarity, in a random order, before repeating any.
+	SelectShuffle = "shuffle"
+)
+
+// Selection decides which back of a rolled rarity plays.
+type Selection struct {
+	Strategy string
+	// NoRepeat is how many of the guild's most recent backs can't play again. Zero allows repeats.
+	NoRepeat int
+}
+
+// backSelector picks backs for each guild, remembering what the guild has played.
+type backSelector struct {
+	defaults Selection
+	// settings holds per-guild overrides of the defaults
+	settings *settings.Store
+
+	mu     sync.Mutex
+	guilds map[string]*guildSelection
+}
+
+type guildSelection struct {
+	// bags are the backs of each rarity not yet played from the current shuffle
+	bags map[model.Rarity][]model.Back
+	// recent are the guild's most recently played backs, most recent last
+	recent []model.Back
+}
+
+func newBackSelector(defaults Selection) *backSelector {
+	return &backSelector{
+		defaults: defaults,
+		guilds:   make(map[string]*guildSelection),
+	}
+}
+
+// selection returns the guild's selection, which may override the defaults.
+func (s *backSelector) selection(guildID string) Selection {
+	if s.settings != nil {
+		if guild, _ := s.settings.Get(guildID); guild.Selection != "" {
+			return Selection{Strategy: guild.Selection, NoRepeat: guild.NoRepeat}
+		}
+	}
+	return s.defaults
+}
+
+// pick chooses one of backs, all of the same rarity, to play in the guild.
+func (s *backSelector) pick(guildID string, rarity model.Rarity, backs []model.Back) (model.Back, error) {
+	if len(backs) == 0 {
+		return model.Back{}, fmt.Errorf("no backs of rarity %s to choose from", rarity)
+	}
+
+	selection := s.selection(guildID)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	guild, ok := s.guilds[guildID]
+	if !ok {
+		guild = &guildSelection{bags: make(map[model.Rarity][]model.Back)}
+		s.guilds[guildID] = guild
+	}
+
+	// avoid recent backs, unless that rules out every back
+	recent := guild.recent[max(len(guild.recent)-selection.NoRepeat, 0):]
+	candidates := slices.DeleteFunc(slices.Clone(backs), func(b model.Back) bool { return slices.Contains(recent, b) })
+	if len(candidates) == 0 {
+		candidates = backs
+	}
+
+	var back model.Back
+	switch selection.Strategy {
+	case SelectShuffle:
+		back = guild.draw(rarity, backs, candidates)
+	default:
+		back = candidates[rand.Intn(len(candidates))]
+	}
+
+	guild.recent = append(guild.recent, back)
+	if excess := len(guild.recent) - selection.NoRepeat; excess > 0 {
+		guild.recent = slices.Delete(guild.recent, 0, excess)
+	}
+
+	return back, nil
+}
+
+// draw takes the next candidate from the rarity's bag, refilling it with a new
+// shuffle of backs once every back has been drawn.
+func (g *guildSelection) draw(rarity model.Rarity, backs, candidates []model.Back) model.Back {
+	bag := g.bags[rarity]
+
+	index := slices.IndexFunc(bag, func(b model.Back) bool { return slices.Contains(candidates, b) })
+	if index < 0 {
+		bag = slices.Clone(backs)
+		rand.Shuffle(len(bag), func(i, j int) { bag[i], bag[j] = bag[j], bag[i] })
+
+		index = slices.IndexFunc(bag, func(b model.Back) bool { return slices.Contains(candidates, b) })
+	}
+
+	back := bag[index]
+	g.bags[rarity] = slices.Delete(bag, index, index+1)
+	return back
+}
@@ -0,0 +1,67 @@
+package backs
+
+import (
+	"back-bot/backs/model"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func testBacks(n int) []model.Back {
+	var backs []model.Back
+	for i := range n {
+		back, _ := model.GetBack(fmt.Sprintf("Common/back-%d.dca", i))
+		backs = append(backs, back)
+	}
+	return backs
+}
+
+func TestShuffleSelection(t *testing.T) {
+	backs := testBacks(5)
+	selector := newBackSelector(Selection{Strategy: SelectShuffle})
+
+	for round := range 20 {
+		var played []model.Back
+		for range len(backs) {
+			back, err := selector.pick("guild", model.Common, backs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			played = append(played, back)
+		}
+
+		slices.SortFunc(played, func(a, b model.Back) int { return strings.Compare(a.Path(), b.Path()) })
+		if !slices.Equal(played, backs) {
+			t.Fatalf("round %d: expected every back to play once before repeating, got %v", round, played)
+		}
+	}
+}
+
+func TestNoRepeatSelection(t *testing.T) {
+	backs := testBacks(4)
+
+	for _, strategy := range []string{SelectUniform, SelectShuffle} {
+		selector := newBackSelector(Selection{Strategy: strategy, NoRepeat: 3})
+
+		var played []model.Back
+		for range 200 {
+			back, err := selector.pick("guild", model.Common, backs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if recent := played[max(len(played)-3, 0):]; slices.Contains(recent, back) {
+				t.Fatalf("%s: %v played again within 3 backs: %v", strategy, back, recent)
+			}
+			played = append(played, back)
+		}
+	}
+
+	// a constraint that rules out every back is relaxed rather than failing
+	selector := newBackSelector(Selection{Strategy: SelectUniform, NoRepeat: 10})
+	for range 10 {
+		if _, err := selector.pick("guild", model.Common, backs[:1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
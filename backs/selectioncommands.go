@@ -0,0 +1,103 @@
+package backs
+
+import (
+	"back-bot/backs/settings"
+	"back-bot/logging"
+	"fmt"
+	"log/slog"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxNoRepeat bounds how many recent backs a guild can keep from repeating.
+const maxNoRepeat = 50
+
+// selectionDefault is the /backselection strategy choice that clears the guild's override.
+const selectionDefault = "default"
+
+var noRepeatMin = float64(0)
+
+var BackSelectionCmd = &discordgo.ApplicationCommand{
+	Name:         "backselection",
+	Description:  "See or change how this server picks which back plays",
+	Type:         discordgo.ChatApplicationCommand,
+	DMPermission: &falseVar,
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "strategy",
+			Description: "uniform picks at random every time, shuffle plays every back before repeating",
+			Choices: []*discordgo.ApplicationCommandOptionChoice{
+				{Name: SelectUniform, Value: SelectUniform},
+				{Name: SelectShuffle, Value: SelectShuffle},
+				{Name: "bot default", Value: selectionDefault},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionInteger,
+			Name:        "no-repeat",
+			Description: "How many of the most recent backs can't play again",
+			MinValue:    &noRepeatMin,
+			MaxValue:    maxNoRepeat,
+		},
+	},
+}
+
+type backSelectionCmdHandler struct {
+	selector   *backSelector
+	settings   *settings.Store
+	adminRoles []string
+}
+
+func NewBackSelectionCmdHandler(b *backHandler, store *settings.Store, adminRoles []string) *backSelectionCmdHandler {
+	return &backSelectionCmdHandler{
+		selector:   b.selector,
+		settings:   store,
+		adminRoles: adminRoles,
+	}
+}
+
+func (h *backSelectionCmdHandler) BackSelection(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	options := i.ApplicationCommandData().Options
+
+	if len(options) == 0 {
+		selection := h.selector.selection(i.GuildID)
+		respond(s, i, fmt.Sprintf("This server uses **%s** selection, and won't repeat the last %d backs.", selection.Strategy, selection.NoRepeat), true)
+		return
+	}
+
+	if !isAdmin(i, h.adminRoles) {
+		respond(s, i, "Only server admins can change how backs are picked.", true)
+		return
+	}
+
+	err := h.settings.Update(i.GuildID, func(g *settings.GuildSettings) error {
+		// start from the defaults, so changing one option keeps the other
+		if g.Selection == "" {
+			g.Selection, g.NoRepeat = h.selector.defaults.Strategy, h.selector.defaults.NoRepeat
+		}
+
+		for _, option := range options {
+			switch option.Name {
+			case "strategy":
+				g.Selection = option.StringValue()
+			case "no-repeat":
+				g.NoRepeat = int(option.IntValue())
+			}
+		}
+
+		if g.Selection == selectionDefault {
+			g.Selection, g.NoRepeat = "", 0
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Error("failed to update guild settings", append(logging.InteractionAttrs(i), logging.Err, err)...)
+		respond(s, i, "Something went wrong saving that. Try again later.", true)
+		return
+	}
+
+	selection := h.selector.selection(i.GuildID)
+	slog.Info("guild back selection changed", append(logging.InteractionAttrs(i), "strategy", selection.Strategy, "no_repeat", selection.NoRepeat)...)
+	respond(s, i, fmt.Sprintf("This server now uses **%s** selection, and won't repeat the last %d backs.", selection.Strategy, selection.NoRepeat), true)
+}
@@ -0,0 +1,136 @@
+// Package settings persists per-guild configuration that admins change at runtime.
+package settings
+
+import (
+	"back-bot/backs/jsonfile"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// GuildSettings is everything configurable about a single guild.
+type GuildSettings struct {
+	// Words are extra trigger words, on top of the built in BackWords.
+	Words []string `json:"words,omitempty"`
+	// Exclusions are words or phrases that triggers inside of don't count.
+	Exclusions []string `json:"exclusions,omitempty"`
+	// Patterns are regular expression triggers.
+	Patterns []string `json:"patterns,omitempty"`
+
+	// RejoinBacks opts the guild in to backs for members who rejoin voice.
+	RejoinBacks bool `json:"rejoin_backs,omitempty"`
+	// RejoinOptOut are the IDs of members who don't want rejoin backs.
+	RejoinOptOut []string `json:"rejoin_opt_out,omitempty"`
+
+	// Selection overrides the strategy for picking which back of a rarity plays.
+	// If empty, the bot's default is used.
+	Selection string `json:"selection,omitempty"`
+	// NoRepeat is how many of the guild's most recent backs can't play again, if Selection is set.
+	NoRepeat int `json:"no_repeat,omitempty"`
+}
+
+func (g GuildSettings) clone() GuildSettings {
+	g.Words = slices.Clone(g.Words)
+	g.Exclusions = slices.Clone(g.Exclusions)
+	g.Patterns = slices.Clone(g.Patterns)
+	g.RejoinOptOut = slices.Clone(g.RejoinOptOut)
+	return g
+}
+
+type guildEntry struct {
+	settings GuildSettings
+	// revision increments on every update, so consumers can cache derived state
+	revision int
+}
+
+// Store holds every guild's settings, persisting them as JSON after each update.
+type Store struct {
+	path string
+
+	mu     sync.RWMutex
+	guilds map[string]*guildEntry
+}
+
+// Open loads the store from path, which is created on the first update if it doesn't exist.
+// If path is empty, settings are kept in memory only.
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path:   path,
+		guilds: make(map[string]*guildEntry),
+	}
+
+	if path == "" {
+		return s, nil
+	}
+
+	var guilds map[string]GuildSettings
+	if err := jsonfile.Read(path, &guilds); err != nil {
+		return nil, fmt.Errorf("failed to load guild settings: %w", err)
+	}
+
+	for guildID, settings := range guilds {
+		s.guilds[guildID] = &guildEntry{settings: settings, revision: 1}
+	}
+
+	return s, nil
+}
+
+// Get returns a copy of the guild's settings, and their revision. Guilds that
+// have never been configured are at revision 0.
+func (s *Store) Get(guildID string) (GuildSettings, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entry, ok := s.guilds[guildID]
+	if !ok {
+		return GuildSettings{}, 0
+	}
+	return entry.settings.clone(), entry.revision
+}
+
+// Update applies update to the guild's settings and persists the result.
+// If update returns an error, the settings are left unchanged.
+func (s *Store) Update(guildID string, update func(*GuildSettings) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.guilds[guildID]
+	if !ok {
+		entry = new(guildEntry)
+	}
+
+	updated := entry.settings.clone()
+	if err := update(&updated); err != nil {
+		return err
+	}
+
+	prev := entry.settings
+	entry.settings = updated
+	s.guilds[guildID] = entry
+
+	if err := s.save(); err != nil {
+		entry.settings = prev
+		return err
+	}
+
+	entry.revision++
+	return nil
+}
+
+// save writes every guild's settings to disk. Callers must hold s.mu.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	guilds := make(map[string]GuildSettings, len(s.guilds))
+	for guildID, entry := range s.guilds {
+		guilds[guildID] = entry.settings
+	}
+
+	if err := jsonfile.Write(s.path, guilds); err != nil {
+		return fmt.Errorf("failed to save guild settings: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package settings
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestStorePersistsUpdates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "guild_settings.json")
+
+	store, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, revision := store.Get("guild"); revision != 0 {
+		t.Fatalf("expected unconfigured guild at revision 0, got %d", revision)
+	}
+
+	err = store.Update("guild", func(g *GuildSettings) error {
+		g.Words = append(g.Words, "atrás")
+		g.Patterns = append(g.Patterns, "b+a+c+k+")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refused := errors.New("refused")
+	err = store.Update("guild", func(g *GuildSettings) error {
+		g.Words = nil
+		return refused
+	})
+	if !errors.Is(err, refused) {
+		t.Fatalf("expected update error to be returned, got %v", err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	guild, revision := reopened.Get("guild")
+	if revision == 0 {
+		t.Fatal("expected loaded guild to have a non-zero revision")
+	}
+	if !slices.Equal(guild.Words, []string{"atrás"}) || !slices.Equal(guild.Patterns, []string{"b+a+c+k+"}) {
+		t.Fatalf("unexpected settings after reopening: %+v", guild)
+	}
+}
@@ -0,0 +1,176 @@
+// Package stats counts which trigger words, and which languages, backs are detected with.
+package stats
+
+import (
+	"back-bot/backs/jsonfile"
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Counts are how many backs each trigger word and language has detected.
+type Counts struct {
+	Triggers  map[string]int `json:"triggers"`
+	Languages map[string]int `json:"languages"`
+}
+
+func (c Counts) clone() Counts {
+	return Counts{
+		Triggers:  maps.Clone(c.Triggers),
+		Languages: maps.Clone(c.Languages),
+	}
+}
+
+func (c *Counts) add(trigger string, languages []string) {
+	if c.Triggers == nil {
+		c.Triggers = make(map[string]int)
+	}
+	if c.Languages == nil {
+		c.Languages = make(map[string]int)
+	}
+
+	c.Triggers[trigger]++
+	for _, language := range languages {
+		c.Languages[language]++
+	}
+}
+
+// Store holds every guild's counts, persisting them as JSON. Counts are saved after
+// a back once the last save is older than the flush interval, and by Flush.
+type Store struct {
+	path          string
+	flushInterval time.Duration
+
+	mu     sync.RWMutex
+	guilds map[string]*Counts
+	// dirty is set when the counts have changed since they were last saved
+	dirty     bool
+	lastFlush time.Time
+}
+
+// Open loads the store from path, which is created on the first save if it doesn't exist.
+// If path is empty, counts are kept in memory only.
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path:   path,
+		guilds: make(map[string]*Counts),
+	}
+
+	if path == "" {
+		return s, nil
+	}
+
+	if err := jsonfile.Read(path, &s.guilds); err != nil {
+		return nil, fmt.Errorf("failed to load back stats: %w", err)
+	}
+
+	return s, nil
+}
+
+// SetFlushInterval saves counts at most once per interval, rather than after every back.
+func (s *Store) SetFlushInterval(interval time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.flushInterval = interval
+}
+
+// Record counts a back in the guild, detected by trigger, which means "back" in each of languages.
+// The count is kept even if it fails to persist.
+func (s *Store) Record(guildID, trigger string, languages []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts, ok := s.guilds[guildID]
+	if !ok {
+		counts = new(Counts)
+		s.guilds[guildID] = counts
+	}
+	counts.add(trigger, languages)
+	s.dirty = true
+
+	if time.Since(s.lastFlush) <= s.flushInterval {
+		return nil
+	}
+	return s.flush()
+}
+
+// Flush saves the counts if they've changed since they were last saved.
+func (s *Store) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.flush()
+}
+
+// flush saves the counts if they're dirty. Callers must hold s.mu.
+func (s *Store) flush() error {
+	if !s.dirty || s.path == "" {
+		return nil
+	}
+
+	if err := jsonfile.Write(s.path, s.guilds); err != nil {
+		return fmt.Errorf("failed to save back stats: %w", err)
+	}
+	s.dirty = false
+	s.lastFlush = time.Now()
+	return nil
+}
+
+// Guild returns a copy of the guild's counts.
+func (s *Store) Guild(guildID string) Counts {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts, ok := s.guilds[guildID]
+	if !ok {
+		return Counts{}
+	}
+	return counts.clone()
+}
+
+// Total returns the counts across every guild.
+func (s *Store) Total() Counts {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	total := Counts{
+		Triggers:  make(map[string]int),
+		Languages: make(map[string]int),
+	}
+	for _, counts := range s.guilds {
+		for trigger, n := range counts.Triggers {
+			total.Triggers[trigger] += n
+		}
+		for language, n := range counts.Languages {
+			total.Languages[language] += n
+		}
+	}
+	return total
+}
+
+// Entry is a name and its count.
+type Entry struct {
+	Name  string
+	Count int
+}
+
+// Top returns the n highest counts, highest first, with ties in name order.
+func Top(counts map[string]int, n int) []Entry {
+	entries := make([]Entry, 0, len(counts))
+	for name, count := range counts {
+		entries = append(entries, Entry{Name: name, Count: count})
+	}
+
+	slices.SortFunc(entries, func(a, b Entry) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	return entries[:min(n, len(entries))]
+}
@@ -0,0 +1,85 @@
+package stats
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestStoreRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "back_stats.json")
+
+	store, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := []struct {
+		guildID   string
+		trigger   string
+		languages []string
+	}{
+		{"guild1", "back", []string{"English"}},
+		{"guild1", "back", []string{"English"}},
+		{"guild1", "назад", []string{"Macedonian", "Russian"}},
+		{"guild2", "back", []string{"English"}},
+		{"guild2", "zurück", []string{"German"}},
+	}
+	for _, r := range records {
+		if err := store.Record(r.guildID, r.trigger, r.languages); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	guild := reopened.Guild("guild1")
+	if guild.Triggers["back"] != 2 || guild.Languages["Russian"] != 1 || guild.Languages["German"] != 0 {
+		t.Fatalf("unexpected guild counts after reopening: %+v", guild)
+	}
+
+	total := reopened.Total()
+	expected := []Entry{{"English", 3}, {"German", 1}, {"Macedonian", 1}}
+	if top := Top(total.Languages, 3); !slices.Equal(top, expected) {
+		t.Fatalf("expected top languages %v, got %v", expected, top)
+	}
+}
+
+func TestStoreFlushInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "back_stats.json")
+
+	store, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SetFlushInterval(time.Hour)
+
+	saved := func() int {
+		reopened, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return reopened.Guild("guild").Triggers["back"]
+	}
+
+	// nothing has been saved yet, so the first back is
+	for range 3 {
+		if err := store.Record("guild", "back", []string{"English"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := saved(); n != 1 {
+		t.Fatalf("expected only the first back to be saved inside the flush interval, got %d", n)
+	}
+
+	if err := store.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if n := saved(); n != 3 {
+		t.Fatalf("expected every back to be saved after flushing, got %d", n)
+	}
+}
@@ -1,94 +1,150 @@
 package backs
 
-var BackWords = []string{
-	"prapa",
-	"Atzera",
-	"таму",
-	"natrag",
-	"обратно",
-	"esquena",
-	"natrag",
-	"zpět",
-	"tilbage",
-	"terug",
-	"tagasi",
-	"takaisin",
-	"arrière",
-	"de volta",
-	"zurück",
-	"πίσω",
-	"vissza",
-	"aftur",
-	"ar ais",
-	"indietro",
-	"atpakaļ",
-	"atgal",
-	"назад",
-	"lura",
-	"tilbake",
-	"plecy",
-	"costas",
-	"spate",
-	"назад",
-	"назад",
-	"späť",
-	"nazaj",
-	"espalda",
-	"tillbaka",
-	"назад",
-	"yn ôl",
-	"צוריק",
-	"ետ",
-	"geri",
-	"পিছনে",
-	"背部",
-	"後面",
-	"უკან",
-	"પાછા",
-	"वापस",
-	"rov qab",
-	"バック",
-	"ಮತ್ತೆ",
-	"артқа",
-	"ត្រឡប់​មក​វិញ",
-	"백",
-	"ກັບ​ຄືນ​ໄປ​ບ່ອນ",
-	"തിരികെ",
-	"परत",
-	"буцах",
-	"နောက်ကျော",
-	"फिर्ता",
-	"ආපසු",
-	"бозгашт",
-	"மீண்டும்",
-	"తిరిగి",
-	"กลับ",
-	"واپس",
-	"orqa",
-	"trở lại",
-	"إلى الوراء",
-	"חזור",
-	"بازگشت",
-	"geri",
-	"terug",
-	"mmbuyo",
-	"baya",
-	"azụ",
-	"khutlela",
-	"dib",
-	"nyuma",
-	"pada",
-	"emuva",
-	"balik",
-	"likod",
-	"kembali",
-	"bali",
-	"indray",
-	"kembali",
-	"hoki",
-	"reen",
-	"tounen",
-	"back",
-	"\U0001f519",
-	"⠃⠁⠉⠅",
+import (
+	"back-bot/backs/detect"
+	"hash/fnv"
+	"time"
+)
+
+// BackWord is a trigger word, and the language it means "back" in.
+type BackWord struct {
+	Word     string
+	Language string
+}
+
+var BackWordLanguages = []BackWord{
+	{"prapa", "Albanian"},
+	{"Atzera", "Basque"},
+	{"таму", "Belarusian"},
+	{"natrag", "Bosnian"},
+	{"обратно", "Bulgarian"},
+	{"esquena", "Catalan"},
+	{"natrag", "Croatian"},
+	{"zpět", "Czech"},
+	{"tilbage", "Danish"},
+	{"terug", "Dutch"},
+	{"tagasi", "Estonian"},
+	{"takaisin", "Finnish"},
+	{"arrière", "French"},
+	{"de volta", "Galician"},
+	{"zurück", "German"},
+	{"πίσω", "Greek"},
+	{"vissza", "Hungarian"},
+	{"aftur", "Icelandic"},
+	{"ar ais", "Irish"},
+	{"indietro", "Italian"},
+	{"atpakaļ", "Latvian"},
+	{"atgal", "Lithuanian"},
+	{"назад", "Macedonian"},
+	{"lura", "Maltese"},
+	{"tilbake", "Norwegian"},
+	{"plecy", "Polish"},
+	{"costas", "Portuguese"},
+	{"spate", "Romanian"},
+	{"назад", "Russian"},
+	{"назад", "Serbian"},
+	{"späť", "Slovak"},
+	{"nazaj", "Slovenian"},
+	{"espalda", "Spanish"},
+	{"tillbaka", "Swedish"},
+	{"назад", "Ukrainian"},
+	{"yn ôl", "Welsh"},
+	{"צוריק", "Yiddish"},
+	{"ետ", "Armenian"},
+	{"geri", "Azerbaijani"},
+	{"পিছনে", "Bengali"},
+	{"背部", "Chinese (Simplified)"},
+	{"後面", "Chinese (Traditional)"},
+	{"უკან", "Georgian"},
+	{"પાછા", "Gujarati"},
+	{"वापस", "Hindi"},
+	{"rov qab", "Hmong"},
+	{"バック", "Japanese"},
+	{"ಮತ್ತೆ", "Kannada"},
+	{"артқа", "Kazakh"},
+	{"ត្រឡប់​មក​វិញ", "Khmer"},
+	{"백", "Korean"},
+	{"ກັບ​ຄືນ​ໄປ​ບ່ອນ", "Lao"},
+	{"തിരികെ", "Malayalam"},
+	{"परत", "Marathi"},
+	{"буцах", "Mongolian"},
+	{"နောက်ကျော", "Myanmar (Burmese)"},
+	{"फिर्ता", "Nepali"},
+	{"ආපසු", "Sinhala"},
+	{"бозгашт", "Tajik"},
+	{"மீண்டும்", "Tamil"},
+	{"తిరిగి", "Telugu"},
+	{"กลับ", "Thai"},
+	{"واپس", "Urdu"},
+	{"orqa", "Uzbek"},
+	{"trở lại", "Vietnamese"},
+	{"إلى الوراء", "Arabic"},
+	{"חזור", "Hebrew"},
+	{"بازگشت", "Persian"},
+	{"geri", "Turkish"},
+	{"terug", "Afrikaans"},
+	{"mmbuyo", "Chichewa"},
+	{"baya", "Hausa"},
+	{"azụ", "Igbo"},
+	{"khutlela", "Sesotho"},
+	{"dib", "Somali"},
+	{"nyuma", "Swahili"},
+	{"pada", "Yoruba"},
+	{"emuva", "Zulu"},
+	{"balik", "Cebuano"},
+	{"likod", "Filipino"},
+	{"kembali", "Indonesian"},
+	{"bali", "Javanese"},
+	{"indray", "Malagasy"},
+	{"kembali", "Malay"},
+	{"hoki", "Maori"},
+	{"reen", "Esperanto"},
+	{"tounen", "Haitian Creole"},
+	{"back", "English"},
+	{"\U0001f519", "Emoji"},
+	{"⠃⠁⠉⠅", "Braille"},
+}
+
+// BackWords are the built in trigger words.
+var BackWords = func() []string {
+	words := make([]string, len(BackWordLanguages))
+	for i, bw := range BackWordLanguages {
+		words[i] = bw.Word
+	}
+	return words
+}()
+
+// Languages reported for triggers that aren't built in, and for reaction backs.
+const (
+	CustomLanguage   = "Custom"
+	PatternLanguage  = "Pattern"
+	ReactionLanguage = "Reaction"
+)
+
+var backWordLanguages = func() map[string][]string {
+	languages := make(map[string][]string)
+	for _, bw := range BackWordLanguages {
+		languages[bw.Word] = append(languages[bw.Word], bw.Language)
+	}
+	return languages
+}()
+
+// triggerLanguages returns the languages that a detected trigger means "back" in.
+// Some words, like "назад", are shared by several languages.
+func triggerLanguages(match detect.Match) []string {
+	if match.Pattern {
+		return []string{PatternLanguage}
+	}
+	if languages, ok := backWordLanguages[match.Trigger]; ok {
+		return languages
+	}
+	return []string{CustomLanguage}
+}
+
+// WordOfTheDay returns the built in back word whose language is chosen for the day
+// of t, in UTC. Every language has an equal chance, however many words it shares.
+func WordOfTheDay(t time.Time) BackWord {
+	h := fnv.New32a()
+	h.Write([]byte(t.UTC().Format(time.DateOnly)))
+	return BackWordLanguages[h.Sum32()%uint32(len(BackWordLanguages))]
 }
@@ -0,0 +1,659 @@
+// Package config resolves the bot's configuration from, in increasing order of
+// precedence: built-in defaults, a JSON config file, BACKBOT_* environment
+// variables, and command line flags.
+package config
+
+import (
+	"back-bot/backs/model"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Token     string `json:"token,omitempty"`
+	TokenFile string `json:"token_file,omitempty"`
+
+	BackRepoPath string    `json:"back_repo_path"`
+	LootStore    LootStore `json:"loot_store"`
+	// GuildSettingsPath is where settings that guild admins change at runtime are kept.
+	GuildSettingsPath string `json:"guild_settings_path"`
+	// StatsPath is where counts of the words and languages backs are triggered with are kept.
+	StatsPath string `json:"stats_path"`
+
+	// Tiers are the rarities, rarest first, each with a directory of backs in back_repo.
+	// They can only be set in the config file. Empty uses the original four rarities.
+	Tiers []Tier `json:"tiers,omitempty"`
+	// RarityWeights override the relative odds of rolling each tier, keyed by tier name.
+	RarityWeights map[string]int `json:"rarity_weights,omitempty"`
+	// Pity boosts the odds of rarities that users haven't rolled in a while, keyed by rarity
+	// name. It can only be set in the config file.
+	Pity      map[string]Pity `json:"pity,omitempty"`
+	Cooldowns Cooldowns       `json:"cooldowns"`
+	// Selection is how backs are picked once their rarity is rolled, unless a guild chooses otherwise.
+	Selection Selection `json:"selection"`
+	// RejoinWindow is how soon after leaving voice a member must reconnect to be backed,
+	// in guilds that opt in. Zero disables rejoin backs everywhere.
+	RejoinWindow Duration `json:"rejoin_window"`
+	Daily        Daily    `json:"daily"`
+	// WordOfTheDayBonus is the greenbacks awarded for backs in the language of the day.
+	// Zero turns the word of the day off.
+	WordOfTheDayBonus int `json:"word_of_the_day_bonus"`
+	// GiftsPerDay is the daily gift limit. See backs.NewGiftCmdHandler.
+	GiftsPerDay int      `json:"gifts_per_day"`
+	Market      Market   `json:"market"`
+	Messages    Messages `json:"messages"`
+	// Events are limited-time pools of backs. They can only be set in the config file.
+	Events []Event `json:"events,omitempty"`
+	// AdminRoles are the IDs of guild roles allowed to use admin commands,
+	// in addition to members with the Manage Server permission.
+	AdminRoles []string `json:"admin_roles"`
+
+	Log      Log      `json:"log"`
+	HTTPAddr string   `json:"http_addr"`
+	Commands Commands `json:"commands"`
+}
+
+type LootStore struct {
+	// Driver selects the loot store implementation. Only "csv" is supported.
+	Driver string `json:"driver"`
+	Path   string `json:"path"`
+	// FlushInterval is the minimum time between flushes to disk. Zero flushes on every change.
+	FlushInterval Duration `json:"flush_interval"`
+}
+
+type Cooldowns struct {
+	PerUser  Duration `json:"per_user"`
+	PerGuild Duration `json:"per_guild"`
+	// GlobalPerMinute caps chat backs across all guilds. Zero means unlimited.
+	GlobalPerMinute int `json:"global_per_minute"`
+	// Reaction is added to backs ignored during a cooldown. If empty, they're ignored silently.
+	Reaction string `json:"reaction"`
+}
+
+// Tier is a rarity. See model.Tier.
+type Tier struct {
+	Name      string `json:"name"`
+	Weight    int    `json:"weight"`
+	LootValue int    `json:"loot_value,omitempty"`
+	Color     Color  `json:"color,omitempty"`
+	Emoji     string `json:"emoji,omitempty"`
+	Rollback  bool   `json:"rollback,omitempty"`
+}
+
+// Pity is a rarity's pity timer. See backs.Pity.
+type Pity struct {
+	SoftAfter       int `json:"soft_after"`
+	SoftStep        int `json:"soft_step"`
+	GuaranteedAfter int `json:"guaranteed_after"`
+}
+
+type Selection struct {
+	// Strategy is "uniform" or "shuffle".
+	Strategy string `json:"strategy"`
+	// NoRepeat is how many of a guild's most recent backs can't play again.
+	NoRepeat int `json:"no_repeat"`
+}
+
+// Daily configures the rewards for /daily.
+type Daily struct {
+	// Greenbacks are awarded for every claim.
+	Greenbacks int `json:"greenbacks"`
+	// StreakBonus is added for each consecutive day after the first, up to MaxStreak days.
+	StreakBonus int `json:"streak_bonus"`
+	MaxStreak   int `json:"max_streak"`
+}
+
+// Market configures the guild marketplace, /market. See backs.NewMarketCmdHandler.
+type Market struct {
+	// Path is where listings are kept.
+	Path          string   `json:"path"`
+	ListingExpiry Duration `json:"listing_expiry"`
+	MaxListings   int      `json:"max_listings"`
+}
+
+// Messages decides which messages can trigger backs.
+type Messages struct {
+	AllowBots     bool `json:"allow_bots"`
+	AllowWebhooks bool `json:"allow_webhooks"`
+	// Edits checks edited messages for backs. Each message backs at most once.
+	Edits bool `json:"edits"`
+	// IgnoreChannels are channel IDs where backs are never triggered.
+	IgnoreChannels []string `json:"ignore_channels"`
+	// IgnoreRoles are role IDs whose members never trigger backs.
+	IgnoreRoles []string `json:"ignore_roles"`
+}
+
+// Event is a pool of backs in back_repo/Events/<Name> that rolls alongside the
+// regular backs from the Start date through the End date, in UTC.
+type Event struct {
+	Name  string `json:"name"`
+	Start Date   `json:"start"`
+	End   Date   `json:"end"`
+	// Boost is how many times more likely the event's backs are than regular backs of
+	// the same rarity. Zero or one means equally likely.
+	Boost int `json:"boost,omitempty"`
+}
+
+type Log struct {
+	Level  string `json:"level"`
+	Format string `json:"format"`
+}
+
+type Commands struct {
+	// Sync bulk-overwrites slash commands, removing any that are no longer defined.
+	Sync bool `json:"sync"`
+	// DevGuilds are guild IDs to register slash commands in, instead of globally.
+	DevGuilds []string `json:"dev_guilds"`
+}
+
+// Duration is a time.Duration that is written as a string like "1m30s" in config files.
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Date is a UTC day that is written as a string like "2024-10-31" in config files.
+type Date time.Time
+
+const dateLayout = "2006-01-02"
+
+func (d Date) MarshalText() ([]byte, error) {
+	return []byte(time.Time(d).Format(dateLayout)), nil
+}
+
+func (d *Date) UnmarshalText(text []byte) error {
+	parsed, err := time.Parse(dateLayout, string(text))
+	if err != nil {
+		return err
+	}
+	*d = Date(parsed)
+	return nil
+}
+
+// Color is a 0xRRGGBB color that is written as a string like "#F1C40F" in config files.
+type Color int
+
+func (c Color) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("#%06X", int(c))), nil
+}
+
+func (c *Color) UnmarshalText(text []byte) error {
+	hex, ok := strings.CutPrefix(string(text), "#")
+	if !ok || len(hex) != 6 {
+		return fmt.Errorf("expected a color like #F1C40F, got %q", text)
+	}
+	parsed, err := strconv.ParseInt(hex, 16, 32)
+	if err != nil {
+		return fmt.Errorf("expected a color like #F1C40F, got %q", text)
+	}
+	*c = Color(parsed)
+	return nil
+}
+
+func Default() Config {
+	return Config{
+		BackRepoPath: "back_repo",
+		LootStore: LootStore{
+			Driver: "csv",
+		},
+		GuildSettingsPath: "guild_settings.json",
+		StatsPath:         "back_stats.json",
+		Selection: Selection{
+			Strategy: "uniform",
+		},
+		Daily: Daily{
+			Greenbacks:  50,
+			StreakBonus: 10,
+			MaxStreak:   7,
+		},
+		RejoinWindow: Duration(time.Minute),
+		GiftsPerDay:  3,
+		Market: Market{
+			Path:          "market.json",
+			ListingExpiry: Duration(72 * time.Hour),
+			MaxListings:   10,
+		},
+		Log: Log{
+			Level:  "info",
+			Format: "text",
+		},
+	}
+}
+
+// Options are the flags that aren't part of the Config itself.
+type Options struct {
+	ConfigFile  string
+	PrintConfig bool
+}
+
+// Load resolves the configuration from every layer, given the command line args
+// (excluding the program name) and an environment lookup such as os.LookupEnv.
+// The returned Config is not validated; call Validate before using it.
+func Load(fs *flag.FlagSet, args []string, lookupEnv func(string) (string, bool)) (Config, Options, error) {
+	var opts Options
+	var flagValues Config
+	var devGuilds string
+
+	fs.StringVar(&opts.ConfigFile, "config", "", "Path to a JSON config file. May also be set with BACKBOT_CONFIG")
+	fs.BoolVar(&opts.PrintConfig, "print-config", false, "Print the resolved configuration, with the token redacted, and exit")
+	fs.StringVar(&flagValues.Token, "t", "", "Bot Token")
+	fs.StringVar(&flagValues.TokenFile, "f", "", "Bot Token File")
+	fs.StringVar(&flagValues.BackRepoPath, "back-repo", "", "Path to the back repo")
+	fs.StringVar(&flagValues.LootStore.Driver, "lootstore-driver", "", "Loot store driver: csv")
+	fs.StringVar(&flagValues.LootStore.Path, "lootstore", "", "CSV Loot Store File")
+	fs.StringVar(&flagValues.GuildSettingsPath, "guild-settings", "", "Path to the guild settings JSON file")
+	fs.TextVar(&flagValues.LootStore.FlushInterval, "flush-interval", Duration(0), "Minimum time between loot store flushes, e.g. 30s")
+	fs.BoolVar(&flagValues.Commands.Sync, "sync-commands", false, "Bulk-overwrite slash commands, removing any that are no longer defined")
+	fs.StringVar(&devGuilds, "dev-guilds", "", "Comma-separated guild IDs to register slash commands in, instead of globally")
+	fs.StringVar(&flagValues.Log.Format, "log-format", "", "Log output format: text or json")
+	fs.StringVar(&flagValues.Log.Level, "log-level", "", "Minimum log level: debug, info, warn or error")
+	fs.StringVar(&flagValues.HTTPAddr, "http-addr", "", "Address to serve Prometheus metrics and health endpoints on, e.g. :9090. Disabled if empty")
+
+	if err := fs.Parse(args); err != nil {
+		return Config{}, opts, err
+	}
+
+	cfg := Default()
+
+	if opts.ConfigFile == "" {
+		opts.ConfigFile, _ = lookupEnv("BACKBOT_CONFIG")
+	}
+	if opts.ConfigFile != "" {
+		if err := cfg.loadFile(opts.ConfigFile); err != nil {
+			return Config{}, opts, err
+		}
+	}
+
+	if err := cfg.applyEnv(lookupEnv); err != nil {
+		return Config{}, opts, err
+	}
+
+	// only flags that were explicitly set override the lower layers
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "t":
+			cfg.Token = flagValues.Token
+		case "f":
+			cfg.TokenFile = flagValues.TokenFile
+		case "back-repo":
+			cfg.BackRepoPath = flagValues.BackRepoPath
+		case "lootstore-driver":
+			cfg.LootStore.Driver = flagValues.LootStore.Driver
+		case "lootstore":
+			cfg.LootStore.Path = flagValues.LootStore.Path
+		case "guild-settings":
+			cfg.GuildSettingsPath = flagValues.GuildSettingsPath
+		case "flush-interval":
+			cfg.LootStore.FlushInterval = flagValues.LootStore.FlushInterval
+		case "sync-commands":
+			cfg.Commands.Sync = flagValues.Commands.Sync
+		case "dev-guilds":
+			cfg.Commands.DevGuilds = splitList(devGuilds)
+		case "log-format":
+			cfg.Log.Format = flagValues.Log.Format
+		case "log-level":
+			cfg.Log.Level = flagValues.Log.Level
+		case "http-addr":
+			cfg.HTTPAddr = flagValues.HTTPAddr
+		}
+	})
+
+	return cfg, opts, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("failed to parse config file %v: %w", path, err)
+	}
+
+	return nil
+}
+
+func (c *Config) applyEnv(lookupEnv func(string) (string, bool)) error {
+	var errs []error
+
+	str := func(key string, dst *string) {
+		if v, ok := lookupEnv(key); ok {
+			*dst = v
+		}
+	}
+	list := func(key string, dst *[]string) {
+		if v, ok := lookupEnv(key); ok {
+			*dst = splitList(v)
+		}
+	}
+	parse := func(key string, parser func(string) error) {
+		if v, ok := lookupEnv(key); ok {
+			if err := parser(v); err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s: %w", key, err))
+			}
+		}
+	}
+
+	str("BACKBOT_TOKEN", &c.Token)
+	str("BACKBOT_TOKEN_FILE", &c.TokenFile)
+	str("BACKBOT_BACK_REPO", &c.BackRepoPath)
+	str("BACKBOT_LOOT_STORE_DRIVER", &c.LootStore.Driver)
+	str("BACKBOT_LOOT_STORE_PATH", &c.LootStore.Path)
+	str("BACKBOT_GUILD_SETTINGS_PATH", &c.GuildSettingsPath)
+	str("BACKBOT_STATS_PATH", &c.StatsPath)
+	parse("BACKBOT_FLUSH_INTERVAL", func(v string) error { return c.LootStore.FlushInterval.UnmarshalText([]byte(v)) })
+	parse("BACKBOT_RARITY_WEIGHTS", func(v string) error {
+		// e.g. "Rare=9,Common=309". Rarities not mentioned keep their weights.
+		for _, pair := range splitList(v) {
+			name, weight, ok := strings.Cut(pair, "=")
+			if !ok {
+				return fmt.Errorf("expected rarity=weight, got %q", pair)
+			}
+			w, err := strconv.Atoi(weight)
+			if err != nil {
+				return fmt.Errorf("invalid weight for %s: %w", name, err)
+			}
+			if c.RarityWeights == nil {
+				c.RarityWeights = make(map[string]int)
+			}
+			c.RarityWeights[strings.TrimSpace(name)] = w
+		}
+		return nil
+	})
+	parse("BACKBOT_COOLDOWN_PER_USER", func(v string) error { return c.Cooldowns.PerUser.UnmarshalText([]byte(v)) })
+	parse("BACKBOT_COOLDOWN_PER_GUILD", func(v string) error { return c.Cooldowns.PerGuild.UnmarshalText([]byte(v)) })
+	parse("BACKBOT_COOLDOWN_GLOBAL_PER_MINUTE", func(v string) (err error) {
+		c.Cooldowns.GlobalPerMinute, err = strconv.Atoi(v)
+		return err
+	})
+	str("BACKBOT_COOLDOWN_REACTION", &c.Cooldowns.Reaction)
+	str("BACKBOT_SELECTION", &c.Selection.Strategy)
+	parse("BACKBOT_NO_REPEAT", func(v string) (err error) {
+		c.Selection.NoRepeat, err = strconv.Atoi(v)
+		return err
+	})
+	parse("BACKBOT_DAILY_GREENBACKS", func(v string) (err error) {
+		c.Daily.Greenbacks, err = strconv.Atoi(v)
+		return err
+	})
+	parse("BACKBOT_DAILY_STREAK_BONUS", func(v string) (err error) {
+		c.Daily.StreakBonus, err = strconv.Atoi(v)
+		return err
+	})
+	parse("BACKBOT_DAILY_MAX_STREAK", func(v string) (err error) {
+		c.Daily.MaxStreak, err = strconv.Atoi(v)
+		return err
+	})
+	parse("BACKBOT_WORD_OF_THE_DAY_BONUS", func(v string) (err error) {
+		c.WordOfTheDayBonus, err = strconv.Atoi(v)
+		return err
+	})
+	parse("BACKBOT_GIFTS_PER_DAY", func(v string) (err error) {
+		c.GiftsPerDay, err = strconv.Atoi(v)
+		return err
+	})
+	str("BACKBOT_MARKET_PATH", &c.Market.Path)
+	parse("BACKBOT_MARKET_LISTING_EXPIRY", func(v string) error { return c.Market.ListingExpiry.UnmarshalText([]byte(v)) })
+	parse("BACKBOT_MARKET_MAX_LISTINGS", func(v string) (err error) {
+		c.Market.MaxListings, err = strconv.Atoi(v)
+		return err
+	})
+	parse("BACKBOT_REJOIN_WINDOW", func(v string) error { return c.RejoinWindow.UnmarshalText([]byte(v)) })
+	parse("BACKBOT_ALLOW_BOTS", func(v string) (err error) {
+		c.Messages.AllowBots, err = strconv.ParseBool(v)
+		return err
+	})
+	parse("BACKBOT_ALLOW_WEBHOOKS", func(v string) (err error) {
+		c.Messages.AllowWebhooks, err = strconv.ParseBool(v)
+		return err
+	})
+	parse("BACKBOT_HANDLE_EDITS", func(v string) (err error) {
+		c.Messages.Edits, err = strconv.ParseBool(v)
+		return err
+	})
+	list("BACKBOT_IGNORE_CHANNELS", &c.Messages.IgnoreChannels)
+	list("BACKBOT_IGNORE_ROLES", &c.Messages.IgnoreRoles)
+	list("BACKBOT_ADMIN_ROLES", &c.AdminRoles)
+	str("BACKBOT_LOG_LEVEL", &c.Log.Level)
+	str("BACKBOT_LOG_FORMAT", &c.Log.Format)
+	str("BACKBOT_HTTP_ADDR", &c.HTTPAddr)
+	parse("BACKBOT_SYNC_COMMANDS", func(v string) (err error) {
+		c.Commands.Sync, err = strconv.ParseBool(v)
+		return err
+	})
+	list("BACKBOT_DEV_GUILDS", &c.Commands.DevGuilds)
+
+	return errors.Join(errs...)
+}
+
+// ResolveToken reads the token from TokenFile if no Token was given directly.
+func (c *Config) ResolveToken() error {
+	if c.Token != "" || c.TokenFile == "" {
+		return nil
+	}
+
+	file, err := os.ReadFile(c.TokenFile)
+	if err != nil {
+		return fmt.Errorf("could not read token file: %w", err)
+	}
+	c.Token = strings.TrimSpace(string(file))
+
+	return nil
+}
+
+// Validate reports every problem with the configuration at once.
+func (c Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...any) { errs = append(errs, fmt.Errorf(format, args...)) }
+
+	if c.Token == "" && c.TokenFile == "" {
+		fail("a bot token is required: set token, token_file, BACKBOT_TOKEN, -t or -f")
+	}
+
+	if info, err := os.Stat(c.BackRepoPath); err != nil {
+		fail("back_repo_path %q is not readable: %v", c.BackRepoPath, err)
+	} else if !info.IsDir() {
+		fail("back_repo_path %q is not a directory", c.BackRepoPath)
+	}
+
+	switch c.LootStore.Driver {
+	case "csv":
+		if c.LootStore.Path == "" {
+			fail("loot_store.path is required for the csv driver")
+		}
+	default:
+		fail("unknown loot_store.driver %q, expected csv", c.LootStore.Driver)
+	}
+	if c.LootStore.FlushInterval < 0 {
+		fail("loot_store.flush_interval cannot be negative")
+	}
+
+	tiers, err := c.RarityTiers()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for name, pity := range c.Pity {
+		if len(tiers) > 0 && !slices.ContainsFunc(tiers, func(t model.Tier) bool { return t.Name == name }) {
+			fail("pity: unknown rarity %q", name)
+		}
+		if pity.SoftAfter < 0 || pity.SoftStep < 0 || pity.GuaranteedAfter < 0 {
+			fail("pity: thresholds for %s cannot be negative", name)
+		}
+	}
+
+	events := make(map[string]bool)
+	for _, event := range c.Events {
+		switch {
+		case event.Name == "" || strings.ContainsAny(event.Name, `/\`):
+			fail("events: invalid event name %q", event.Name)
+		case events[event.Name]:
+			fail("events: %q is configured more than once", event.Name)
+		case time.Time(event.End).Before(time.Time(event.Start)):
+			fail("events: %s ends before it starts", event.Name)
+		case event.Boost < 0:
+			fail("events: boost for %s cannot be negative", event.Name)
+		}
+		events[event.Name] = true
+
+		dir := filepath.Join(c.BackRepoPath, model.EventsDir, event.Name)
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			fail("events: %s has no directory at %q", event.Name, dir)
+		}
+	}
+
+	if c.Cooldowns.PerUser < 0 || c.Cooldowns.PerGuild < 0 {
+		fail("cooldowns cannot be negative")
+	}
+	switch c.Selection.Strategy {
+	case "uniform", "shuffle":
+	default:
+		fail("selection.strategy must be uniform or shuffle, got %q", c.Selection.Strategy)
+	}
+	if c.Selection.NoRepeat < 0 {
+		fail("selection.no_repeat cannot be negative")
+	}
+
+	if c.Daily.Greenbacks < 0 || c.Daily.StreakBonus < 0 || c.Daily.MaxStreak < 0 {
+		fail("daily rewards cannot be negative")
+	}
+	if c.WordOfTheDayBonus < 0 {
+		fail("word_of_the_day_bonus cannot be negative")
+	}
+	if c.GiftsPerDay < 0 {
+		fail("gifts_per_day cannot be negative")
+	}
+	if c.Market.ListingExpiry <= 0 {
+		fail("market.listing_expiry must be positive")
+	}
+	if c.Market.MaxListings < 0 {
+		fail("market.max_listings cannot be negative")
+	}
+	if c.RejoinWindow < 0 {
+		fail("rejoin_window cannot be negative")
+	}
+	if c.Cooldowns.GlobalPerMinute < 0 {
+		fail("cooldowns.global_per_minute cannot be negative")
+	}
+
+	switch strings.ToLower(c.Log.Format) {
+	case "text", "json":
+	default:
+		fail("unknown log.format %q, expected text or json", c.Log.Format)
+	}
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		fail("unknown log.level %q, expected debug, info, warn or error", c.Log.Level)
+	}
+
+	return errors.Join(errs...)
+}
+
+// RarityTiers are the configured tiers, or the defaults, with RarityWeights applied.
+func (c Config) RarityTiers() ([]model.Tier, error) {
+	tiers := slices.Clone(model.DefaultTiers)
+	if len(c.Tiers) > 0 {
+		tiers = make([]model.Tier, 0, len(c.Tiers))
+		for _, t := range c.Tiers {
+			tiers = append(tiers, model.Tier{
+				Name:      t.Name,
+				Weight:    t.Weight,
+				LootValue: t.LootValue,
+				Color:     int(t.Color),
+				Emoji:     t.Emoji,
+				Rollback:  t.Rollback,
+			})
+		}
+	}
+
+	var errs []error
+	for name, weight := range c.RarityWeights {
+		i := slices.IndexFunc(tiers, func(t model.Tier) bool { return t.Name == name })
+		if i < 0 {
+			errs = append(errs, fmt.Errorf("rarity_weights: unknown rarity %q", name))
+			continue
+		}
+		if weight < 0 {
+			errs = append(errs, fmt.Errorf("rarity_weights: weight for %s cannot be negative", name))
+			continue
+		}
+		tiers[i].Weight = weight
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	if err := model.CheckTiers(tiers); err != nil {
+		return nil, fmt.Errorf("tiers: %w", err)
+	}
+	return tiers, nil
+}
+
+// PityRules converts Pity to the pity for each model.Rarity. The tiers must already be
+// set with model.SetTiers.
+func (c Config) PityRules() (map[model.Rarity]Pity, error) {
+	rules := make(map[model.Rarity]Pity)
+
+	var errs []error
+	for name, pity := range c.Pity {
+		rarity, err := model.LookUpRarity(name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("pity: unknown rarity %q", name))
+			continue
+		}
+		if pity.SoftAfter < 0 || pity.SoftStep < 0 || pity.GuaranteedAfter < 0 {
+			errs = append(errs, fmt.Errorf("pity: thresholds for %s cannot be negative", name))
+			continue
+		}
+		rules[rarity] = pity
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return rules, nil
+}
+
+// Print writes the configuration as JSON, with the token redacted.
+func (c Config) Print(w io.Writer) error {
+	if c.Token != "" {
+		c.Token = "REDACTED"
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(c)
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
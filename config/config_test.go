@@ -0,0 +1,176 @@
+package config
+
+import (
+	"back-bot/backs/model"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadLayering(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	err := os.WriteFile(configPath, []byte(`{
+		"token": "from-file",
+		"back_repo_path": "file_repo",
+		"loot_store": {"path": "file.csv", "flush_interval": "1m"},
+		"rarity_weights": {"Rare": 50},
+		"log": {"level": "warn"},
+		"messages": {"allow_webhooks": true, "ignore_channels": ["789"]},
+		"market": {"path": "file_market.json", "listing_expiry": "48h"},
+		"events": [{"name": "Halloween", "start": "2024-10-01", "end": "2024-10-31", "boost": 3}]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{
+		"BACKBOT_CONFIG":                configPath,
+		"BACKBOT_TOKEN":                 "from-env",
+		"BACKBOT_LOOT_STORE_PATH":       "env.csv",
+		"BACKBOT_ADMIN_ROLES":           "123, 456",
+		"BACKBOT_RARITY_WEIGHTS":        "Common=100",
+		"BACKBOT_HANDLE_EDITS":          "true",
+		"BACKBOT_MARKET_LISTING_EXPIRY": "24h",
+	}
+	lookupEnv := func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg, _, err := Load(fs, []string{"-t", "from-flag", "-flush-interval", "10s"}, lookupEnv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Token != "from-flag" {
+		t.Fatalf("expected flag to override token, got %q", cfg.Token)
+	}
+	if cfg.BackRepoPath != "file_repo" {
+		t.Fatalf("expected file to set back repo path, got %q", cfg.BackRepoPath)
+	}
+	if cfg.LootStore.Path != "env.csv" {
+		t.Fatalf("expected env to override loot store path, got %q", cfg.LootStore.Path)
+	}
+	if cfg.LootStore.Driver != "csv" {
+		t.Fatalf("expected default loot store driver to survive, got %q", cfg.LootStore.Driver)
+	}
+	if time.Duration(cfg.LootStore.FlushInterval) != 10*time.Second {
+		t.Fatalf("expected flag to override flush interval, got %v", time.Duration(cfg.LootStore.FlushInterval))
+	}
+	if cfg.Log.Level != "warn" || cfg.Log.Format != "text" {
+		t.Fatalf("expected file log level and default format, got %+v", cfg.Log)
+	}
+	if len(cfg.AdminRoles) != 2 || cfg.AdminRoles[1] != "456" {
+		t.Fatalf("unexpected admin roles from env: %v", cfg.AdminRoles)
+	}
+
+	if !cfg.Messages.Edits || !cfg.Messages.AllowWebhooks || cfg.Messages.AllowBots || len(cfg.Messages.IgnoreChannels) != 1 {
+		t.Fatalf("unexpected message policy: %+v", cfg.Messages)
+	}
+
+	if cfg.Market.Path != "file_market.json" || time.Duration(cfg.Market.ListingExpiry) != 24*time.Hour || cfg.Market.MaxListings != 10 {
+		t.Fatalf("unexpected market config: %+v", cfg.Market)
+	}
+
+	if len(cfg.Events) != 1 || time.Time(cfg.Events[0].End) != time.Date(2024, 10, 31, 0, 0, 0, 0, time.UTC) || cfg.Events[0].Boost != 3 {
+		t.Fatalf("unexpected events from file: %+v", cfg.Events)
+	}
+
+	tiers, err := cfg.RarityTiers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	weights := make(map[string]int)
+	for _, tier := range tiers {
+		weights[tier.Name] = tier.Weight
+	}
+	if weights["Rare"] != 50 || weights["Common"] != 100 || weights["Uncommon"] != model.DefaultRarityWeights[model.Uncommon] {
+		t.Fatalf("unexpected merged rarity weights: %v", weights)
+	}
+}
+
+func TestRarityTiers(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	err := os.WriteFile(configPath, []byte(`{
+		"tiers": [
+			{"name": "Mythic", "weight": 1, "color": "#FF00FF", "emoji": "🦄"},
+			{"name": "Rollback", "weight": 2, "rollback": true},
+			{"name": "Common", "weight": 97, "loot_value": 10}
+		]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg, _, err := Load(fs, []string{"-config", configPath}, func(string) (string, bool) { return "", false })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tiers, err := cfg.RarityTiers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tiers) != 3 || tiers[0].Name != "Mythic" || tiers[0].Color != 0xFF00FF || !tiers[1].Rollback {
+		t.Fatalf("unexpected tiers from file: %+v", tiers)
+	}
+
+	cfg.Tiers = append(cfg.Tiers, Tier{Name: "Common", Weight: -1})
+	if _, err := cfg.RarityTiers(); err == nil || !strings.Contains(err.Error(), "Common is defined more than once") {
+		t.Fatalf("expected duplicate tier error, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Default()
+	cfg.BackRepoPath = t.TempDir()
+	cfg.Token = "token"
+	cfg.LootStore.Path = "loot.csv"
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config, got %v", err)
+	}
+
+	cfg.Token = ""
+	cfg.LootStore.Driver = "postgres"
+	cfg.RarityWeights = map[string]int{"Mythic": 1, "Rare": -1}
+	cfg.Log.Format = "xml"
+	cfg.Pity = map[string]Pity{"Rare": {SoftAfter: -1}}
+	cfg.Market.ListingExpiry = 0
+	cfg.Events = []Event{{
+		Name:  "Halloween",
+		Start: Date(time.Date(2024, 10, 31, 0, 0, 0, 0, time.UTC)),
+		End:   Date(time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC)),
+	}}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, expected := range []string{"token", "postgres", "Mythic", "Rare cannot be negative", "xml", "pity: thresholds for Rare", "Halloween ends before it starts", "Halloween has no directory", "market.listing_expiry"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected validation error mentioning %q, got:\n%v", expected, err)
+		}
+	}
+}
+
+func TestPrintRedactsToken(t *testing.T) {
+	cfg := Default()
+	cfg.Token = "super-secret"
+
+	var out strings.Builder
+	if err := cfg.Print(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(out.String(), "super-secret") || !strings.Contains(out.String(), "REDACTED") {
+		t.Fatalf("token not redacted:\n%s", out.String())
+	}
+}
@@ -2,9 +2,17 @@ package discord
 
 import (
 	"back-bot/backs"
+	"back-bot/backs/cooldown"
 	"back-bot/backs/loot"
+	"back-bot/backs/market"
+	"back-bot/backs/model"
+	"back-bot/backs/settings"
+	"back-bot/backs/stats"
+	"back-bot/logging"
 	"fmt"
+	"log/slog"
 	"os"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 )
@@ -12,51 +20,204 @@ import (
 type Bot struct {
 	Session        *discordgo.Session
 	MessageHandler backs.MessageHandler
-	LootCommands   backs.LootCommands
+	// MessageUpdateHandler checks edited messages.
+	MessageUpdateHandler backs.MessageUpdateHandler
+	// VoiceStateHandler reacts to members joining and leaving voice.
+	VoiceStateHandler backs.VoiceStateHandler
+	// ReactionHandler reacts to members reacting to messages.
+	ReactionHandler backs.ReactionHandler
+	LootCommands    backs.LootCommands
+	Commands        *CommandRouter
+	Health          *Health
+	commandSync     CommandSync
+	backs           backs.BackMapping
+	lootBag         loot.LootBag
+	backStats       *stats.Store
+	// expireListings returns the backs of expired market listings to their sellers.
+	expireListings func(s *discordgo.Session, now time.Time)
+	// stop ends the bot's background work when it's closed.
+	stop chan struct{}
 }
 
-// FIXME: May not want this hardcoded forever!
-const backRepoPath = "back_repo"
+// marketSweepInterval is how often expired market listings are returned to their sellers.
+const marketSweepInterval = time.Minute
 
 type NewBotInput struct {
-	Token            string
-	CsvLootStoreFile string
+	Token        string
+	BackRepoPath string
+	// LootStoreDriver selects the LootBag implementation. Only "csv" is supported.
+	LootStoreDriver   string
+	LootStorePath     string
+	LootFlushInterval time.Duration
+	RarityWeights     map[model.Rarity]int
+	Pity              backs.PityRules
+	Events            []backs.Event
+	Selection         backs.Selection
+	CommandSync       CommandSync
+	Cooldowns         cooldown.Limits
+	// CooldownReaction is added to backs ignored during a cooldown. If empty, they're ignored silently.
+	CooldownReaction string
+	// RejoinWindow is how soon after leaving voice a member must reconnect to be backed.
+	RejoinWindow  time.Duration
+	MessagePolicy backs.MessagePolicy
+	// GuildSettingsPath is where per-guild settings are persisted.
+	GuildSettingsPath string
+	// StatsPath is where counts of the words and languages backs are triggered with are kept.
+	StatsPath string
+	// WordOfTheDayBonus is the greenbacks awarded for backs in the language of the day.
+	WordOfTheDayBonus int
+	// GiftsPerDay is the daily gift limit. See backs.NewGiftCmdHandler.
+	GiftsPerDay  int
+	Market       MarketConfig
+	DailyRewards backs.DailyRewards
+	// AdminRoles are role IDs allowed to use admin commands, in addition to server managers.
+	AdminRoles []string
+}
+
+// MarketConfig configures /market. Path is passed to market.Open, and the rest to
+// backs.NewMarketCmdHandler.
+type MarketConfig struct {
+	Path          string
+	ListingExpiry time.Duration
+	MaxListings   int
 }
 
 func NewBot(input NewBotInput) *Bot {
 	session, err := discordgo.New(fmt.Sprintf("Bot %s", input.Token))
 	if err != nil {
-		fmt.Println("Could not authenticate Back Bot with Discord")
+		slog.Error("could not authenticate Back Bot with Discord", logging.Err, err)
 		return nil
 	}
 
 	// FIXME: I don't like the redundancy of backfs/backProvider.
 	// maybe we should just pass the actual backmapping around where it's needed,
 	// or the provider should completely encapsulate backfs
-	backfs := os.DirFS(backRepoPath)
-	backProvider := backs.NewBackProvider(backfs)
+	backfs := os.DirFS(input.BackRepoPath)
+	backProvider := backs.NewBackProvider(backfs, input.Events...)
 
 	var lootBag loot.LootBag
-	if input.CsvLootStoreFile != "" {
-		lootBag, err = loot.NewCsvLootBag(input.CsvLootStoreFile)
+	switch input.LootStoreDriver {
+	case "csv":
+		csvLootBag, err := loot.NewCsvLootBag(input.LootStorePath)
 		if err != nil {
-			fmt.Printf("failed to create csv loot bag. err: %v\n", err)
+			slog.Error("failed to create csv loot bag", "path", input.LootStorePath, logging.Err, err)
 			return nil
 		}
+		csvLootBag.SetFlushPolicy(loot.NewStalenessFlushPolicy(input.LootFlushInterval))
+		lootBag = csvLootBag
+	default:
+		slog.Error("unknown loot store driver", "driver", input.LootStoreDriver)
+		return nil
+	}
+
+	guildSettings, err := settings.Open(input.GuildSettingsPath)
+	if err != nil {
+		slog.Error("failed to open guild settings", "path", input.GuildSettingsPath, logging.Err, err)
+		return nil
+	}
+
+	backStats, err := stats.Open(input.StatsPath)
+	if err != nil {
+		slog.Error("failed to open back stats", "path", input.StatsPath, logging.Err, err)
+		return nil
+	}
+	// stats change on every back, so they're saved as often as the loot store
+	backStats.SetFlushInterval(input.LootFlushInterval)
+
+	listings, err := market.Open(input.Market.Path)
+	if err != nil {
+		slog.Error("failed to open market listings", "path", input.Market.Path, logging.Err, err)
+		return nil
 	}
 
 	backHandler, err := backs.NewBackHandler(backfs, backProvider)
 	if err != nil {
-		fmt.Println("Failed to instantiate backHandler")
+		slog.Error("failed to instantiate backHandler", logging.Err, err)
 		return nil
 	}
 
 	backHandler.ConnectLootActions(lootBag)
+	backHandler.SetRarityWeights(input.RarityWeights)
+	backHandler.SetPity(input.Pity)
+	backHandler.SetSelection(input.Selection)
+	backHandler.SetMessagePolicy(input.MessagePolicy)
+	backHandler.ConnectStats(backStats)
+	backHandler.SetWordOfTheDay(input.WordOfTheDayBonus)
+	backHandler.ConnectGuildSettings(guildSettings)
+
+	cooldowns := cooldown.NewLimiter(input.Cooldowns)
+	backHandler.SetCooldowns(cooldowns, input.CooldownReaction)
+
+	lootCommands := backs.NewLootCmdHandler(lootBag, backfs, backProvider)
+	lootCommands.SetPity(input.Pity)
+	backWordsCommands := backs.NewBackWordsCmdHandler(guildSettings, input.AdminRoles)
+	cooldownCommands := backs.NewCooldownCmdHandler(cooldowns)
+	backStatsCommands := backs.NewBackStatsCmdHandler(backStats, input.WordOfTheDayBonus)
+	backSelectionCommands := backs.NewBackSelectionCmdHandler(backHandler, guildSettings, input.AdminRoles)
+	catalogCommands := backs.NewCatalogCmdHandler(lootBag, backfs, backProvider)
+	giftCommands := backs.NewGiftCmdHandler(lootBag, backProvider, input.GiftsPerDay)
+	marketCommands := backs.NewMarketCmdHandler(lootBag, backProvider, listings, input.Market.ListingExpiry, input.Market.MaxListings)
+	// backs left in escrow by a crash are returned before anyone can use the market
+	marketCommands.ReconcileEscrow()
+	// rollbacks take listed backs too, so their listings come down first
+	backHandler.OnRollback(marketCommands.WithdrawListings)
+	lootCommands.OnRollback(marketCommands.WithdrawListings)
+	dailyCommands := backs.NewDailyCmdHandler(lootBag, backProvider, input.RarityWeights, input.DailyRewards)
+	rejoinHandler := backs.NewRejoinHandler(backHandler, guildSettings, input.RejoinWindow, input.AdminRoles)
+
+	router := NewCommandRouter()
+	err = router.Register(
+		&Command{
+			Definition: backs.BackpackCmd,
+			Handler:    lootCommands.Backpack,
+			Components: map[string]InteractionHandler{"page": lootCommands.BackpackPage},
+		},
+		&Command{Definition: backs.ViewBackpackCmd, Handler: lootCommands.ViewBackpack},
+		&Command{
+			Definition:   backs.BacksCmd,
+			Handler:      catalogCommands.Backs,
+			Autocomplete: catalogCommands.BacksAutocomplete,
+			Components: map[string]InteractionHandler{
+				"page":    catalogCommands.BacksPage,
+				"preview": catalogCommands.BacksPreview,
+			},
+		},
+		&Command{Definition: backs.PlaybackCmd, Handler: lootCommands.Playback, Autocomplete: lootCommands.PlaybackAutocomplete},
+		&Command{Definition: backs.RollbackCmd, Handler: lootCommands.Rollback},
+		&Command{Definition: backs.GiftBackCmd, Handler: giftCommands.GiftBack, Autocomplete: giftCommands.GiftBackAutocomplete},
+		&Command{
+			Definition:   backs.MarketCmd,
+			Handler:      marketCommands.Market,
+			Autocomplete: marketCommands.MarketAutocomplete,
+			Components:   map[string]InteractionHandler{"page": marketCommands.MarketPage},
+		},
+		&Command{Definition: backs.DailyCmd, Handler: dailyCommands.Daily},
+		&Command{Definition: backs.CooldownCmd, Handler: cooldownCommands.Cooldown},
+		&Command{Definition: backs.BackStatsCmd, Handler: backStatsCommands.BackStats},
+		&Command{Definition: backs.RejoinCmd, Handler: rejoinHandler.Rejoin},
+		&Command{Definition: backs.BackSelectionCmd, Handler: backSelectionCommands.BackSelection},
+		&Command{Definition: backs.BackWordsCmd, Handler: backWordsCommands.BackWords, Autocomplete: backWordsCommands.BackWordsAutocomplete},
+	)
+	if err != nil {
+		slog.Error("failed to register commands", logging.Err, err)
+		return nil
+	}
 
 	return &Bot{
-		Session:        session,
-		MessageHandler: backs.NewMessageDelegator(backHandler),
-		LootCommands:   backs.NewLootCmdHandler(lootBag, backfs, backProvider),
+		Session:              session,
+		MessageHandler:       backs.NewMessageDelegator(backHandler),
+		MessageUpdateHandler: backHandler,
+		VoiceStateHandler:    rejoinHandler,
+		ReactionHandler:      backs.NewReactionHandler(backHandler),
+		LootCommands:         lootCommands,
+		Commands:             router,
+		Health:               newHealth(session, lootBag, backProvider.Backs()),
+		commandSync:          input.CommandSync,
+		backs:                backProvider.Backs(),
+		lootBag:              lootBag,
+		backStats:            backStats,
+		expireListings:       marketCommands.ExpireListings,
+		stop:                 make(chan struct{}),
 	}
 }
 
@@ -64,33 +225,112 @@ func (b Bot) Open() error {
 	return b.Session.Open()
 }
 
+// Close marks the bot as no longer ready, stops its background work, closes its
+// session, and persists the loot store and back stats.
 func (b Bot) Close() {
-	b.Session.Close()
+	b.Health.setReady(false)
+	close(b.stop)
+
+	err := b.Session.Close()
+	if err != nil {
+		slog.Error("error closing discord session", logging.Err, err)
+	}
+
+	if shutdowner, ok := b.lootBag.(loot.Shutdowner); ok {
+		err = shutdowner.Shutdown()
+		if err != nil {
+			slog.Error("error shutting down loot store", logging.Err, err)
+		}
+	}
+
+	if err := b.backStats.Flush(); err != nil {
+		slog.Error("error saving back stats", logging.Err, err)
+	}
 }
 
 // RootHandler calls b.MessageHandler.Handle and logs any of its errors
 func (b Bot) RootHandler(s *discordgo.Session, msg *discordgo.MessageCreate) {
 	_, err := b.MessageHandler.Handle(s, msg)
 	if err != nil {
-		fmt.Printf("Bot.RootHandler received error from MessageHandler. msg: %+v err: %v\n", msg.Message, err)
+		slog.Error("Bot.RootHandler received error from MessageHandler", append(logging.MessageAttrs(msg.Message), logging.Err, err)...)
+	}
+}
+
+// RootUpdateHandler calls b.MessageUpdateHandler.HandleUpdate and logs any of its errors
+func (b Bot) RootUpdateHandler(s *discordgo.Session, msg *discordgo.MessageUpdate) {
+	_, err := b.MessageUpdateHandler.HandleUpdate(s, msg)
+	if err != nil {
+		slog.Error("Bot.RootUpdateHandler received error from MessageUpdateHandler", append(logging.MessageAttrs(msg.Message), logging.Err, err)...)
+	}
+}
+
+// sweepListings expires market listings until the bot is closed.
+func (b Bot) sweepListings() {
+	ticker := time.NewTicker(marketSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case now := <-ticker.C:
+			b.expireListings(b.Session, now)
+		}
 	}
 }
 
+// Start opens the bot's session, registers its commands, and runs readiness checks
+// against its dependencies. If any check fails, a *ReadinessError is returned
+// describing every check's outcome.
 func (b Bot) Start() error {
 	b.Session.AddHandler(b.RootHandler)
+	b.Session.AddHandler(b.RootUpdateHandler)
+	b.Session.AddHandler(b.Commands.Handle)
+	b.Session.AddHandler(b.VoiceStateHandler.Handle)
+	b.Session.AddHandler(b.ReactionHandler.Handle)
 	// We need information about guilds (which includes their channels),
-	// messages and voice states.
-	b.Session.Identify.Intents = discordgo.IntentsGuilds | discordgo.IntentsGuildMessages | discordgo.IntentsGuildVoiceStates
+	// messages (and their edits), reactions and voice states.
+	b.Session.Identify.Intents = discordgo.IntentsGuilds | discordgo.IntentsGuildMessages | discordgo.IntentsGuildMessageReactions | discordgo.IntentsGuildVoiceStates
+
+	var report ReadinessReport
 
 	err := b.Session.Open()
 	if err != nil {
-		return fmt.Errorf("failed to open bot session: %w", err)
+		err = fmt.Errorf("failed to open bot session: %w", err)
 	}
+	report = append(report, ReadinessCheck{Name: "discord session open", Err: err})
 
-	b.LootCommands.RegisterCommands(b.Session)
-	if err != nil {
-		return fmt.Errorf("failed to register bot loot commands: %w", err)
+	if err == nil {
+		err = b.Commands.RegisterCommands(b.Session, b.commandSync)
+		if err != nil {
+			err = fmt.Errorf("failed to register bot commands: %w", err)
+		}
+	} else {
+		err = errCheckSkipped
+	}
+	report = append(report, ReadinessCheck{Name: "commands registered", Err: err})
+
+	report = append(report,
+		ReadinessCheck{Name: "back_repo has backs for every rarity", Err: checkBackRepo(b.backs)},
+		ReadinessCheck{Name: "loot store readable", Err: checkLootStore(b.lootBag)},
+	)
+
+	for _, check := range report {
+		if check.Err != nil {
+			slog.Error("readiness check failed", "check", check.Name, logging.Err, check.Err)
+		} else {
+			slog.Info("readiness check passed", "check", check.Name)
+		}
+	}
+
+	if !report.OK() {
+		return &ReadinessError{Report: report}
 	}
 
+	b.Health.setReady(true)
+
+	// listings that expired while the bot was down are returned on the first sweep
+	go b.sweepListings()
+
 	return nil
 }
@@ -0,0 +1,141 @@
+package discord
+
+import (
+	"back-bot/backs"
+	"back-bot/backs/loot"
+	"back-bot/logging"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// heartbeatStaleAfter is how long the gateway can go without acknowledging a heartbeat
+// before the bot is considered unhealthy. Discord asks for a heartbeat roughly every 40s.
+const heartbeatStaleAfter = 2 * time.Minute
+
+// Health tracks the bot's gateway connection and lifecycle, and serves
+// liveness and readiness endpoints for container orchestration.
+type Health struct {
+	session     *discordgo.Session
+	lootBag     loot.LootBag
+	catalogSize int
+
+	mu        sync.Mutex
+	connected bool
+	// ready is set once startup checks pass, and cleared when shutdown begins
+	ready bool
+}
+
+func newHealth(session *discordgo.Session, lootBag loot.LootBag, mapping backs.BackMapping) *Health {
+	var catalogSize int
+	for _, backList := range mapping {
+		catalogSize += len(backList)
+	}
+
+	h := &Health{
+		session:     session,
+		lootBag:     lootBag,
+		catalogSize: catalogSize,
+	}
+
+	session.AddHandler(func(_ *discordgo.Session, _ *discordgo.Connect) { h.setConnected(true) })
+	session.AddHandler(func(_ *discordgo.Session, _ *discordgo.Disconnect) { h.setConnected(false) })
+
+	return h
+}
+
+func (h *Health) setConnected(connected bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.connected = connected
+}
+
+func (h *Health) setReady(ready bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ready = ready
+}
+
+// HealthStatus is the body served by the health endpoints.
+type HealthStatus struct {
+	Status           string     `json:"status"`
+	GatewayConnected bool       `json:"gateway_connected"`
+	Ready            bool       `json:"ready"`
+	LastHeartbeatAck *time.Time `json:"last_heartbeat_ack,omitempty"`
+	LastLootFlush    *time.Time `json:"last_loot_flush,omitempty"`
+	BackCatalogSize  int        `json:"back_catalog_size"`
+}
+
+func (h *Health) status() HealthStatus {
+	h.mu.Lock()
+	status := HealthStatus{
+		GatewayConnected: h.connected,
+		Ready:            h.ready,
+		BackCatalogSize:  h.catalogSize,
+	}
+	h.mu.Unlock()
+
+	h.session.RLock()
+	lastAck := h.session.LastHeartbeatAck
+	h.session.RUnlock()
+	if !lastAck.IsZero() {
+		status.LastHeartbeatAck = &lastAck
+	}
+
+	if reporter, ok := h.lootBag.(loot.FlushReporter); ok {
+		if lastFlush := reporter.LastFlush(); !lastFlush.IsZero() {
+			status.LastLootFlush = &lastFlush
+		}
+	}
+
+	return status
+}
+
+// Live reports whether the bot is functioning, regardless of whether it's ready for traffic.
+// It only fails if the gateway has connected at some point but stopped acknowledging heartbeats.
+func (s HealthStatus) Live() bool {
+	return s.LastHeartbeatAck == nil || time.Since(*s.LastHeartbeatAck) < heartbeatStaleAfter
+}
+
+// Serving reports whether the bot has finished starting up, isn't shutting down,
+// and is connected to the gateway.
+func (s HealthStatus) Serving() bool {
+	return s.Ready && s.GatewayConnected && s.Live()
+}
+
+// LivenessHandler serves /healthz.
+func (h *Health) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		status := h.status()
+		writeHealthStatus(w, status, status.Live())
+	})
+}
+
+// ReadinessHandler serves /readyz.
+func (h *Health) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		status := h.status()
+		writeHealthStatus(w, status, status.Serving())
+	})
+}
+
+func writeHealthStatus(w http.ResponseWriter, status HealthStatus, ok bool) {
+	code := http.StatusOK
+	status.Status = "ok"
+	if !ok {
+		code = http.StatusServiceUnavailable
+		status.Status = "unavailable"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	err := json.NewEncoder(w).Encode(status)
+	if err != nil {
+		slog.Error("failed to write health status", logging.Err, err)
+	}
+}
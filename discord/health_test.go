@@ -0,0 +1,57 @@
+package discord
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestHealthEndpoints(t *testing.T) {
+	session := new(discordgo.Session)
+	h := &Health{session: session}
+
+	get := func(handler http.Handler) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		return rec.Code
+	}
+
+	// starting up: alive, but not ready
+	if code := get(h.LivenessHandler()); code != http.StatusOK {
+		t.Fatalf("expected healthz to pass during startup, got %v", code)
+	}
+	if code := get(h.ReadinessHandler()); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected readyz to fail during startup, got %v", code)
+	}
+
+	session.LastHeartbeatAck = time.Now()
+	h.setConnected(true)
+	h.setReady(true)
+
+	if code := get(h.ReadinessHandler()); code != http.StatusOK {
+		t.Fatalf("expected readyz to pass once started, got %v", code)
+	}
+
+	// gateway dropped
+	h.setConnected(false)
+	if code := get(h.ReadinessHandler()); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected readyz to fail while disconnected, got %v", code)
+	}
+	h.setConnected(true)
+
+	// heartbeats stopped being acknowledged
+	session.LastHeartbeatAck = time.Now().Add(-heartbeatStaleAfter - time.Second)
+	if code := get(h.LivenessHandler()); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected healthz to fail with a stale heartbeat, got %v", code)
+	}
+	session.LastHeartbeatAck = time.Now()
+
+	// shutting down
+	h.setReady(false)
+	if code := get(h.ReadinessHandler()); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected readyz to fail during shutdown, got %v", code)
+	}
+}
@@ -0,0 +1,76 @@
+package discord
+
+import (
+	"back-bot/backs"
+	"back-bot/backs/loot"
+	"back-bot/backs/model"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var errCheckSkipped = errors.New("skipped")
+
+// ReadinessCheck is the outcome of a single startup check. A nil Err means it passed.
+type ReadinessCheck struct {
+	Name string
+	Err  error
+}
+
+// ReadinessReport collects the outcomes of the checks run by Bot.Start.
+type ReadinessReport []ReadinessCheck
+
+func (r ReadinessReport) OK() bool {
+	for _, check := range r {
+		if check.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (r ReadinessReport) String() string {
+	var report strings.Builder
+	for _, check := range r {
+		if check.Err == nil {
+			fmt.Fprintf(&report, "  [ok]   %s\n", check.Name)
+		} else {
+			fmt.Fprintf(&report, "  [FAIL] %s: %v\n", check.Name, check.Err)
+		}
+	}
+	return report.String()
+}
+
+// ReadinessError is returned by Bot.Start when any readiness check fails.
+type ReadinessError struct {
+	Report ReadinessReport
+}
+
+func (e *ReadinessError) Error() string {
+	return "back bot failed readiness checks:\n" + e.Report.String()
+}
+
+func checkBackRepo(mapping backs.BackMapping) error {
+	var missing []string
+	for _, rarity := range model.Rarities {
+		if len(mapping[rarity]) == 0 {
+			missing = append(missing, rarity.String())
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("no backs found for rarities: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func checkLootStore(lootBag loot.LootBag) error {
+	if lootBag == nil {
+		return errors.New("no loot store configured")
+	}
+
+	if checker, ok := lootBag.(loot.Checker); ok {
+		return checker.Check()
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package discord
+
+import (
+	"back-bot/backs"
+	"back-bot/backs/loot"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestReadinessChecks(t *testing.T) {
+	fullRepo := fstest.MapFS{
+		"Rollback/rollback.dca": {},
+		"Rare/welcome_back.dca": {},
+		"Uncommon/back.dca":     {},
+		"Common/hello_back.dca": {},
+	}
+	full, err := backs.GetBacks(fullRepo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a back_repo that doesn't exist yields no backs at all
+	missing, _ := backs.GetBacks(os.DirFS(filepath.Join(t.TempDir(), "missing")))
+
+	readable, err := loot.NewCsvLootBag(filepath.Join(t.TempDir(), "loot.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreadable, err := loot.NewCsvLootBag(filepath.Join(t.TempDir(), "loot.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// closes the loot file out from under the loot bag
+	if err := unreadable.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		mapping  backs.BackMapping
+		lootBag  loot.LootBag
+		expected []string
+	}{
+		{name: "all pass", mapping: full, lootBag: readable},
+		{name: "missing back_repo", mapping: missing, lootBag: readable, expected: []string{"[FAIL] back_repo", "Rollback, Rare, Uncommon, Common"}},
+		{name: "unreadable loot store", mapping: full, lootBag: unreadable, expected: []string{"[FAIL] loot store readable", "file already closed"}},
+		{name: "no loot store", mapping: full, expected: []string{"[FAIL] loot store readable: no loot store configured"}},
+	}
+
+	for _, tc := range cases {
+		report := ReadinessReport{
+			{Name: "discord session open"},
+			{Name: "back_repo has backs for every rarity", Err: checkBackRepo(tc.mapping)},
+			{Name: "loot store readable", Err: checkLootStore(tc.lootBag)},
+		}
+
+		if report.OK() != (len(tc.expected) == 0) {
+			t.Errorf("%s: unexpected report:\n%s", tc.name, report)
+			continue
+		}
+
+		message := (&ReadinessError{Report: report}).Error()
+		if !strings.Contains(message, "[ok]   discord session open") {
+			t.Errorf("%s: expected passing checks in the report, got:\n%s", tc.name, message)
+		}
+		for _, expected := range tc.expected {
+			if !strings.Contains(message, expected) {
+				t.Errorf("%s: expected %q in the report, got:\n%s", tc.name, expected, message)
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package discord
+
+import (
+	"back-bot/logging"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// CommandSync configures how the router's commands are registered with Discord.
+type CommandSync struct {
+	// Overwrite bulk-overwrites the bot's commands in each scope, which also
+	// removes any commands that are no longer defined in code.
+	// Otherwise, each command is individually created, and stale commands linger.
+	Overwrite bool
+	// GuildIDs restricts registration to the given guilds, which is handy for development
+	// since guild commands show up immediately, unlike global commands.
+	// If empty, commands are registered globally.
+	GuildIDs []string
+}
+
+// scopes returns the guild IDs to register commands in, where "" is the global scope.
+func (c CommandSync) scopes() []string {
+	if len(c.GuildIDs) == 0 {
+		return []string{""}
+	}
+	return c.GuildIDs
+}
+
+// RegisterCommands registers every command in the router with Discord, according to sync.
+func (r *CommandRouter) RegisterCommands(s *discordgo.Session, sync CommandSync) error {
+	appID := s.State.User.ID
+	defs := r.Definitions()
+
+	for _, guildID := range sync.scopes() {
+		if !sync.Overwrite {
+			for _, def := range defs {
+				_, err := s.ApplicationCommandCreate(appID, guildID, def)
+				if err != nil {
+					return fmt.Errorf("failed to create command %v. guildID: %q err: %w", def.Name, guildID, err)
+				}
+			}
+			continue
+		}
+
+		existing, err := s.ApplicationCommands(appID, guildID)
+		if err != nil {
+			return fmt.Errorf("failed to fetch existing commands. guildID: %q err: %w", guildID, err)
+		}
+
+		diff := diffCommands(existing, defs)
+
+		_, err = s.ApplicationCommandBulkOverwrite(appID, guildID, defs)
+		if err != nil {
+			return fmt.Errorf("failed to overwrite commands. guildID: %q err: %w", guildID, err)
+		}
+
+		slog.Info("synced commands",
+			slog.String(logging.GuildID, guildID),
+			slog.Any("added", diff.Added),
+			slog.Any("removed", diff.Removed),
+			slog.Any("changed", diff.Changed),
+			slog.Any("unchanged", diff.Unchanged),
+		)
+	}
+
+	return nil
+}
+
+// commandDiff describes the changes between the commands registered with Discord and
+// the ones defined in code, by command name.
+type commandDiff struct {
+	Added     []string
+	Removed   []string
+	Changed   []string
+	Unchanged []string
+}
+
+func diffCommands(existing, desired []*discordgo.ApplicationCommand) commandDiff {
+	var diff commandDiff
+
+	existingByName := make(map[string]*discordgo.ApplicationCommand)
+	for _, cmd := range existing {
+		existingByName[cmd.Name] = cmd
+	}
+
+	for _, cmd := range desired {
+		prev, ok := existingByName[cmd.Name]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, cmd.Name)
+		case commandFingerprint(prev) != commandFingerprint(cmd):
+			diff.Changed = append(diff.Changed, cmd.Name)
+		default:
+			diff.Unchanged = append(diff.Unchanged, cmd.Name)
+		}
+		delete(existingByName, cmd.Name)
+	}
+
+	for name := range existingByName {
+		diff.Removed = append(diff.Removed, name)
+	}
+	slices.Sort(diff.Removed)
+
+	return diff
+}
+
+// commandFingerprint summarizes the parts of a command we define, ignoring
+// the fields Discord assigns on creation.
+func commandFingerprint(cmd *discordgo.ApplicationCommand) string {
+	typ := cmd.Type
+	if typ == 0 {
+		typ = discordgo.ChatApplicationCommand
+	}
+
+	dmPermission := true
+	if cmd.DMPermission != nil {
+		dmPermission = *cmd.DMPermission
+	}
+
+	options, _ := json.Marshal(cmd.Options)
+
+	return fmt.Sprintf("%d|%s|%t|%s", typ, cmd.Description, dmPermission, options)
+}
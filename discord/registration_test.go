@@ -0,0 +1,38 @@
+package discord
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestDiffCommands(t *testing.T) {
+	existing := []*discordgo.ApplicationCommand{
+		{ID: "1", ApplicationID: "app", Version: "1", Name: "backpack", Description: "View your backpack", Type: discordgo.ChatApplicationCommand, DMPermission: &falseVar},
+		{ID: "2", ApplicationID: "app", Version: "1", Name: "playback", Description: "Play a back", Type: discordgo.ChatApplicationCommand},
+		{ID: "3", ApplicationID: "app", Version: "1", Name: "frontpack", Description: "Gone", Type: discordgo.ChatApplicationCommand},
+	}
+	desired := []*discordgo.ApplicationCommand{
+		{Name: "backpack", Description: "View your backpack", Type: discordgo.ChatApplicationCommand, DMPermission: &falseVar},
+		{Name: "playback", Description: "Play one of the backs from your backpack"},
+		{Name: "rollback", Description: "It's time to go back"},
+	}
+
+	diff := diffCommands(existing, desired)
+
+	if !slices.Equal(diff.Added, []string{"rollback"}) {
+		t.Fatalf("unexpected added commands: %v", diff.Added)
+	}
+	if !slices.Equal(diff.Removed, []string{"frontpack"}) {
+		t.Fatalf("unexpected removed commands: %v", diff.Removed)
+	}
+	if !slices.Equal(diff.Changed, []string{"playback"}) {
+		t.Fatalf("unexpected changed commands: %v", diff.Changed)
+	}
+	if !slices.Equal(diff.Unchanged, []string{"backpack"}) {
+		t.Fatalf("unexpected unchanged commands: %v", diff.Unchanged)
+	}
+}
+
+var falseVar bool
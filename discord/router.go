@@ -0,0 +1,140 @@
+package discord
+
+import (
+	"back-bot/logging"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// InteractionHandler services a single interaction from Discord.
+type InteractionHandler func(s *discordgo.Session, i *discordgo.InteractionCreate)
+
+// Command bundles an application command's definition with the handlers
+// that service its interactions.
+//
+// Message components and modals spawned by a command are routed back to it
+// by their CustomID, which must take the form "<command name>:<component>[:<args>...]".
+// The router dispatches on the first two segments; the rest is left for the
+// component handler to interpret.
+type Command struct {
+	Definition *discordgo.ApplicationCommand
+	Handler    InteractionHandler
+	// Autocomplete is optional, and only needed if one of the command's
+	// options has Autocomplete set.
+	Autocomplete InteractionHandler
+	// Components maps a component name (the second CustomID segment) to its handler.
+	// Modal submissions are routed through here too.
+	Components map[string]InteractionHandler
+}
+
+// CommandRouter dispatches interactions to the Command they belong to.
+type CommandRouter struct {
+	commands map[string]*Command
+	// registration order, so that definitions are stable across restarts
+	names []string
+}
+
+func NewCommandRouter() *CommandRouter {
+	return &CommandRouter{
+		commands: make(map[string]*Command),
+	}
+}
+
+// Register adds cmds to the router. Command names must be unique.
+func (r *CommandRouter) Register(cmds ...*Command) error {
+	for _, cmd := range cmds {
+		if cmd == nil || cmd.Definition == nil {
+			return errors.New("cannot register a command without a definition")
+		}
+
+		name := cmd.Definition.Name
+		if _, ok := r.commands[name]; ok {
+			return fmt.Errorf("command registered more than once. name: %v", name)
+		}
+		if cmd.Handler == nil {
+			return fmt.Errorf("command has no handler. name: %v", name)
+		}
+
+		r.commands[name] = cmd
+		r.names = append(r.names, name)
+	}
+
+	return nil
+}
+
+// Definitions returns the definitions of every registered command, in registration order.
+func (r *CommandRouter) Definitions() []*discordgo.ApplicationCommand {
+	defs := make([]*discordgo.ApplicationCommand, 0, len(r.names))
+	for _, name := range r.names {
+		defs = append(defs, r.commands[name].Definition)
+	}
+	return defs
+}
+
+// Handle is added as a handler to the Discord bot's connection, and routes
+// each interaction to the appropriate Command handler by its type and name.
+// Interactions that don't belong to any registered command are logged and dropped.
+func (r *CommandRouter) Handle(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	logger := slog.With(slog.String("interaction_type", i.Type.String()), slog.String("interaction_id", i.ID))
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			logger.Error("CommandRouter: recovered from panic while handling interaction", "panic", rec)
+		}
+	}()
+
+	handler, name := r.route(i)
+	if handler == nil {
+		logger.Warn("CommandRouter: no handler for interaction", "name", name)
+		return
+	}
+
+	logger.Debug("handling an interaction", append(logging.InteractionAttrs(i), "name", name)...)
+	handler(s, i)
+}
+
+// route finds the handler for i, along with a name describing the interaction for logging.
+func (r *CommandRouter) route(i *discordgo.InteractionCreate) (InteractionHandler, string) {
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		name := i.ApplicationCommandData().Name
+		if cmd, ok := r.commands[name]; ok {
+			return cmd.Handler, name
+		}
+		return nil, name
+
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		name := i.ApplicationCommandData().Name
+		if cmd, ok := r.commands[name]; ok {
+			return cmd.Autocomplete, name
+		}
+		return nil, name
+
+	case discordgo.InteractionMessageComponent:
+		return r.routeComponent(i.MessageComponentData().CustomID)
+
+	case discordgo.InteractionModalSubmit:
+		return r.routeComponent(i.ModalSubmitData().CustomID)
+
+	default:
+		return nil, ""
+	}
+}
+
+func (r *CommandRouter) routeComponent(customID string) (InteractionHandler, string) {
+	segments := strings.SplitN(customID, ":", 3)
+	if len(segments) < 2 {
+		return nil, customID
+	}
+
+	cmd, ok := r.commands[segments[0]]
+	if !ok {
+		return nil, customID
+	}
+
+	return cmd.Components[segments[1]], customID
+}
@@ -0,0 +1,91 @@
+package discord
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestCommandRouter(t *testing.T) {
+	var called string
+	handler := func(name string) InteractionHandler {
+		return func(s *discordgo.Session, i *discordgo.InteractionCreate) { called = name }
+	}
+
+	router := NewCommandRouter()
+	err := router.Register(&Command{
+		Definition:   &discordgo.ApplicationCommand{Name: "backpack"},
+		Handler:      handler("command"),
+		Autocomplete: handler("autocomplete"),
+		Components: map[string]InteractionHandler{
+			"page":  handler("page"),
+			"modal": handler("modal"),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := router.Register(&Command{Definition: &discordgo.ApplicationCommand{Name: "backpack"}, Handler: handler("dupe")}); err == nil {
+		t.Fatal("expected error registering duplicate command")
+	}
+
+	interaction := func(typ discordgo.InteractionType, data discordgo.InteractionData) *discordgo.InteractionCreate {
+		return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{Type: typ, Data: data}}
+	}
+
+	cases := []struct {
+		name        string
+		interaction *discordgo.InteractionCreate
+		expected    string
+	}{
+		{
+			name:        "application command",
+			interaction: interaction(discordgo.InteractionApplicationCommand, discordgo.ApplicationCommandInteractionData{Name: "backpack"}),
+			expected:    "command",
+		},
+		{
+			name:        "autocomplete",
+			interaction: interaction(discordgo.InteractionApplicationCommandAutocomplete, discordgo.ApplicationCommandInteractionData{Name: "backpack"}),
+			expected:    "autocomplete",
+		},
+		{
+			name:        "message component with args",
+			interaction: interaction(discordgo.InteractionMessageComponent, discordgo.MessageComponentInteractionData{CustomID: "backpack:page:2"}),
+			expected:    "page",
+		},
+		{
+			name:        "modal submit",
+			interaction: interaction(discordgo.InteractionModalSubmit, discordgo.ModalSubmitInteractionData{CustomID: "backpack:modal"}),
+			expected:    "modal",
+		},
+		{
+			name:        "unknown command",
+			interaction: interaction(discordgo.InteractionApplicationCommand, discordgo.ApplicationCommandInteractionData{Name: "frontpack"}),
+			expected:    "",
+		},
+		{
+			name:        "unknown component",
+			interaction: interaction(discordgo.InteractionMessageComponent, discordgo.MessageComponentInteractionData{CustomID: "backpack:nope"}),
+			expected:    "",
+		},
+		{
+			name:        "malformed component ID",
+			interaction: interaction(discordgo.InteractionMessageComponent, discordgo.MessageComponentInteractionData{CustomID: "backpack"}),
+			expected:    "",
+		},
+		{
+			name:        "ping",
+			interaction: interaction(discordgo.InteractionPing, nil),
+			expected:    "",
+		},
+	}
+
+	for _, c := range cases {
+		called = ""
+		router.Handle(nil, c.interaction)
+		if called != c.expected {
+			t.Fatalf("%s: expected handler %q to be called, got %q", c.name, c.expected, called)
+		}
+	}
+}
@@ -2,7 +2,10 @@ module back-bot
 
 go 1.22.3
 
-require github.com/bwmarrin/discordgo v0.28.1
+require (
+	github.com/bwmarrin/discordgo v0.28.1
+	golang.org/x/text v0.16.0
+)
 
 require (
 	github.com/gorilla/websocket v1.4.2 // indirect
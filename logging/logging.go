@@ -0,0 +1,81 @@
+// Package logging configures the bot's structured logger and defines the
+// attribute keys shared by every log line, so logs can be filtered consistently.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Attribute keys used across the bot.
+const (
+	GuildID   = "guild_id"
+	UserID    = "user_id"
+	ChannelID = "channel_id"
+	MessageID = "message_id"
+	BackPath  = "back_path"
+	Command   = "command"
+	Err       = "err"
+)
+
+// New creates a logger writing to w. format is one of "text" or "json", and level
+// is one of "debug", "info", "warn" or "error".
+func New(w io.Writer, format string, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	switch strings.ToLower(format) {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q, expected text or json", format)
+	}
+}
+
+// InteractionAttrs returns the identifying attributes of an interaction,
+// for use with slog.With.
+func InteractionAttrs(i *discordgo.InteractionCreate) []any {
+	attrs := []any{
+		slog.String(GuildID, i.GuildID),
+		slog.String(ChannelID, i.ChannelID),
+	}
+
+	if i.Member != nil && i.Member.User != nil {
+		attrs = append(attrs, slog.String(UserID, i.Member.User.ID))
+	} else if i.User != nil {
+		attrs = append(attrs, slog.String(UserID, i.User.ID))
+	}
+
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand, discordgo.InteractionApplicationCommandAutocomplete:
+		attrs = append(attrs, slog.String(Command, i.ApplicationCommandData().Name))
+	}
+
+	return attrs
+}
+
+// MessageAttrs returns the identifying attributes of a message, for use with slog.With.
+// Message content is deliberately excluded; log it at debug level only.
+func MessageAttrs(m *discordgo.Message) []any {
+	attrs := []any{
+		slog.String(GuildID, m.GuildID),
+		slog.String(ChannelID, m.ChannelID),
+		slog.String(MessageID, m.ID),
+	}
+
+	if m.Author != nil {
+		attrs = append(attrs, slog.String(UserID, m.Author.ID))
+	}
+
+	return attrs
+}
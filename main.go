@@ -1,65 +1,158 @@
 package main
 
 import (
+	"back-bot/backs"
+	"back-bot/backs/cooldown"
+	"back-bot/backs/model"
+	"back-bot/config"
 	"back-bot/discord"
+	"back-bot/logging"
+	"back-bot/metrics"
 	"flag"
 	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 )
 
-func init() {
-	flag.StringVar(&token, "t", "", "Bot Token")
-	flag.StringVar(&tokenFile, "f", "", "Bot Token File")
-	flag.StringVar(&csvLootStoreFile, "lootstore", "", "CSV Loot Store File")
-	flag.Parse()
-}
-
-var token string
-var tokenFile string
-var csvLootStoreFile string
-
 func main() {
+	cfg, opts, err := config.Load(flag.CommandLine, os.Args[1:], os.LookupEnv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Could not load configuration:", err)
+		os.Exit(2)
+	}
 
-	if token == "" {
-		if tokenFile == "" {
-			fmt.Println("No token or file provided. Please run: go run main.go -t <bot token> or Please run: go run main.go -f <token file>")
-			return
-		} else {
-			file, err := os.ReadFile(tokenFile)
-			if err != nil {
-				fmt.Println("Could not open token file")
-				return
-			}
-			token = string(file)
+	if opts.PrintConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, "Could not print configuration:", err)
+			os.Exit(2)
 		}
 	}
 
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+
+	if opts.PrintConfig {
+		return
+	}
+
+	if err := cfg.ResolveToken(); err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid configuration:", err)
+		os.Exit(2)
+	}
+
+	logger, err := logging.New(os.Stderr, cfg.Log.Format, cfg.Log.Level)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Could not configure logging:", err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+
+	// already validated
+	tiers, _ := cfg.RarityTiers()
+	if err := model.SetTiers(tiers); err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid rarity tiers:", err)
+		os.Exit(2)
+	}
+	pityRules, _ := cfg.PityRules()
+	pity := make(backs.PityRules, len(pityRules))
+	for rarity, p := range pityRules {
+		pity[rarity] = backs.Pity{SoftAfter: p.SoftAfter, SoftStep: p.SoftStep, GuaranteedAfter: p.GuaranteedAfter}
+	}
+
+	events := make([]backs.Event, 0, len(cfg.Events))
+	for _, e := range cfg.Events {
+		// the configured end date is the event's last day
+		end := time.Time(e.End).AddDate(0, 0, 1)
+		events = append(events, backs.Event{Name: e.Name, Start: time.Time(e.Start), End: end, Boost: e.Boost})
+	}
+
 	bot := discord.NewBot(discord.NewBotInput{
-		Token:            token,
-		CsvLootStoreFile: csvLootStoreFile,
+		Token:             cfg.Token,
+		BackRepoPath:      cfg.BackRepoPath,
+		LootStoreDriver:   cfg.LootStore.Driver,
+		LootStorePath:     cfg.LootStore.Path,
+		LootFlushInterval: time.Duration(cfg.LootStore.FlushInterval),
+		RarityWeights:     model.DefaultRarityWeights,
+		Pity:              pity,
+		Events:            events,
+		Selection: backs.Selection{
+			Strategy: cfg.Selection.Strategy,
+			NoRepeat: cfg.Selection.NoRepeat,
+		},
+		Cooldowns: cooldown.Limits{
+			PerUser:         time.Duration(cfg.Cooldowns.PerUser),
+			PerGuild:        time.Duration(cfg.Cooldowns.PerGuild),
+			GlobalPerMinute: cfg.Cooldowns.GlobalPerMinute,
+		},
+		CooldownReaction: cfg.Cooldowns.Reaction,
+		RejoinWindow:     time.Duration(cfg.RejoinWindow),
+		MessagePolicy: backs.MessagePolicy{
+			AllowBots:      cfg.Messages.AllowBots,
+			AllowWebhooks:  cfg.Messages.AllowWebhooks,
+			Edits:          cfg.Messages.Edits,
+			IgnoreChannels: cfg.Messages.IgnoreChannels,
+			IgnoreRoles:    cfg.Messages.IgnoreRoles,
+		},
+		GuildSettingsPath: cfg.GuildSettingsPath,
+		StatsPath:         cfg.StatsPath,
+		WordOfTheDayBonus: cfg.WordOfTheDayBonus,
+		GiftsPerDay:       cfg.GiftsPerDay,
+		Market: discord.MarketConfig{
+			Path:          cfg.Market.Path,
+			ListingExpiry: time.Duration(cfg.Market.ListingExpiry),
+			MaxListings:   cfg.Market.MaxListings,
+		},
+		DailyRewards: backs.DailyRewards{
+			Greenbacks:  cfg.Daily.Greenbacks,
+			StreakBonus: cfg.Daily.StreakBonus,
+			MaxStreak:   cfg.Daily.MaxStreak,
+		},
+		AdminRoles: cfg.AdminRoles,
+		CommandSync: discord.CommandSync{
+			Overwrite: cfg.Commands.Sync,
+			GuildIDs:  cfg.Commands.DevGuilds,
+		},
 	})
 	if bot == nil {
-		fmt.Println("Back bot could not be started")
-		return
+		slog.Error("back bot could not be started")
+		os.Exit(1)
 	}
 
 	// We need information about guilds (which includes their channels),
-	// messages and voice states.
-	bot.Session.Identify.Intents = discordgo.IntentsGuilds | discordgo.IntentsGuildMessages | discordgo.IntentsGuildVoiceStates
+	// messages (and their edits), reactions and voice states.
+	bot.Session.Identify.Intents = discordgo.IntentsGuilds | discordgo.IntentsGuildMessages | discordgo.IntentsGuildMessageReactions | discordgo.IntentsGuildVoiceStates
+
+	if cfg.HTTPAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Default.Handler())
+		mux.Handle("/healthz", bot.Health.LivenessHandler())
+		mux.Handle("/readyz", bot.Health.ReadinessHandler())
+
+		go func() {
+			slog.Info("serving http", "addr", cfg.HTTPAddr)
+			err := http.ListenAndServe(cfg.HTTPAddr, mux)
+			slog.Error("http server stopped", logging.Err, err)
+		}()
+	}
 
 	// Open the websocket and begin listening.
-	err := bot.Start()
+	err = bot.Start()
 	if err != nil {
-		fmt.Println("Error opening Discord session: ", err)
+		slog.Error("error starting back bot", logging.Err, err)
+		bot.Close()
 		os.Exit(1)
 	}
 
 	// Wait here until CTRL-C or other term signal is received.
-	fmt.Println("Back bot is now running. Press CTRL-C to exit.")
+	slog.Info("back bot is now running. Press CTRL-C to exit.")
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
 	<-sc
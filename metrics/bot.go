@@ -0,0 +1,67 @@
+package metrics
+
+// Default is the registry the bot's metrics are registered with.
+var Default = NewRegistry()
+
+var (
+	BacksDetected = Default.NewCounter(
+		"backbot_backs_detected_total",
+		"Messages detected as backs.",
+	)
+	BacksPlayed = Default.NewCounterVec(
+		"backbot_backs_played_total",
+		"Backs successfully played in voice, by rarity.",
+		"rarity",
+	)
+	BacksByLanguage = Default.NewCounterVec(
+		"backbot_backs_by_language_total",
+		"Backs detected, by the language of the trigger word. Words shared by several languages count for each.",
+		"language",
+	)
+	ReactionBacks = Default.NewCounter(
+		"backbot_reaction_backs_total",
+		"Backs triggered by reacting to a message.",
+	)
+	VoiceRejoinBacks = Default.NewCounter(
+		"backbot_voice_rejoin_backs_total",
+		"Backs triggered by members rejoining voice.",
+	)
+	BacksOnCooldown = Default.NewCounterVec(
+		"backbot_backs_on_cooldown_total",
+		"Backs ignored because of a cooldown, by the limit that applied: user, guild or global.",
+		"scope",
+	)
+	CommandInvocations = Default.NewCounterVec(
+		"backbot_command_invocations_total",
+		"Slash command invocations, by command.",
+		"command",
+	)
+	CommandFailures = Default.NewCounterVec(
+		"backbot_command_failures_total",
+		"Slash command invocations that failed due to an error, by command.",
+		"command",
+	)
+	VoiceJoinSeconds = Default.NewHistogram(
+		"backbot_voice_join_seconds",
+		"Time taken to join a voice channel for playback.",
+		DefaultBuckets,
+	)
+	LoadBackSeconds = Default.NewHistogram(
+		"backbot_load_back_seconds",
+		"Time taken to load a back's audio from the back repo.",
+		DefaultBuckets,
+	)
+	LootStoreFlushSeconds = Default.NewHistogram(
+		"backbot_loot_store_flush_seconds",
+		"Time taken to flush the loot store to disk.",
+		DefaultBuckets,
+	)
+	LootStoreFlushErrors = Default.NewCounter(
+		"backbot_loot_store_flush_errors_total",
+		"Failed loot store flushes.",
+	)
+	LootStoreUsers = Default.NewGauge(
+		"backbot_loot_store_users",
+		"Users currently tracked in the loot store.",
+	)
+)
@@ -0,0 +1,324 @@
+// Package metrics implements just enough of the Prometheus data model to expose
+// the bot's counters, gauges and histograms in the Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+// Registry holds a set of metrics and renders them in the Prometheus text format.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return new(Registry)
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.collectors {
+		if existing.name() == c.name() {
+			panic(fmt.Sprintf("metric registered more than once: %s", c.name()))
+		}
+	}
+	r.collectors = append(r.collectors, c)
+}
+
+// Write writes every metric in the registry to w, sorted by name.
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	collectors := slices.Clone(r.collectors)
+	r.mu.Unlock()
+
+	slices.SortFunc(collectors, func(a, b collector) int { return strings.Compare(a.name(), b.name()) })
+
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// Handler serves the registry's metrics for scraping.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+// float is a float64 that can be updated atomically.
+type float struct {
+	bits atomic.Uint64
+}
+
+func (f *float) add(v float64) {
+	for {
+		old := f.bits.Load()
+		updated := math.Float64bits(math.Float64frombits(old) + v)
+		if f.bits.CompareAndSwap(old, updated) {
+			return
+		}
+	}
+}
+
+func (f *float) set(v float64) {
+	f.bits.Store(math.Float64bits(v))
+}
+
+func (f *float) get() float64 {
+	return math.Float64frombits(f.bits.Load())
+}
+
+// Counter is a value that only goes up.
+type Counter struct {
+	value float
+}
+
+func (c *Counter) Inc() {
+	c.value.add(1)
+}
+
+// Add increments the counter by v, which must not be negative.
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		panic("counter cannot decrease")
+	}
+	c.value.add(v)
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	value float
+}
+
+func (g *Gauge) Set(v float64) {
+	g.value.set(v)
+}
+
+func (g *Gauge) Add(v float64) {
+	g.value.add(v)
+}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	upperBounds []float64
+	// counts[i] is the number of observations <= upperBounds[i],
+	// non-cumulatively; the final count is the +Inf bucket.
+	counts []atomic.Uint64
+	sum    float
+	count  atomic.Uint64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	upperBounds := slices.Clone(buckets)
+	slices.Sort(upperBounds)
+
+	return &Histogram{
+		upperBounds: upperBounds,
+		counts:      make([]atomic.Uint64, len(upperBounds)+1),
+	}
+}
+
+func (h *Histogram) Observe(v float64) {
+	i, _ := slices.BinarySearch(h.upperBounds, v)
+	h.counts[i].Add(1)
+	h.sum.add(v)
+	h.count.Add(1)
+}
+
+// DefaultBuckets suit latencies in seconds of typical bot operations.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// family is a named metric with zero or more labels, holding one child per label value set.
+type family[T any] struct {
+	metricName string
+	help       string
+	typ        string
+	labelNames []string
+	newChild   func() *T
+	writeChild func(w io.Writer, name string, labels string, child *T)
+
+	mu       sync.Mutex
+	children map[string]*T
+	labels   map[string][]string
+}
+
+func (f *family[T]) name() string {
+	return f.metricName
+}
+
+// With returns the child for the given label values, creating it if necessary.
+// The number of values must match the family's label names.
+func (f *family[T]) With(labelValues ...string) *T {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", f.metricName, len(f.labelNames), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	child, ok := f.children[key]
+	if !ok {
+		child = f.newChild()
+		f.children[key] = child
+		f.labels[key] = slices.Clone(labelValues)
+	}
+	return child
+}
+
+func (f *family[T]) write(w io.Writer) {
+	f.mu.Lock()
+	keys := make([]string, 0, len(f.children))
+	for key := range f.children {
+		keys = append(keys, key)
+	}
+	f.mu.Unlock()
+	slices.Sort(keys)
+
+	fmt.Fprintf(w, "# HELP %s %s\n", f.metricName, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.metricName, f.typ)
+
+	for _, key := range keys {
+		f.mu.Lock()
+		child, values := f.children[key], f.labels[key]
+		f.mu.Unlock()
+
+		f.writeChild(w, f.metricName, formatLabels(f.labelNames, values), child)
+	}
+}
+
+func newFamily[T any](r *Registry, name, help, typ string, labelNames []string, newChild func() *T, writeChild func(io.Writer, string, string, *T)) *family[T] {
+	f := &family[T]{
+		metricName: name,
+		help:       help,
+		typ:        typ,
+		labelNames: labelNames,
+		newChild:   newChild,
+		writeChild: writeChild,
+		children:   make(map[string]*T),
+		labels:     make(map[string][]string),
+	}
+	r.register(f)
+	return f
+}
+
+// CounterVec is a family of counters partitioned by label values.
+type CounterVec = family[Counter]
+
+// GaugeVec is a family of gauges partitioned by label values.
+type GaugeVec = family[Gauge]
+
+// HistogramVec is a family of histograms partitioned by label values.
+type HistogramVec = family[Histogram]
+
+func writeCounter(w io.Writer, name, labels string, c *Counter) {
+	fmt.Fprintf(w, "%s%s %s\n", name, labels, formatFloat(c.value.get()))
+}
+
+func writeGauge(w io.Writer, name, labels string, g *Gauge) {
+	fmt.Fprintf(w, "%s%s %s\n", name, labels, formatFloat(g.value.get()))
+}
+
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return newFamily(r, name, help, "counter", labelNames, func() *Counter { return new(Counter) }, writeCounter)
+}
+
+func (r *Registry) NewCounter(name, help string) *Counter {
+	return r.NewCounterVec(name, help).With()
+}
+
+func (r *Registry) NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	return newFamily(r, name, help, "gauge", labelNames, func() *Gauge { return new(Gauge) }, writeGauge)
+}
+
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	return r.NewGaugeVec(name, help).With()
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	return newFamily(r, name, help, "histogram", labelNames,
+		func() *Histogram { return newHistogram(buckets) },
+		func(w io.Writer, name, labels string, h *Histogram) {
+			// labels are rendered as `{a="b"}`; splice the le label in before the closing brace
+			withLe := func(le string) string {
+				if labels == "" {
+					return fmt.Sprintf(`{le="%s"}`, le)
+				}
+				return fmt.Sprintf(`%s,le="%s"}`, labels[:len(labels)-1], le)
+			}
+
+			var cumulative uint64
+			for i, upperBound := range h.upperBounds {
+				cumulative += h.counts[i].Load()
+				fmt.Fprintf(w, "%s_bucket%s %d\n", name, withLe(formatFloat(upperBound)), cumulative)
+			}
+			cumulative += h.counts[len(h.upperBounds)].Load()
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, withLe("+Inf"), cumulative)
+			fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, formatFloat(h.sum.get()))
+			fmt.Fprintf(w, "%s_count%s %d\n", name, labels, h.count.Load())
+		},
+	)
+}
+
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	return r.NewHistogramVec(name, help, buckets).With()
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, name, escapeLabelValue(values[i]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelValueEscaper.Replace(s)
+}
@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryTextFormat(t *testing.T) {
+	r := NewRegistry()
+
+	played := r.NewCounterVec("test_played_total", "Backs played.", "rarity")
+	played.With("Rare").Inc()
+	played.With("Common").Add(2)
+	played.With("Common").Inc()
+
+	users := r.NewGauge("test_users", "Users with \"loot\".\nSecond line.")
+	users.Set(42)
+
+	latency := r.NewHistogram("test_latency_seconds", "Latency.", []float64{0.1, 1})
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	latency.Observe(5)
+
+	escaped := r.NewCounterVec("test_escaped_total", "Escaping.", "path")
+	escaped.With(`a"b\c`).Inc()
+
+	expected := `# HELP test_escaped_total Escaping.
+# TYPE test_escaped_total counter
+test_escaped_total{path="a\"b\\c"} 1
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{le="0.1"} 1
+test_latency_seconds_bucket{le="1"} 2
+test_latency_seconds_bucket{le="+Inf"} 3
+test_latency_seconds_sum 5.55
+test_latency_seconds_count 3
+# HELP test_played_total Backs played.
+# TYPE test_played_total counter
+test_played_total{rarity="Common"} 3
+test_played_total{rarity="Rare"} 1
+# HELP test_users Users with "loot".\nSecond line.
+# TYPE test_users gauge
+test_users 42
+`
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	body, _ := io.ReadAll(rec.Body)
+	if string(body) != expected {
+		t.Fatalf("unexpected metrics output.\nexpected:\n%s\nactual:\n%s", expected, body)
+	}
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("unexpected content type: %v", ct)
+	}
+}
+
+func TestHistogramVecLabels(t *testing.T) {
+	r := NewRegistry()
+
+	h := r.NewHistogramVec("test_seconds", "Seconds.", []float64{1}, "command")
+	h.With("rollback").Observe(2)
+
+	var out strings.Builder
+	r.Write(&out)
+
+	if !strings.Contains(out.String(), `test_seconds_bucket{command="rollback",le="+Inf"} 1`) {
+		t.Fatalf("histogram labels not merged with le label:\n%s", out.String())
+	}
+}
+
+func TestDuplicateRegistrationPanics(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("test_total", "Test.")
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected duplicate registration to panic")
+		}
+	}()
+	r.NewCounter("test_total", "Test again.")
+}